@@ -0,0 +1,403 @@
+// Package agg evaluates aggregation pipelines over the documents of a
+// JSONStream, typically the results of Find, since InceptionDB has no
+// aggregation endpoint.
+//
+//	p := agg.New(agg.Options{MaxGroups: 100000},
+//		agg.Match(map[string]any{"status": "paid"}),
+//		agg.GroupBy([]string{"customer.country"},
+//			agg.Count("orders"),
+//			agg.Sum("revenue", "amount"),
+//			agg.Distinct("customers", "customer.id"),
+//		),
+//		agg.Sort("-revenue"),
+//		agg.Limit(10),
+//	)
+//	rows, err := p.Collect(stream)
+//
+// Documents flow through the stages one at a time. Only GroupBy and Sort hold
+// documents: GroupBy keeps one entry per group and spills them to disk past
+// Options.MaxGroups, and Sort followed by Limit keeps at most twice the limit.
+// A Limit that is not preceded by GroupBy or Sort stops reading the stream as
+// soon as it is reached.
+//
+// Fields are addressed by path, with dots separating the keys of nested
+// objects, e.g. "customer.country".
+package agg
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"inceptiondb"
+)
+
+// Options configures a pipeline.
+type Options struct {
+	// MaxGroups is the number of groups a GroupBy stage keeps in memory
+	// before spilling them to a temporary file. Zero keeps every group in
+	// memory.
+	MaxGroups int
+	// TempDir is where spill files are created, os.TempDir() when empty.
+	TempDir string
+}
+
+// Stage is a step of a pipeline.
+type Stage struct {
+	build func(opts Options, next *Stage) stage
+	limit int
+}
+
+// stage processes documents pushed by the previous stage and hands its output
+// to emit. flush is called once the input is exhausted.
+type stage interface {
+	push(doc map[string]any, emit func(map[string]any) error) error
+	flush(emit func(map[string]any) error) error
+}
+
+// errLimit stops the upstream stages once a Limit is reached.
+var errLimit = errors.New("agg: limit reached")
+
+// Pipeline is a sequence of stages. It holds no state between runs and may be
+// used concurrently.
+type Pipeline struct {
+	opts   Options
+	stages []Stage
+}
+
+// New returns a pipeline running stages in order.
+func New(opts Options, stages ...Stage) *Pipeline {
+	return &Pipeline{opts: opts, stages: stages}
+}
+
+// Run decodes every document of s, passes it through the pipeline and calls
+// fn with each resulting document. fn may return inceptiondb.ErrStopIteration
+// to stop early. The stream is closed when Run returns.
+func (p *Pipeline) Run(s *inceptiondb.JSONStream, fn func(map[string]any) error) error {
+	if s == nil {
+		return errors.New("nil stream")
+	}
+	if fn == nil {
+		return errors.New("nil callback")
+	}
+	defer s.Close()
+
+	stages := make([]stage, len(p.stages))
+	for i := range p.stages {
+		var next *Stage
+		if i+1 < len(p.stages) {
+			next = &p.stages[i+1]
+		}
+		stages[i] = p.stages[i].build(p.opts, next)
+		if c, ok := stages[i].(interface{ cleanup() }); ok {
+			defer c.cleanup()
+		}
+	}
+	emitters := make([]func(map[string]any) error, len(stages)+1)
+	emitters[len(stages)] = fn
+	for i := len(stages) - 1; i >= 0; i-- {
+		st, next := stages[i], emitters[i+1]
+		emitters[i] = func(doc map[string]any) error { return st.push(doc, next) }
+	}
+
+	err := func() error {
+		for {
+			var doc map[string]any
+			if err := s.Next(&doc); err != nil {
+				if errors.Is(err, io.EOF) {
+					return nil
+				}
+				return err
+			}
+			if err := emitters[0](doc); err != nil {
+				return err
+			}
+		}
+	}()
+	// A reached Limit only stops the input; the stages still flush what they
+	// hold, in order.
+	if err == nil || errors.Is(err, errLimit) {
+		for i, st := range stages {
+			if err = st.flush(emitters[i+1]); err != nil && !errors.Is(err, errLimit) {
+				break
+			}
+		}
+	}
+	if errors.Is(err, errLimit) || errors.Is(err, inceptiondb.ErrStopIteration) {
+		return nil
+	}
+	return err
+}
+
+// Collect runs the pipeline and returns the resulting documents.
+func (p *Pipeline) Collect(s *inceptiondb.JSONStream) ([]map[string]any, error) {
+	var out []map[string]any
+	err := p.Run(s, func(doc map[string]any) error {
+		out = append(out, doc)
+		return nil
+	})
+	return out, err
+}
+
+// Match keeps the documents whose fields equal the values of filter. Numbers
+// are compared by value, whatever their Go type.
+func Match(filter map[string]any) Stage {
+	return MatchFunc(func(doc map[string]any) bool {
+		for path, want := range filter {
+			got, ok := Get(doc, path)
+			if !ok || !equal(got, want) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// MatchFunc keeps the documents for which fn returns true.
+func MatchFunc(fn func(doc map[string]any) bool) Stage {
+	return Stage{build: func(Options, *Stage) stage { return matchStage(fn) }}
+}
+
+type matchStage func(map[string]any) bool
+
+func (m matchStage) push(doc map[string]any, emit func(map[string]any) error) error {
+	if m(doc) {
+		return emit(doc)
+	}
+	return nil
+}
+
+func (m matchStage) flush(func(map[string]any) error) error { return nil }
+
+// Project keeps only the given fields. Nested paths keep their nesting.
+func Project(paths ...string) Stage {
+	return Stage{build: func(Options, *Stage) stage { return projectStage(paths) }}
+}
+
+type projectStage []string
+
+func (p projectStage) push(doc map[string]any, emit func(map[string]any) error) error {
+	out := make(map[string]any, len(p))
+	for _, path := range p {
+		if v, ok := Get(doc, path); ok {
+			set(out, path, v)
+		}
+	}
+	return emit(out)
+}
+
+func (p projectStage) flush(func(map[string]any) error) error { return nil }
+
+// Sort orders the documents by the given fields, descending for fields
+// prefixed with "-". Values are ordered null first, then numbers, strings,
+// booleans and anything else by its JSON encoding. Sort holds every document
+// unless a Limit follows it.
+func Sort(fields ...string) Stage {
+	return Stage{build: func(_ Options, next *Stage) stage {
+		st := &sortStage{fields: fields}
+		if next != nil {
+			st.max = next.limit
+		}
+		return st
+	}}
+}
+
+type sortStage struct {
+	fields []string
+	max    int
+	docs   []map[string]any
+}
+
+func (s *sortStage) push(doc map[string]any, _ func(map[string]any) error) error {
+	s.docs = append(s.docs, doc)
+	if s.max > 0 && len(s.docs) >= 2*s.max {
+		s.sort()
+		s.docs = s.docs[:s.max]
+	}
+	return nil
+}
+
+func (s *sortStage) sort() {
+	sort.SliceStable(s.docs, func(i, j int) bool {
+		return compareDocs(s.fields, s.docs[i], s.docs[j]) < 0
+	})
+}
+
+func (s *sortStage) flush(emit func(map[string]any) error) error {
+	s.sort()
+	for _, doc := range s.docs {
+		if err := emit(doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func compareDocs(fields []string, a, b map[string]any) int {
+	for _, field := range fields {
+		path := strings.TrimPrefix(field, "-")
+		va, _ := Get(a, path)
+		vb, _ := Get(b, path)
+		cmp := Compare(va, vb)
+		if strings.HasPrefix(field, "-") {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// Limit passes on the first n documents and stops the pipeline.
+func Limit(n int) Stage {
+	return Stage{limit: n, build: func(Options, *Stage) stage { return &limitStage{n: n} }}
+}
+
+type limitStage struct {
+	n    int
+	seen int
+}
+
+func (l *limitStage) push(doc map[string]any, emit func(map[string]any) error) error {
+	if l.seen >= l.n {
+		return errLimit
+	}
+	l.seen++
+	if err := emit(doc); err != nil {
+		return err
+	}
+	if l.seen >= l.n {
+		return errLimit
+	}
+	return nil
+}
+
+func (l *limitStage) flush(func(map[string]any) error) error { return nil }
+
+// Get returns the value at path in doc.
+func Get(doc map[string]any, path string) (any, bool) {
+	var cur any = doc
+	for _, key := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		cur, ok = m[key]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func set(doc map[string]any, path string, v any) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		next, ok := doc[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			doc[key] = next
+		}
+		doc = next
+	}
+	doc[keys[len(keys)-1]] = v
+}
+
+// number converts numeric values to float64.
+func number(v any) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case json.Number:
+		f, err := strconv.ParseFloat(string(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func rank(v any) int {
+	if v == nil {
+		return 0
+	}
+	if _, ok := number(v); ok {
+		return 1
+	}
+	switch v.(type) {
+	case string:
+		return 2
+	case bool:
+		return 3
+	}
+	return 4
+}
+
+// Compare orders values as Sort does: null first, then numbers, strings,
+// booleans and anything else by its JSON encoding.
+func Compare(a, b any) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch ra {
+	case 1:
+		x, _ := number(a)
+		y, _ := number(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case 2:
+		return strings.Compare(a.(string), b.(string))
+	case 3:
+		x, y := a.(bool), b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	case 4:
+		return strings.Compare(encode(a), encode(b))
+	}
+	return 0
+}
+
+func equal(a, b any) bool {
+	return rank(a) == rank(b) && Compare(a, b) == 0
+}
+
+// encode returns the JSON encoding of v, with numbers in a canonical form so
+// equal values encode alike.
+func encode(v any) string {
+	if f, ok := number(v); ok {
+		if f == math.Trunc(f) && math.Abs(f) < 1<<53 {
+			return strconv.FormatInt(int64(f), 10)
+		}
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
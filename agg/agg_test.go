@@ -0,0 +1,220 @@
+package agg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"inceptiondb"
+)
+
+func stream(lines ...string) *inceptiondb.JSONStream {
+	return inceptiondb.NewJSONStream(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+}
+
+var orders = []string{
+	`{"id":1,"status":"paid","amount":10,"customer":{"id":"a","country":"es"}}`,
+	`{"id":2,"status":"paid","amount":5,"customer":{"id":"b","country":"fr"}}`,
+	`{"id":3,"status":"open","amount":7,"customer":{"id":"a","country":"es"}}`,
+	`{"id":4,"status":"paid","amount":20,"customer":{"id":"c","country":"es"}}`,
+	`{"id":5,"status":"paid","amount":1.5,"customer":{"id":"a","country":"es"}}`,
+	`{"id":6,"status":"paid","customer":{"id":"d","country":"de"}}`,
+}
+
+func TestGroupBy(t *testing.T) {
+	p := New(Options{},
+		Match(map[string]any{"status": "paid"}),
+		GroupBy([]string{"customer.country"},
+			Count("orders"),
+			Sum("revenue", "amount"),
+			Avg("avg", "amount"),
+			Min("min", "amount"),
+			Max("max", "amount"),
+			Distinct("customers", "customer.id"),
+		),
+		Sort("-revenue"),
+	)
+	rows, err := p.Collect(stream(orders...))
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	want := []map[string]any{
+		{"customer": map[string]any{"country": "es"}, "orders": int64(3), "revenue": 31.5, "avg": 10.5, "min": 1.5, "max": float64(20), "customers": []any{"a", "c"}},
+		{"customer": map[string]any{"country": "fr"}, "orders": int64(1), "revenue": float64(5), "avg": float64(5), "min": float64(5), "max": float64(5), "customers": []any{"b"}},
+		{"customer": map[string]any{"country": "de"}, "orders": int64(1), "revenue": float64(0), "avg": nil, "min": nil, "max": nil, "customers": []any{"d"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("Collect() = %v, want %v", rows, want)
+	}
+}
+
+func TestGroupByWithoutKeys(t *testing.T) {
+	p := New(Options{}, GroupBy(nil, Count("n"), Sum("total", "amount")))
+	rows, err := p.Collect(stream(orders...))
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(rows) != 1 || rows[0]["n"] != int64(6) || rows[0]["total"] != 43.5 {
+		t.Fatalf("Collect() = %v", rows)
+	}
+
+	rows, err = p.Collect(inceptiondb.NewJSONStream(strings.NewReader("")))
+	if err != nil {
+		t.Fatalf("Collect() on empty stream error = %v", err)
+	}
+	if len(rows) != 1 || rows[0]["n"] != int64(0) {
+		t.Fatalf("Collect() on empty stream = %v", rows)
+	}
+}
+
+func TestGroupBySpills(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, fmt.Sprintf(`{"k":%d,"v":%d}`, i%97, i))
+	}
+	dir := t.TempDir()
+	stages := []Stage{
+		GroupBy([]string{"k"}, Count("n"), Sum("sum", "v"), Min("min", "v"), Max("max", "v"), Distinct("d", "v")),
+		Sort("k"),
+	}
+	want, err := New(Options{}, stages...).Collect(stream(lines...))
+	if err != nil {
+		t.Fatalf("Collect() in memory error = %v", err)
+	}
+	got, err := New(Options{MaxGroups: 10, TempDir: dir}, stages...).Collect(stream(lines...))
+	if err != nil {
+		t.Fatalf("Collect() with spills error = %v", err)
+	}
+	if len(got) != 97 {
+		t.Fatalf("Collect() returned %d groups, want 97", len(got))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("spilled groups differ:\ngot  %v\nwant %v", got[0], want[0])
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Fatalf("spill files left behind: %v", entries)
+	}
+}
+
+func TestGroupBySpillKeepsTypesAndOrder(t *testing.T) {
+	var lines []string
+	for i := 0; i < 500; i++ {
+		lines = append(lines, fmt.Sprintf(`{"k":%d,"v":%d}`, i%150, 9007199254740993+int64(i)))
+	}
+	body := strings.Join(lines, "\n") + "\n"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+	client, err := inceptiondb.NewClient(srv.URL, inceptiondb.WithCodec(inceptiondb.JSONCodec{UseNumber: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	find := func() *inceptiondb.JSONStream {
+		s, err := client.Find(context.Background(), "items", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	stages := []Stage{GroupBy([]string{"k"}, Count("n"), Min("min", "v"), Distinct("d", "v"))}
+	want, err := New(Options{}, stages...).Collect(find())
+	if err != nil {
+		t.Fatalf("Collect() in memory error = %v", err)
+	}
+	// One group per spill makes more runs than are merged at once.
+	got, err := New(Options{MaxGroups: 1, TempDir: t.TempDir()}, stages...).Collect(find())
+	if err != nil {
+		t.Fatalf("Collect() with spills error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("spilled groups differ:\ngot  %v\nwant %v", got[0], want[0])
+	}
+	for i, doc := range got {
+		if doc["k"] != json.Number(fmt.Sprint(i)) {
+			t.Fatalf("group %d has key %#v, want json.Number(%d)", i, doc["k"], i)
+		}
+	}
+}
+
+func TestProjectSortLimit(t *testing.T) {
+	p := New(Options{},
+		Project("id", "customer.id", "amount"),
+		Sort("customer.id", "-amount"),
+		Limit(3),
+	)
+	rows, err := p.Collect(stream(orders...))
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	want := []map[string]any{
+		{"id": float64(1), "amount": float64(10), "customer": map[string]any{"id": "a"}},
+		{"id": float64(3), "amount": float64(7), "customer": map[string]any{"id": "a"}},
+		{"id": float64(5), "amount": 1.5, "customer": map[string]any{"id": "a"}},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Fatalf("Collect() = %v, want %v", rows, want)
+	}
+}
+
+func TestLimitStopsReading(t *testing.T) {
+	// The second line is not JSON: reading it would fail the run.
+	s := stream(`{"id":1}`, `not json`)
+	rows, err := New(Options{}, Limit(1)).Collect(s)
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	if len(rows) != 1 {
+		t.Fatalf("Collect() = %v, want 1 row", rows)
+	}
+}
+
+func TestLimitBeforeSort(t *testing.T) {
+	rows, err := New(Options{}, Limit(3), Sort("-id")).Collect(stream(orders...))
+	if err != nil {
+		t.Fatalf("Collect() error = %v", err)
+	}
+	var ids []float64
+	for _, row := range rows {
+		ids = append(ids, row["id"].(float64))
+	}
+	if !reflect.DeepEqual(ids, []float64{3, 2, 1}) {
+		t.Fatalf("ids = %v, want [3 2 1]", ids)
+	}
+}
+
+func TestRunStopsOnCallbackError(t *testing.T) {
+	boom := errors.New("boom")
+	err := New(Options{}).Run(stream(orders...), func(map[string]any) error { return boom })
+	if !errors.Is(err, boom) {
+		t.Fatalf("Run() error = %v, want %v", err, boom)
+	}
+	err = New(Options{}).Run(stream(orders...), func(map[string]any) error { return inceptiondb.ErrStopIteration })
+	if err != nil {
+		t.Fatalf("Run() error = %v, want nil on ErrStopIteration", err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	ordered := []any{nil, float64(-1), 2, "a", "b", false, true, map[string]any{"x": 1}}
+	for i := 1; i < len(ordered); i++ {
+		if Compare(ordered[i-1], ordered[i]) >= 0 {
+			t.Errorf("Compare(%v, %v) >= 0", ordered[i-1], ordered[i])
+		}
+	}
+	if !equal(2, float64(2)) {
+		t.Error("equal(2, 2.0) = false")
+	}
+}
@@ -0,0 +1,464 @@
+package agg
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+func init() {
+	// The types of decoded JSON documents, for the values of spilled groups.
+	gob.Register(map[string]any{})
+	gob.Register([]any{})
+	gob.Register(json.Number(""))
+}
+
+// maxRuns bounds the spill files of a GroupBy. When it is reached they are
+// merged into one, so no more files are ever open at once.
+const maxRuns = 64
+
+type accKind int
+
+const (
+	accCount accKind = iota
+	accSum
+	accAvg
+	accMin
+	accMax
+	accDistinct
+)
+
+// Accumulator computes a field of the documents GroupBy outputs.
+type Accumulator struct {
+	name  string
+	field string
+	kind  accKind
+}
+
+// Count counts the documents of the group, as an int64.
+func Count(name string) Accumulator {
+	return Accumulator{name: name, kind: accCount}
+}
+
+// Sum adds up the numeric values of field. Other values are ignored.
+func Sum(name, field string) Accumulator {
+	return Accumulator{name: name, field: field, kind: accSum}
+}
+
+// Avg averages the numeric values of field, null when there are none.
+func Avg(name, field string) Accumulator {
+	return Accumulator{name: name, field: field, kind: accAvg}
+}
+
+// Min keeps the smallest value of field, in the order of Compare. Missing and
+// null values are ignored.
+func Min(name, field string) Accumulator {
+	return Accumulator{name: name, field: field, kind: accMin}
+}
+
+// Max keeps the largest value of field, in the order of Compare. Missing and
+// null values are ignored.
+func Max(name, field string) Accumulator {
+	return Accumulator{name: name, field: field, kind: accMax}
+}
+
+// Distinct collects the distinct values of field, sorted with Compare.
+// Missing values are ignored. Every distinct value is held until the group is
+// output, so fields with many values per group are better counted another way.
+func Distinct(name, field string) Accumulator {
+	return Accumulator{name: name, field: field, kind: accDistinct}
+}
+
+// GroupBy outputs one document per distinct combination of the values at keys,
+// holding those values at their paths and the result of each accumulator under
+// its name. Documents missing a key are grouped under null for it. Groups are
+// output once the input is exhausted, ordered by their key values as Sort
+// orders them. With no keys every document falls in a single group, which is
+// output even when the input is empty.
+//
+// Past Options.MaxGroups groups, the groups held in memory are written to a
+// temporary file, sorted by key, and merged back when the input is exhausted.
+// Values keep their Go types through the files, except values of types other
+// than those of decoded JSON and Go's basic types, which come back as decoded
+// JSON.
+func GroupBy(keys []string, accs ...Accumulator) Stage {
+	return Stage{build: func(opts Options, _ *Stage) stage {
+		return &groupStage{opts: opts, keys: keys, accs: accs, groups: map[string]*group{}}
+	}}
+}
+
+// group is the partial result of a group. It is what spill files hold, gob
+// encoded one after another.
+type group struct {
+	Key    string
+	Values []any
+	States []accState
+}
+
+type accState struct {
+	N   int64
+	Sum float64
+	Min any
+	Max any
+	Set map[string]any
+}
+
+type groupStage struct {
+	opts   Options
+	keys   []string
+	accs   []Accumulator
+	groups map[string]*group
+	runs   []string // names of the spill files
+}
+
+func (g *groupStage) push(doc map[string]any, _ func(map[string]any) error) error {
+	values := make([]any, len(g.keys))
+	var key strings.Builder
+	key.WriteByte('[')
+	for i, path := range g.keys {
+		values[i], _ = Get(doc, path)
+		if i > 0 {
+			key.WriteByte(',')
+		}
+		key.WriteString(encode(values[i]))
+	}
+	key.WriteByte(']')
+
+	grp, ok := g.groups[key.String()]
+	if !ok {
+		grp = &group{Key: key.String(), Values: values, States: make([]accState, len(g.accs))}
+		g.groups[grp.Key] = grp
+	}
+	for i, acc := range g.accs {
+		accumulate(acc, &grp.States[i], doc)
+	}
+
+	if g.opts.MaxGroups > 0 && len(g.groups) > g.opts.MaxGroups {
+		return g.spill()
+	}
+	return nil
+}
+
+func accumulate(acc Accumulator, st *accState, doc map[string]any) {
+	if acc.kind == accCount {
+		st.N++
+		return
+	}
+	v, ok := Get(doc, acc.field)
+	if !ok {
+		return
+	}
+	switch acc.kind {
+	case accSum, accAvg:
+		if f, ok := number(v); ok {
+			st.N++
+			st.Sum += f
+		}
+	case accMin:
+		if v != nil && (st.Min == nil || Compare(v, st.Min) < 0) {
+			st.Min = v
+		}
+	case accMax:
+		if v != nil && (st.Max == nil || Compare(v, st.Max) > 0) {
+			st.Max = v
+		}
+	case accDistinct:
+		if st.Set == nil {
+			st.Set = map[string]any{}
+		}
+		st.Set[encode(v)] = v
+	}
+}
+
+// merge folds the partial state src into st.
+func merge(acc Accumulator, st *accState, src accState) {
+	st.N += src.N
+	st.Sum += src.Sum
+	if src.Min != nil && (st.Min == nil || Compare(src.Min, st.Min) < 0) {
+		st.Min = src.Min
+	}
+	if src.Max != nil && (st.Max == nil || Compare(src.Max, st.Max) > 0) {
+		st.Max = src.Max
+	}
+	if acc.kind == accDistinct && len(src.Set) > 0 {
+		if st.Set == nil {
+			st.Set = map[string]any{}
+		}
+		for k, v := range src.Set {
+			st.Set[k] = v
+		}
+	}
+}
+
+// compareGroups orders groups by their key values, with Compare. Groups
+// whose values compare equal have the same key.
+func compareGroups(a, b *group) int {
+	for i := range a.Values {
+		if c := Compare(a.Values[i], b.Values[i]); c != 0 {
+			return c
+		}
+	}
+	return strings.Compare(a.Key, b.Key)
+}
+
+// sorted returns the groups held in memory, ordered by key.
+func (g *groupStage) sorted() []*group {
+	out := make([]*group, 0, len(g.groups))
+	for _, grp := range g.groups {
+		out = append(out, grp)
+	}
+	sort.Slice(out, func(i, j int) bool { return compareGroups(out[i], out[j]) < 0 })
+	return out
+}
+
+// spill writes the groups held in memory to a new run file, and merges the
+// run files into one once there are maxRuns of them.
+func (g *groupStage) spill() error {
+	groups := g.sorted()
+	clear(g.groups)
+	err := g.writeRun(func(write func(*group) error) error {
+		for _, grp := range groups {
+			if err := write(grp); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil || len(g.runs) < maxRuns {
+		return err
+	}
+	merged := len(g.runs)
+	if err := g.writeRun(func(write func(*group) error) error {
+		return g.mergeRuns(g.runs[:merged], write)
+	}); err != nil {
+		return err
+	}
+	for _, name := range g.runs[:merged] {
+		os.Remove(name)
+	}
+	g.runs = append(g.runs[:0], g.runs[merged:]...)
+	return nil
+}
+
+// writeRun creates a run file holding the groups fill writes, which must come
+// in order. The file is closed before writeRun returns.
+func (g *groupStage) writeRun(fill func(write func(*group) error) error) error {
+	f, err := os.CreateTemp(g.opts.TempDir, "agg-*.gob")
+	if err != nil {
+		return fmt.Errorf("spill groups: %w", err)
+	}
+	g.runs = append(g.runs, f.Name())
+	w := bufio.NewWriter(f)
+	enc := gob.NewEncoder(w)
+	err = fill(func(grp *group) error {
+		return enc.Encode(spillable(grp))
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("spill groups: %w", err)
+	}
+	return nil
+}
+
+func (g *groupStage) flush(emit func(map[string]any) error) error {
+	if len(g.runs) == 0 {
+		groups := g.sorted()
+		if len(groups) == 0 && len(g.keys) == 0 {
+			groups = append(groups, &group{States: make([]accState, len(g.accs))})
+		}
+		for _, grp := range groups {
+			if err := emit(g.output(grp)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(g.groups) > 0 {
+		if err := g.spill(); err != nil {
+			return err
+		}
+	}
+	return g.mergeRuns(g.runs, func(grp *group) error {
+		return emit(g.output(grp))
+	})
+}
+
+// mergeRuns merges the sorted run files called names, combining the partial
+// states of the groups found in several of them, and passes the groups to fn
+// in order.
+func (g *groupStage) mergeRuns(names []string, fn func(*group) error) error {
+	var h runHeap
+	for _, name := range names {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("merge groups: %w", err)
+		}
+		defer f.Close()
+		r := &run{dec: gob.NewDecoder(bufio.NewReader(f))}
+		ok, err := r.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			h = append(h, r)
+		}
+	}
+	heap.Init(&h)
+	for len(h) > 0 {
+		cur := h[0].cur
+		for len(h) > 0 && h[0].cur.Key == cur.Key {
+			r := h[0]
+			if r.cur != cur {
+				for i, acc := range g.accs {
+					merge(acc, &cur.States[i], r.cur.States[i])
+				}
+			}
+			ok, err := r.next()
+			if err != nil {
+				return err
+			}
+			if ok {
+				heap.Fix(&h, 0)
+			} else {
+				heap.Pop(&h)
+			}
+		}
+		if err := fn(cur); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanup removes the run files.
+func (g *groupStage) cleanup() {
+	for _, name := range g.runs {
+		os.Remove(name)
+	}
+	g.runs = nil
+}
+
+// spillable returns grp with the values gob cannot encode replaced by their
+// decoded JSON.
+func spillable(grp *group) *group {
+	out := &group{Key: grp.Key, Values: make([]any, len(grp.Values)), States: make([]accState, len(grp.States))}
+	for i, v := range grp.Values {
+		out.Values[i] = gobValue(v)
+	}
+	for i, st := range grp.States {
+		st.Min, st.Max = gobValue(st.Min), gobValue(st.Max)
+		if st.Set != nil {
+			set := make(map[string]any, len(st.Set))
+			for k, v := range st.Set {
+				set[k] = gobValue(v)
+			}
+			st.Set = set
+		}
+		out.States[i] = st
+	}
+	return out
+}
+
+func gobValue(v any) any {
+	switch v := v.(type) {
+	case nil, bool, string, json.Number,
+		int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return v
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, x := range v {
+			out[k] = gobValue(x)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, x := range v {
+			out[i] = gobValue(x)
+		}
+		return out
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	var out any
+	json.Unmarshal(data, &out)
+	return out
+}
+
+func (g *groupStage) output(grp *group) map[string]any {
+	out := make(map[string]any, len(g.keys)+len(g.accs))
+	for i, path := range g.keys {
+		set(out, path, grp.Values[i])
+	}
+	for i, acc := range g.accs {
+		st := grp.States[i]
+		switch acc.kind {
+		case accCount:
+			out[acc.name] = st.N
+		case accSum:
+			out[acc.name] = st.Sum
+		case accAvg:
+			if st.N == 0 {
+				out[acc.name] = nil
+			} else {
+				out[acc.name] = st.Sum / float64(st.N)
+			}
+		case accMin:
+			out[acc.name] = st.Min
+		case accMax:
+			out[acc.name] = st.Max
+		case accDistinct:
+			values := make([]any, 0, len(st.Set))
+			for _, v := range st.Set {
+				values = append(values, v)
+			}
+			sort.Slice(values, func(i, j int) bool { return Compare(values[i], values[j]) < 0 })
+			out[acc.name] = values
+		}
+	}
+	return out
+}
+
+// run reads the groups of a spill file in order.
+type run struct {
+	dec *gob.Decoder
+	cur *group
+}
+
+func (r *run) next() (bool, error) {
+	var grp group
+	if err := r.dec.Decode(&grp); err != nil {
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+		return false, fmt.Errorf("merge groups: %w", err)
+	}
+	r.cur = &grp
+	return true, nil
+}
+
+type runHeap []*run
+
+func (h runHeap) Len() int           { return len(h) }
+func (h runHeap) Less(i, j int) bool { return compareGroups(h[i].cur, h[j].cur) < 0 }
+func (h runHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *runHeap) Push(x any)        { *h = append(*h, x.(*run)) }
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
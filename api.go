@@ -0,0 +1,35 @@
+package inceptiondb
+
+import (
+	"context"
+	"io"
+)
+
+// API is the set of operations offered by Client. Depend on it instead of
+// *Client to swap in a ShardedClient or a mock (see the inceptiondbmock
+// package) in tests.
+type API interface {
+	ListCollections(ctx context.Context) ([]Collection, error)
+	CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*Collection, error)
+	GetCollection(ctx context.Context, collection string) (*Collection, error)
+	DropCollection(ctx context.Context, collection string) error
+	SetDefaults(ctx context.Context, collection string, defaults map[string]any) (map[string]any, error)
+
+	ListIndexes(ctx context.Context, collection string) ([]Index, error)
+	CreateIndex(ctx context.Context, collection string, req *CreateIndexRequest) (*Index, error)
+	GetIndex(ctx context.Context, collection, name string) (*Index, error)
+	DropIndex(ctx context.Context, collection, name string) error
+
+	Size(ctx context.Context, collection string) (map[string]any, error)
+
+	InsertStream(ctx context.Context, collection string, reader io.Reader) (*JSONStream, error)
+	InsertDocuments(ctx context.Context, collection string, documents ...any) (*JSONStream, error)
+	Find(ctx context.Context, collection string, req *FindRequest) (*JSONStream, error)
+	Patch(ctx context.Context, collection string, req *PatchRequest) (*JSONStream, error)
+	Remove(ctx context.Context, collection string, req *RemoveRequest) (*JSONStream, error)
+}
+
+var (
+	_ API = (*Client)(nil)
+	_ API = (*ShardedClient)(nil)
+)
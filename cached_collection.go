@@ -0,0 +1,377 @@
+package inceptiondb
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDocumentNotFound is returned by CachedCollection.Get when no document
+// matches the key.
+var ErrDocumentNotFound = errors.New("inceptiondb: document not found")
+
+// CacheOptions configures a CachedCollection.
+type CacheOptions struct {
+	// Index is the name of the unique map index used for lookups.
+	Index string
+	// Field is the document field covered by Index.
+	Field string
+	// Size is the maximum number of cached documents. Defaults to 1000.
+	Size int
+	// TTL is how long a document is served from the cache. Zero means
+	// entries only leave the cache when evicted or invalidated.
+	TTL time.Duration
+}
+
+// CacheStats holds the counters of a CachedCollection.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+}
+
+// CachedCollection serves single-key lookups through a unique index from an
+// in-process LRU cache. Documents flowing through its Find and InsertDocuments
+// streams populate the cache, and documents streamed back by Patch and Remove
+// are invalidated. Writes made by other clients are only noticed once entries
+// expire.
+type CachedCollection struct {
+	client     *Client
+	collection string
+	opts       CacheOptions
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+
+	mu      sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+	// gen counts invalidations. A document read by a request is only stored
+	// if its key was not invalidated since the request started, so a slow
+	// read cannot bring back a document invalidated meanwhile.
+	gen uint64
+	// invalidated holds the generation of the last invalidation of each
+	// key. Requests started before floor store nothing: it is raised by
+	// Purge and when invalidated is cleared to bound its size.
+	invalidated map[string]uint64
+	floor       uint64
+
+	flightMu sync.Mutex
+	flights  map[string]*cacheFlight
+}
+
+type cacheEntry struct {
+	key     string
+	doc     json.RawMessage
+	expires time.Time
+}
+
+type cacheFlight struct {
+	done chan struct{}
+	doc  json.RawMessage
+	err  error
+	// canceled is set when the load failed because the context of the
+	// caller making it was done, which says nothing to the other callers.
+	canceled bool
+}
+
+// NewCachedCollection wraps collection with a document cache.
+func (c *Client) NewCachedCollection(collection string, opts CacheOptions) (*CachedCollection, error) {
+	if opts.Index == "" {
+		return nil, errors.New("cache index is required")
+	}
+	if opts.Field == "" {
+		return nil, errors.New("cache field is required")
+	}
+	if opts.Size <= 0 {
+		opts.Size = 1000
+	}
+	return &CachedCollection{
+		client:      c,
+		collection:  collection,
+		opts:        opts,
+		lru:         list.New(),
+		entries:     map[string]*list.Element{},
+		invalidated: map[string]uint64{},
+		flights:     map[string]*cacheFlight{},
+	}, nil
+}
+
+// Get decodes the document whose indexed field equals key into dest, with the
+// codec of the client. Misses are fetched with a unique lookup and concurrent
+// misses for the same key share a single request.
+func (cc *CachedCollection) Get(ctx context.Context, key string, dest any) error {
+	if doc, ok := cc.lookup(key); ok {
+		cc.hits.Add(1)
+		return unmarshal(cc.client.codec, doc, dest)
+	}
+	cc.misses.Add(1)
+
+	doc, err := cc.fetch(ctx, key)
+	if err != nil {
+		return err
+	}
+	return unmarshal(cc.client.codec, doc, dest)
+}
+
+// Find runs the query and caches every document read from the returned
+// stream.
+func (cc *CachedCollection) Find(ctx context.Context, req *FindRequest) (*JSONStream, error) {
+	gen := cc.generation()
+	stream, err := cc.client.Find(ctx, cc.collection, req)
+	if err != nil {
+		return nil, err
+	}
+	stream.observe = func(doc json.RawMessage) { cc.store(doc, gen) }
+	return stream, nil
+}
+
+// InsertDocuments inserts the documents and caches every inserted document
+// read from the returned stream.
+func (cc *CachedCollection) InsertDocuments(ctx context.Context, documents ...any) (*JSONStream, error) {
+	gen := cc.generation()
+	stream, err := cc.client.InsertDocuments(ctx, cc.collection, documents...)
+	if err != nil {
+		return nil, err
+	}
+	stream.observe = func(doc json.RawMessage) { cc.store(doc, gen) }
+	return stream, nil
+}
+
+// Patch applies the patch and invalidates every document read from the
+// returned stream, under the keys they had before and after it. Keys whose
+// documents are never read stay cached, so the stream should be consumed.
+//
+// The key a document had before the patch is known when the request looks it
+// up by key, through the index or a filter on the field. Otherwise a patch
+// that changes the field clears the whole cache.
+func (cc *CachedCollection) Patch(ctx context.Context, req *PatchRequest) (*JSONStream, error) {
+	if req != nil {
+		if key, ok := cc.requestKey(req.QueryOptions); ok {
+			cc.Invalidate(key)
+		} else if patchSetsField(req.Patch, cc.opts.Field) {
+			cc.Purge()
+		}
+	}
+	stream, err := cc.client.Patch(ctx, cc.collection, req)
+	if err != nil {
+		return nil, err
+	}
+	stream.observe = cc.invalidateDocument
+	return stream, nil
+}
+
+// Remove deletes the matched documents and invalidates every document read
+// from the returned stream.
+func (cc *CachedCollection) Remove(ctx context.Context, req *RemoveRequest) (*JSONStream, error) {
+	stream, err := cc.client.Remove(ctx, cc.collection, req)
+	if err != nil {
+		return nil, err
+	}
+	stream.observe = cc.invalidateDocument
+	return stream, nil
+}
+
+// Invalidate drops key from the cache.
+func (cc *CachedCollection) Invalidate(key string) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.gen++
+	cc.invalidated[key] = cc.gen
+	if len(cc.invalidated) > cc.opts.Size {
+		cc.floor = cc.gen
+		clear(cc.invalidated)
+	}
+	if elem, ok := cc.entries[key]; ok {
+		cc.lru.Remove(elem)
+		delete(cc.entries, key)
+	}
+}
+
+// Purge drops every document from the cache.
+func (cc *CachedCollection) Purge() {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	cc.gen++
+	cc.floor = cc.gen
+	clear(cc.invalidated)
+	cc.lru.Init()
+	clear(cc.entries)
+}
+
+// Len returns the number of cached documents.
+func (cc *CachedCollection) Len() int {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.lru.Len()
+}
+
+// Stats returns the cache counters.
+func (cc *CachedCollection) Stats() CacheStats {
+	return CacheStats{
+		Hits:      cc.hits.Load(),
+		Misses:    cc.misses.Load(),
+		Evictions: cc.evictions.Load(),
+	}
+}
+
+func (cc *CachedCollection) fetch(ctx context.Context, key string) (json.RawMessage, error) {
+	for {
+		cc.flightMu.Lock()
+		f, ok := cc.flights[key]
+		if !ok {
+			break
+		}
+		cc.flightMu.Unlock()
+		select {
+		case <-f.done:
+			if f.canceled && ctx.Err() == nil {
+				// The caller that made the request gave up; try again.
+				continue
+			}
+			return f.doc, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &cacheFlight{done: make(chan struct{})}
+	cc.flights[key] = f
+	cc.flightMu.Unlock()
+
+	gen := cc.generation()
+	f.doc, f.err = cc.load(ctx, key)
+	if f.err == nil {
+		cc.store(f.doc, gen)
+	} else {
+		f.canceled = ctx.Err() != nil
+	}
+
+	cc.flightMu.Lock()
+	delete(cc.flights, key)
+	cc.flightMu.Unlock()
+	close(f.done)
+	return f.doc, f.err
+}
+
+func (cc *CachedCollection) load(ctx context.Context, key string) (json.RawMessage, error) {
+	stream, err := cc.client.Find(ctx, cc.collection, &FindRequest{QueryOptions: QueryOptions{
+		Mode:  "unique",
+		Index: cc.opts.Index,
+		Value: key,
+	}})
+	if err != nil {
+		return nil, err
+	}
+	defer stream.Close()
+	var doc json.RawMessage
+	if err := stream.Next(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, ErrDocumentNotFound
+		}
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (cc *CachedCollection) lookup(key string) (json.RawMessage, bool) {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	elem, ok := cc.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		cc.lru.Remove(elem)
+		delete(cc.entries, key)
+		return nil, false
+	}
+	cc.lru.MoveToFront(elem)
+	return entry.doc, true
+}
+
+func (cc *CachedCollection) generation() uint64 {
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	return cc.gen
+}
+
+// store caches doc, read by a request started at generation gen, unless its
+// key was invalidated since.
+func (cc *CachedCollection) store(doc json.RawMessage, gen uint64) {
+	key, ok := cc.documentKey(doc)
+	if !ok {
+		return
+	}
+	entry := &cacheEntry{key: key, doc: append(json.RawMessage(nil), doc...)}
+	if cc.opts.TTL > 0 {
+		entry.expires = time.Now().Add(cc.opts.TTL)
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	if gen < cc.floor || cc.invalidated[key] > gen {
+		return
+	}
+	if elem, ok := cc.entries[key]; ok {
+		elem.Value = entry
+		cc.lru.MoveToFront(elem)
+		return
+	}
+	cc.entries[key] = cc.lru.PushFront(entry)
+	for cc.lru.Len() > cc.opts.Size {
+		oldest := cc.lru.Back()
+		cc.lru.Remove(oldest)
+		delete(cc.entries, oldest.Value.(*cacheEntry).key)
+		cc.evictions.Add(1)
+	}
+}
+
+func (cc *CachedCollection) invalidateDocument(doc json.RawMessage) {
+	if key, ok := cc.documentKey(doc); ok {
+		cc.Invalidate(key)
+	}
+}
+
+// requestKey returns the key a request looks up, through the index or a
+// filter on the field.
+func (cc *CachedCollection) requestKey(query QueryOptions) (string, bool) {
+	if query.Index == cc.opts.Index && query.Value != "" {
+		return query.Value, true
+	}
+	value, ok := query.Filter[cc.opts.Field]
+	if !ok {
+		return "", false
+	}
+	if s, ok := value.(string); ok {
+		return s, true
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+func (cc *CachedCollection) documentKey(doc json.RawMessage) (string, bool) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return "", false
+	}
+	raw, ok := fields[cc.opts.Field]
+	if !ok {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	return strings.TrimSpace(string(raw)), true
+}
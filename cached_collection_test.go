@@ -0,0 +1,211 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCachedCollection(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["users"] = []map[string]any{
+		{"id": "1", "name": "Ana"},
+		{"id": "2", "name": "Bea"},
+	}
+
+	users, err := client.NewCachedCollection("users", CacheOptions{Index: "id", Field: "id", Size: 1})
+	if err != nil {
+		t.Fatalf("NewCachedCollection() error = %v", err)
+	}
+
+	var user struct{ Name string }
+	for i := 0; i < 2; i++ {
+		if err := users.Get(ctx, "1", &user); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+	}
+	if user.Name != "Ana" || server.requests != 1 {
+		t.Fatalf("Get() = %q after %d requests, want Ana after 1", user.Name, server.requests)
+	}
+
+	stream, err := users.Patch(ctx, &PatchRequest{
+		QueryOptions: QueryOptions{Filter: map[string]any{"id": "1"}},
+		Patch:        map[string]any{"name": "Ada"},
+	})
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Patch() stream error = %v", err)
+	}
+	if users.Len() != 0 {
+		t.Fatalf("Len() = %d after patch, want 0", users.Len())
+	}
+	if err := users.Get(ctx, "1", &user); err != nil || user.Name != "Ada" {
+		t.Fatalf("Get() = %q, %v; want Ada", user.Name, err)
+	}
+
+	if err := users.Get(ctx, "2", &user); err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if stats := users.Stats(); stats.Hits != 1 || stats.Misses != 3 || stats.Evictions != 1 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+
+	if err := users.Get(ctx, "3", &user); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("Get() error = %v, want ErrDocumentNotFound", err)
+	}
+}
+
+func TestCachedCollectionPatchedKey(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["users"] = []map[string]any{
+		{"id": "1", "name": "Ana"},
+		{"id": "2", "name": "Bea"},
+	}
+	users, err := client.NewCachedCollection("users", CacheOptions{Index: "id", Field: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var user struct{ Name string }
+	for _, key := range []string{"1", "2"} {
+		if err := users.Get(ctx, key, &user); err != nil {
+			t.Fatalf("Get(%s) error = %v", key, err)
+		}
+	}
+
+	// The old key of a document looked up by key is invalidated too.
+	stream, err := users.Patch(ctx, &PatchRequest{
+		QueryOptions: QueryOptions{Filter: map[string]any{"id": "1"}},
+		Patch:        map[string]any{"id": "9"},
+	})
+	if err == nil {
+		_, err = collectRaw(stream)
+	}
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := users.Get(ctx, "1", &user); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("Get(1) error = %v, want ErrDocumentNotFound", err)
+	}
+
+	// Otherwise a patch changing keys clears the cache.
+	stream, err = users.Patch(ctx, &PatchRequest{
+		QueryOptions: QueryOptions{Filter: map[string]any{"name": "Bea"}},
+		Patch:        map[string]any{"id": "8"},
+	})
+	if err == nil {
+		_, err = collectRaw(stream)
+	}
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := users.Get(ctx, "2", &user); !errors.Is(err, ErrDocumentNotFound) {
+		t.Fatalf("Get(2) error = %v, want ErrDocumentNotFound", err)
+	}
+}
+
+func TestCachedCollectionSkipsStaleReads(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["users"] = []map[string]any{{"id": "1", "name": "Ana"}, {"id": "2", "name": "Bo"}}
+	users, err := client.NewCachedCollection("users", CacheOptions{Index: "id", Field: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := users.Find(ctx, nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	// An invalidation while the read is in flight keeps the document it
+	// returns for that key out of the cache, and only that one.
+	users.Invalidate("1")
+	users.Invalidate("3")
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Find() stream error = %v", err)
+	}
+	if users.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1", users.Len())
+	}
+	if _, ok := users.lookup("2"); !ok {
+		t.Fatal("document 2 was not cached after an unrelated invalidation")
+	}
+}
+
+func TestCachedCollectionUsesCodec(t *testing.T) {
+	server, _ := newMemoryServer(t)
+	server.collections["users"] = []map[string]any{{"id": "1", "visits": float64(3)}}
+	client, err := NewClient(server.url, WithCodec(JSONCodec{UseNumber: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := client.NewCachedCollection("users", CacheOptions{Index: "id", Field: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		var doc map[string]any
+		if err := users.Get(context.Background(), "1", &doc); err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		if doc["visits"] != json.Number("3") {
+			t.Fatalf("visits = %#v, want json.Number", doc["visits"])
+		}
+	}
+}
+
+func TestCachedCollectionLeaderCancel(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			close(started)
+			select {
+			case <-r.Context().Done():
+			case <-release:
+			}
+			return
+		}
+		w.Write([]byte(`{"id":"1","name":"Ana"}` + "\n"))
+	}))
+	defer srv.Close()
+	defer close(release)
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	users, err := client.NewCachedCollection("users", CacheOptions{Index: "id", Field: "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaderCtx, cancel := context.WithCancel(context.Background())
+	leaderErr := make(chan error, 1)
+	go func() {
+		var user map[string]any
+		leaderErr <- users.Get(leaderCtx, "1", &user)
+	}()
+	<-started
+	waiterErr := make(chan error, 1)
+	var user struct{ Name string }
+	go func() {
+		waiterErr <- users.Get(context.Background(), "1", &user)
+	}()
+	time.Sleep(20 * time.Millisecond) // let the waiter join the request
+	cancel()
+
+	if err := <-leaderErr; !errors.Is(err, context.Canceled) {
+		t.Fatalf("leader Get() error = %v, want context.Canceled", err)
+	}
+	if err := <-waiterErr; err != nil || user.Name != "Ana" {
+		t.Fatalf("waiter Get() = %q, %v; want Ana", user.Name, err)
+	}
+}
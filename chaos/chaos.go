@@ -0,0 +1,336 @@
+// Package chaos provides an http.RoundTripper that injects faults into the
+// requests of an inceptiondb.Client, to exercise retry and timeout handling.
+//
+//	transport := chaos.New(http.DefaultTransport,
+//		chaos.WithSeed(42),
+//		chaos.WithFault("find", chaos.Fault{ErrorRate: 0.2, TruncateAfter: 10}),
+//		chaos.WithFault(chaos.AnyOperation, chaos.Fault{Latency: 50 * time.Millisecond}),
+//	)
+//	client, err := inceptiondb.NewClient(baseURL,
+//		inceptiondb.WithHTTPClient(&http.Client{Transport: transport}))
+//
+// Operations are named as in inceptiondb.Operation: "listCollections",
+// "createCollection", "getCollection", or the action of the request such as
+// "find", "insert" or "dropIndex".
+package chaos
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+
+	"inceptiondb"
+)
+
+// AnyOperation configures the fault applied to operations without a fault of
+// their own.
+const AnyOperation = "*"
+
+// Fault describes the faults injected into the requests of an operation.
+// Rates are probabilities between 0 and 1, drawn independently per request.
+type Fault struct {
+	// Latency is added before the request is sent, plus a random duration up
+	// to Jitter.
+	Latency time.Duration
+	Jitter  time.Duration
+
+	// ResetRate is the probability of failing the request with a connection
+	// reset. With ResetAfterSend the request reaches the server first, so a
+	// write may have been applied although the client sees an error.
+	ResetRate      float64
+	ResetAfterSend bool
+
+	// ErrorRate is the probability of answering, without reaching the server,
+	// with Status (503 by default) and an {"error":{...}} body holding Message.
+	ErrorRate float64
+	Status    int
+	Message   string
+
+	// TruncateAfter cuts JSON Lines responses after that many items, ending
+	// the body with io.ErrUnexpectedEOF as a dropped connection would.
+	// TruncateRate is the probability of doing so and defaults to 1. Gzip
+	// responses are decoded first, so the cut still falls between items;
+	// responses with other content encodings are not truncated.
+	TruncateAfter int
+	TruncateRate  float64
+}
+
+// Stats counts the faults injected so far.
+type Stats struct {
+	Requests    int
+	Delayed     int
+	Resets      int
+	Errors      int
+	Truncations int
+}
+
+// Option configures a Transport.
+type Option func(*Transport)
+
+// WithSeed makes the random decisions reproducible. Without it the seed is
+// random.
+func WithSeed(seed uint64) Option {
+	return func(t *Transport) {
+		t.rand = rand.New(rand.NewPCG(seed, seed))
+	}
+}
+
+// WithFault sets the fault injected into requests of operation op, or of
+// every other operation when op is AnyOperation.
+func WithFault(op string, f Fault) Option {
+	return func(t *Transport) {
+		t.faults[op] = f
+	}
+}
+
+// Transport is an http.RoundTripper injecting faults into the requests it
+// forwards.
+type Transport struct {
+	base   http.RoundTripper
+	faults map[string]Fault
+
+	mu    sync.Mutex
+	rand  *rand.Rand
+	stats Stats
+}
+
+// New returns a transport forwarding to base, http.DefaultTransport when nil.
+func New(base http.RoundTripper, opts ...Option) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	t := &Transport{
+		base:   base,
+		faults: map[string]Fault{},
+		rand:   rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64())),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Stats returns the number of faults injected so far.
+func (t *Transport) Stats() Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.stats
+}
+
+// decision holds the faults drawn for one request. Drawing them all up front,
+// in a fixed order, keeps a seeded run reproducible.
+type decision struct {
+	delay    time.Duration
+	reset    bool
+	fail     bool
+	truncate bool
+}
+
+func (t *Transport) decide(f Fault) decision {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.stats.Requests++
+	var d decision
+	d.delay = f.Latency
+	if f.Jitter > 0 {
+		d.delay += time.Duration(t.rand.Int64N(int64(f.Jitter)))
+	}
+	d.reset = f.ResetRate > 0 && t.rand.Float64() < f.ResetRate
+	d.fail = !d.reset && f.ErrorRate > 0 && t.rand.Float64() < f.ErrorRate
+	if f.TruncateAfter > 0 {
+		rate := f.TruncateRate
+		if rate == 0 {
+			rate = 1
+		}
+		d.truncate = t.rand.Float64() < rate
+	}
+
+	if d.delay > 0 {
+		t.stats.Delayed++
+	}
+	if d.reset {
+		t.stats.Resets++
+	}
+	if d.fail {
+		t.stats.Errors++
+	}
+	return d
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	op, _ := inceptiondb.Operation(req)
+	f, ok := t.faults[op]
+	if !ok {
+		f, ok = t.faults[AnyOperation]
+	}
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	d := t.decide(f)
+	if d.delay > 0 {
+		timer := time.NewTimer(d.delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			closeBody(req)
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+
+	if d.reset && !f.ResetAfterSend {
+		closeBody(req)
+		return nil, resetError(req)
+	}
+	if d.fail {
+		closeBody(req)
+		return errorResponse(req, f), nil
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if d.reset {
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return nil, resetError(req)
+	}
+	if d.truncate && resp.StatusCode < http.StatusBadRequest {
+		body, ok := plainBody(resp)
+		if !ok {
+			return resp, nil
+		}
+		resp.Body = &truncatedBody{ReadCloser: body, remaining: f.TruncateAfter, onCut: func() {
+			t.mu.Lock()
+			t.stats.Truncations++
+			t.mu.Unlock()
+		}}
+		resp.ContentLength = -1
+	}
+	return resp, nil
+}
+
+func closeBody(req *http.Request) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+}
+
+func resetError(req *http.Request) error {
+	return &net.OpError{
+		Op:   "read",
+		Net:  "tcp",
+		Addr: fakeAddr(req.URL.Host),
+		Err:  os.NewSyscallError("read", syscall.ECONNRESET),
+	}
+}
+
+type fakeAddr string
+
+func (a fakeAddr) Network() string { return "tcp" }
+func (a fakeAddr) String() string  { return string(a) }
+
+func errorResponse(req *http.Request, f Fault) *http.Response {
+	status := f.Status
+	if status == 0 {
+		status = http.StatusServiceUnavailable
+	}
+	message := f.Message
+	if message == "" {
+		message = "injected fault"
+	}
+	var payload struct {
+		Error struct {
+			Message     string `json:"message"`
+			Description string `json:"description"`
+		} `json:"error"`
+	}
+	payload.Error.Message = message
+	payload.Error.Description = "chaos transport"
+	data, _ := json.Marshal(payload)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header{"Content-Type": []string{"application/json"}},
+		Body:          io.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
+
+// plainBody returns the body of resp without its gzip content encoding, so
+// truncation counts items rather than compressed bytes. Other encodings
+// cannot be decoded here and their responses are not truncated.
+func plainBody(resp *http.Response) (io.ReadCloser, bool) {
+	switch resp.Header.Get("Content-Encoding") {
+	case "":
+		return resp.Body, true
+	case "gzip":
+		resp.Header.Del("Content-Encoding")
+		resp.Uncompressed = true
+		return &gunzipBody{ReadCloser: resp.Body}, true
+	}
+	return nil, false
+}
+
+// gunzipBody decodes a gzip body, reading its header on the first Read.
+type gunzipBody struct {
+	io.ReadCloser
+	zr  *gzip.Reader
+	err error
+}
+
+func (b *gunzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.ReadCloser)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+// truncatedBody passes through the first remaining lines of a JSON Lines body
+// and then fails.
+type truncatedBody struct {
+	io.ReadCloser
+	remaining int
+	cut       bool
+	onCut     func()
+}
+
+func (b *truncatedBody) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		if !b.cut {
+			b.cut = true
+			b.onCut()
+		}
+		return 0, io.ErrUnexpectedEOF
+	}
+	n, err := b.ReadCloser.Read(p)
+	for i := 0; i < n; i++ {
+		if p[i] != '\n' {
+			continue
+		}
+		b.remaining--
+		if b.remaining == 0 {
+			return i + 1, nil
+		}
+	}
+	return n, err
+}
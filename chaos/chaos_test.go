@@ -0,0 +1,171 @@
+package chaos
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"inceptiondb"
+)
+
+func newServer(t *testing.T, hits *atomic.Int64) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		for i := 1; i <= 5; i++ {
+			fmt.Fprintf(w, "{\"id\":%d}\n", i)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func newClient(t *testing.T, url string, transport http.RoundTripper) *inceptiondb.Client {
+	t.Helper()
+	client, err := inceptiondb.NewClient(url, inceptiondb.WithHTTPClient(&http.Client{Transport: transport}))
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	return client
+}
+
+func TestTruncateAndErrors(t *testing.T) {
+	var hits atomic.Int64
+	server := newServer(t, &hits)
+	transport := New(server.Client().Transport,
+		WithFault("find", Fault{TruncateAfter: 2}),
+		WithFault("dropCollection", Fault{ErrorRate: 1, Status: http.StatusBadGateway, Message: "upstream down"}),
+	)
+	client := newClient(t, server.URL, transport)
+	ctx := context.Background()
+
+	stream, err := client.Find(ctx, "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	var ids []int
+	err = inceptiondb.Iterate(stream, func(doc *struct{ ID int }) error {
+		ids = append(ids, doc.ID)
+		return nil
+	})
+	if !errors.Is(err, io.ErrUnexpectedEOF) || len(ids) != 2 {
+		t.Fatalf("Iterate() = %v, %v; want 2 items and io.ErrUnexpectedEOF", ids, err)
+	}
+
+	err = client.DropCollection(ctx, "items")
+	var apiErr *inceptiondb.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadGateway || apiErr.Message != "upstream down" {
+		t.Fatalf("DropCollection() error = %v", err)
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("server hits = %d, want 1", hits.Load())
+	}
+	if stats := transport.Stats(); stats.Truncations != 1 || stats.Errors != 1 || stats.Requests != 2 {
+		t.Fatalf("Stats() = %+v", stats)
+	}
+
+	// Operations without a fault are forwarded untouched.
+	if _, err := client.ListCollections(ctx); err == nil {
+		t.Fatal("ListCollections() decoded a JSON Lines body without error")
+	}
+	if transport.Stats().Requests != 2 {
+		t.Fatalf("Stats().Requests = %d, want 2", transport.Stats().Requests)
+	}
+}
+
+func TestTruncateCompressed(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		for i := 1; i <= 500; i++ {
+			fmt.Fprintf(zw, "{\"id\":%d}\n", i)
+		}
+		zw.Close()
+	}))
+	defer server.Close()
+	transport := New(server.Client().Transport, WithFault("find", Fault{TruncateAfter: 200}))
+	client, err := inceptiondb.NewClient(server.URL,
+		inceptiondb.WithHTTPClient(&http.Client{Transport: transport}),
+		inceptiondb.WithCompression(),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+
+	stream, err := client.Find(context.Background(), "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	var ids []int
+	err = inceptiondb.Iterate(stream, func(doc *struct{ ID int }) error {
+		ids = append(ids, doc.ID)
+		return nil
+	})
+	// The cut falls after 200 items, not inside the compressed stream.
+	if !errors.Is(err, io.ErrUnexpectedEOF) || len(ids) != 200 {
+		t.Fatalf("Iterate() read %d items, %v; want 200 items and io.ErrUnexpectedEOF", len(ids), err)
+	}
+}
+
+func TestResetAndLatency(t *testing.T) {
+	var hits atomic.Int64
+	server := newServer(t, &hits)
+	transport := New(server.Client().Transport,
+		WithFault(AnyOperation, Fault{ResetRate: 1, ResetAfterSend: true, Latency: 20 * time.Millisecond}),
+	)
+	client := newClient(t, server.URL, transport)
+
+	start := time.Now()
+	_, err := client.Find(context.Background(), "items", nil)
+	if !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("Find() error = %v, want ECONNRESET", err)
+	}
+	if time.Since(start) < 20*time.Millisecond {
+		t.Fatal("latency was not injected")
+	}
+	if hits.Load() != 1 {
+		t.Fatalf("ResetAfterSend did not reach the server")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := client.Find(ctx, "items", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Find() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestSeedIsDeterministic(t *testing.T) {
+	run := func() []bool {
+		transport := New(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: http.NoBody, Request: req}, nil
+		}), WithSeed(7), WithFault("find", Fault{ErrorRate: 0.5}))
+		var out []bool
+		for i := 0; i < 32; i++ {
+			req, _ := http.NewRequest(http.MethodPost, "http://db/v1/collections/items:find", nil)
+			resp, err := transport.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("RoundTrip() error = %v", err)
+			}
+			out = append(out, resp.StatusCode == http.StatusServiceUnavailable)
+		}
+		return out
+	}
+	a, b := run(), run()
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Fatalf("seeded runs differ:\n%v\n%v", a, b)
+	}
+}
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
@@ -11,12 +11,35 @@ import (
 	"net/url"
 	"reflect"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"inceptiondb/schema"
 )
 
 // Client is a high level HTTP client for the InceptionDB REST API.
 type Client struct {
-	baseURL    *url.URL
+	endpoints  []*endpoint
 	httpClient *http.Client
+	metadata   *metadataCache
+	logger     *requestLogger
+	metrics    Recorder
+	tracer     Tracer
+	timings    bool
+	onTimings  func(Timings)
+	outbox     atomic.Pointer[Outbox]
+
+	compression bool
+	codec       Codec
+	schemas     map[string]*schema.Schema
+
+	extraEndpoints []Endpoint
+	nextFollower   atomic.Uint32
+	healthInterval time.Duration
+	stopHealth     chan struct{}
+	healthWG       sync.WaitGroup
+	closeOnce      sync.Once
 }
 
 // Option configures a Client instance.
@@ -31,23 +54,13 @@ func WithHTTPClient(h *http.Client) Option {
 
 // NewClient creates a new Client pointing to the provided base URL.
 func NewClient(baseURL string, opts ...Option) (*Client, error) {
-	if strings.TrimSpace(baseURL) == "" {
-		return nil, errors.New("base URL is required")
-	}
-
-	parsed, err := url.Parse(baseURL)
+	parsed, err := parseBaseURL(baseURL)
 	if err != nil {
-		return nil, fmt.Errorf("parse base url: %w", err)
-	}
-	if parsed.Scheme == "" {
-		return nil, errors.New("base URL must include the scheme (http or https)")
-	}
-	if parsed.Host == "" {
-		return nil, errors.New("base URL must include the host")
+		return nil, err
 	}
 
 	c := &Client{
-		baseURL:    parsed,
+		endpoints:  []*endpoint{newEndpoint(parsed, RolePrimary)},
 		httpClient: http.DefaultClient,
 	}
 	for _, opt := range opts {
@@ -58,6 +71,17 @@ func NewClient(baseURL string, opts ...Option) (*Client, error) {
 	if c.httpClient == nil {
 		c.httpClient = http.DefaultClient
 	}
+	if c.codec == nil {
+		c.codec = JSONCodec{}
+	}
+	for _, ep := range c.extraEndpoints {
+		parsed, err := parseBaseURL(ep.URL)
+		if err != nil {
+			return nil, fmt.Errorf("endpoint %q: %w", ep.URL, err)
+		}
+		c.endpoints = append(c.endpoints, newEndpoint(parsed, ep.Role))
+	}
+	c.startHealthChecks()
 	return c, nil
 }
 
@@ -75,7 +99,7 @@ func (c *Client) CreateCollection(ctx context.Context, req *CreateCollectionRequ
 	if req == nil {
 		return nil, errors.New("create collection request is nil")
 	}
-	body, err := encodeJSONPayload(req)
+	body, err := encodeJSONPayload(c.codec, req)
 	if err != nil {
 		return nil, fmt.Errorf("encode create collection request: %w", err)
 	}
@@ -83,30 +107,39 @@ func (c *Client) CreateCollection(ctx context.Context, req *CreateCollectionRequ
 	if err := c.doJSON(ctx, http.MethodPost, "/v1/collections", body, &result); err != nil {
 		return nil, err
 	}
+	c.metadata.invalidate(result.Name)
 	return &result, nil
 }
 
 // GetCollection retrieves the metadata of a single collection.
 func (c *Client) GetCollection(ctx context.Context, collection string) (*Collection, error) {
+	if cached, ok := c.metadata.get(collection, metadataCollection); ok {
+		result := copyCollection(cached.(Collection))
+		return &result, nil
+	}
+	gen := c.metadata.generation(collection)
 	var result Collection
 	if err := c.doJSON(ctx, http.MethodGet, collectionPath(collection), nil, &result); err != nil {
 		return nil, err
 	}
+	c.metadata.set(collection, metadataCollection, gen, copyCollection(result))
 	return &result, nil
 }
 
 // DropCollection deletes the collection and its indexes.
 func (c *Client) DropCollection(ctx context.Context, collection string) error {
+	defer c.metadata.invalidate(collection)
 	return c.doJSON(ctx, http.MethodPost, collectionActionPath(collection, "dropCollection"), nil, nil)
 }
 
 // SetDefaults configures the default document used when inserting new rows.
 func (c *Client) SetDefaults(ctx context.Context, collection string, defaults map[string]any) (map[string]any, error) {
-	body, err := encodeJSONObject(defaults)
+	body, err := encodeJSONObject(c.codec, defaults)
 	if err != nil {
 		return nil, fmt.Errorf("encode defaults request: %w", err)
 	}
 	result := map[string]any{}
+	defer c.metadata.invalidate(collection)
 	if err := c.doJSON(ctx, http.MethodPost, collectionActionPath(collection, "setDefaults"), body, &result); err != nil {
 		return nil, err
 	}
@@ -115,10 +148,26 @@ func (c *Client) SetDefaults(ctx context.Context, collection string, defaults ma
 
 // ListIndexes returns the indexes registered in a collection.
 func (c *Client) ListIndexes(ctx context.Context, collection string) ([]Index, error) {
+	if cached, ok := c.metadata.get(collection, metadataIndexes); ok {
+		indexes := cached.([]Index)
+		result := make([]Index, len(indexes))
+		for i, idx := range indexes {
+			result[i] = copyIndex(idx)
+		}
+		return result, nil
+	}
+	gen := c.metadata.generation(collection)
 	var result []Index
 	if err := c.doJSON(ctx, http.MethodPost, collectionActionPath(collection, "listIndexes"), nil, &result); err != nil {
 		return nil, err
 	}
+	if c.metadata != nil {
+		cached := make([]Index, len(result))
+		for i, idx := range result {
+			cached[i] = copyIndex(idx)
+		}
+		c.metadata.set(collection, metadataIndexes, gen, cached)
+	}
 	return result, nil
 }
 
@@ -127,11 +176,12 @@ func (c *Client) CreateIndex(ctx context.Context, collection string, req *Create
 	if req == nil {
 		return nil, errors.New("create index request is nil")
 	}
-	body, err := encodeJSONPayload(req)
+	body, err := encodeJSONPayload(c.codec, req)
 	if err != nil {
 		return nil, fmt.Errorf("encode create index request: %w", err)
 	}
 	var result Index
+	defer c.metadata.invalidate(collection)
 	if err := c.doJSON(ctx, http.MethodPost, collectionActionPath(collection, "createIndex"), body, &result); err != nil {
 		return nil, err
 	}
@@ -140,7 +190,12 @@ func (c *Client) CreateIndex(ctx context.Context, collection string, req *Create
 
 // GetIndex retrieves information about a single index.
 func (c *Client) GetIndex(ctx context.Context, collection, name string) (*Index, error) {
-	body, err := encodeJSONObject(map[string]string{"name": name})
+	if cached, ok := c.metadata.get(collection, metadataIndex+name); ok {
+		result := copyIndex(cached.(Index))
+		return &result, nil
+	}
+	gen := c.metadata.generation(collection)
+	body, err := encodeJSONObject(c.codec, map[string]string{"name": name})
 	if err != nil {
 		return nil, fmt.Errorf("encode get index request: %w", err)
 	}
@@ -148,15 +203,17 @@ func (c *Client) GetIndex(ctx context.Context, collection, name string) (*Index,
 	if err := c.doJSON(ctx, http.MethodPost, collectionActionPath(collection, "getIndex"), body, &result); err != nil {
 		return nil, err
 	}
+	c.metadata.set(collection, metadataIndex+name, gen, copyIndex(result))
 	return &result, nil
 }
 
 // DropIndex removes an index from a collection.
 func (c *Client) DropIndex(ctx context.Context, collection, name string) error {
-	body, err := encodeJSONObject(map[string]string{"name": name})
+	body, err := encodeJSONObject(c.codec, map[string]string{"name": name})
 	if err != nil {
 		return fmt.Errorf("encode drop index request: %w", err)
 	}
+	defer c.metadata.invalidate(collection)
 	return c.doJSON(ctx, http.MethodPost, collectionActionPath(collection, "dropIndex"), body, nil)
 }
 
@@ -181,9 +238,12 @@ func (c *Client) InsertStream(ctx context.Context, collection string, reader io.
 // InsertDocuments is a convenience helper that encodes the provided documents as
 // JSON Lines before sending them to the server.
 func (c *Client) InsertDocuments(ctx context.Context, collection string, documents ...any) (*JSONStream, error) {
+	if err := c.validateDocuments(collection, documents); err != nil {
+		return nil, err
+	}
 	var reader io.Reader
 	if len(documents) > 0 {
-		r, err := encodeJSONLines(documents)
+		r, err := encodeJSONLines(c.codec, documents)
 		if err != nil {
 			return nil, fmt.Errorf("encode insert payload: %w", err)
 		}
@@ -195,7 +255,7 @@ func (c *Client) InsertDocuments(ctx context.Context, collection string, documen
 // Find executes a query against the collection and streams the matching
 // documents.
 func (c *Client) Find(ctx context.Context, collection string, req *FindRequest) (*JSONStream, error) {
-	body, err := encodeQueryRequest(req)
+	body, err := encodeQueryRequest(c.codec, req)
 	if err != nil {
 		return nil, fmt.Errorf("encode find request: %w", err)
 	}
@@ -208,7 +268,10 @@ func (c *Client) Patch(ctx context.Context, collection string, req *PatchRequest
 	if req == nil {
 		return nil, errors.New("patch request is nil")
 	}
-	body, err := encodeQueryRequest(req)
+	if err := c.validatePatch(collection, req.Patch); err != nil {
+		return nil, err
+	}
+	body, err := encodeQueryRequest(c.codec, req)
 	if err != nil {
 		return nil, fmt.Errorf("encode patch request: %w", err)
 	}
@@ -218,7 +281,7 @@ func (c *Client) Patch(ctx context.Context, collection string, req *PatchRequest
 // Remove deletes the documents matched by the query and streams the removed
 // documents back to the caller.
 func (c *Client) Remove(ctx context.Context, collection string, req *RemoveRequest) (*JSONStream, error) {
-	body, err := encodeQueryRequest(req)
+	body, err := encodeQueryRequest(c.codec, req)
 	if err != nil {
 		return nil, fmt.Errorf("encode remove request: %w", err)
 	}
@@ -226,11 +289,16 @@ func (c *Client) Remove(ctx context.Context, collection string, req *RemoveReque
 }
 
 func (c *Client) stream(ctx context.Context, method, path string, body io.Reader, contentType string) (*JSONStream, error) {
-	resp, err := c.do(ctx, method, path, body, contentType)
+	resp, cl, err := c.doCall(ctx, method, path, body, contentType)
 	if err != nil {
 		return nil, err
 	}
-	return newJSONStream(resp), nil
+	s := newJSONStream(resp, c.codec)
+	if cl != nil {
+		cl.stream = true
+		s.call = cl
+	}
+	return s, nil
 }
 
 func (c *Client) doJSON(ctx context.Context, method, path string, body io.Reader, dest any) error {
@@ -245,7 +313,7 @@ func (c *Client) doJSON(ctx context.Context, method, path string, body io.Reader
 		return nil
 	}
 
-	dec := json.NewDecoder(resp.Body)
+	dec := c.codec.NewDecoder(resp.Body)
 	if err := dec.Decode(dest); err != nil {
 		if errors.Is(err, io.EOF) {
 			return nil
@@ -257,39 +325,115 @@ func (c *Client) doJSON(ctx context.Context, method, path string, body io.Reader
 }
 
 func (c *Client) do(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	resp, _, err := c.doCall(ctx, method, path, body, contentType)
+	return resp, err
+}
+
+// doCall performs the request and also returns the instrumentation call bound
+// to it, which is nil when the client is not instrumented.
+func (c *Client) doCall(ctx context.Context, method, path string, body io.Reader, contentType string) (*http.Response, *call, error) {
 	if ctx == nil {
 		ctx = context.Background()
 	}
 
 	rel, err := url.Parse(path)
 	if err != nil {
-		return nil, fmt.Errorf("invalid path %q: %w", path, err)
+		return nil, nil, fmt.Errorf("invalid path %q: %w", path, err)
 	}
-	endpoint := c.baseURL.ResolveReference(rel)
-
-	req, err := http.NewRequestWithContext(ctx, method, endpoint.String(), body)
-	if err != nil {
-		return nil, err
+	cl := c.newCall(ctx, method, path)
+	if cl != nil {
+		ctx = cl.ctx
 	}
 
 	if contentType == "" && body != nil {
 		contentType = "application/json"
 	}
-	if contentType != "" {
-		req.Header.Set("Content-Type", contentType)
-	}
 
-	resp, err := c.httpClient.Do(req)
+	op, _ := operation(method, path)
+	var resp *http.Response
+	for i, ep := range c.endpointsFor(op) {
+		if i > 0 && !rewind(body) {
+			break
+		}
+
+		resp, err = c.send(ctx, ep, method, rel, body, contentType, cl)
+		if err != nil && ctx.Err() != nil {
+			// The caller gave up, which says nothing about the endpoint.
+			break
+		}
+		ep.observe(resp, err)
+		if err == nil || !readOperations[op] {
+			break
+		}
+	}
 	if err != nil {
-		return nil, err
+		cl.fail(err)
+		return nil, nil, cl.attachTimings(err)
 	}
+	if c.compression {
+		decompressResponse(resp)
+	}
+	cl.wrapResponse(resp)
 
 	if resp.StatusCode >= 400 {
 		defer resp.Body.Close()
-		return nil, parseErrorResponse(resp)
+		err := parseErrorResponse(resp)
+		cl.fail(err)
+		return nil, nil, cl.attachTimings(err)
 	}
 
-	return resp, nil
+	c.outbox.Load().notify()
+	return resp, cl, nil
+}
+
+// send makes one attempt against ep. With compression enabled, a compressed
+// body rejected with 415 is sent again uncompressed when it can be rewound.
+func (c *Client) send(ctx context.Context, ep *endpoint, method string, rel *url.URL, body io.Reader, contentType string, cl *call) (*http.Response, error) {
+	compress := c.shouldCompress(ep, body)
+	for {
+		reqBody := body
+		var zr *gzipPipe
+		if compress {
+			zr = gzipReader(cl.countBody(body))
+			reqBody = zr
+		}
+		req, err := http.NewRequestWithContext(ctx, method, ep.url.ResolveReference(rel).String(), reqBody)
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if c.compression {
+			req.Header.Set("Accept-Encoding", "gzip")
+		}
+		if compress {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		if sc, ok := SpanContextFromContext(ctx); ok {
+			req.Header.Set(TraceParentHeader, sc.TraceParent())
+		}
+
+		cl.wrapRequest(req, compress)
+		resp, err := c.httpClient.Do(req)
+		if !compress {
+			return resp, err
+		}
+		if _, ok := body.(io.Seeker); ok {
+			// The body may be sent again, here or on another endpoint.
+			zr.release()
+		}
+		if err != nil || resp.StatusCode != http.StatusUnsupportedMediaType {
+			return resp, err
+		}
+		ep.plainBodies.Store(true)
+		if !rewind(body) {
+			return resp, nil
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		compress = false
+	}
 }
 
 func collectionPath(collection string) string {
@@ -300,7 +444,7 @@ func collectionActionPath(collection, action string) string {
 	return collectionPath(collection) + ":" + action
 }
 
-func encodeJSONPayload(payload any) (io.Reader, error) {
+func encodeJSONPayload(codec Codec, payload any) (io.Reader, error) {
 	if payload == nil {
 		return nil, nil
 	}
@@ -318,7 +462,7 @@ func encodeJSONPayload(payload any) (io.Reader, error) {
 		copy(data, v)
 		return bytes.NewReader(data), nil
 	default:
-		data, err := json.Marshal(v)
+		data, err := codec.Marshal(v)
 		if err != nil {
 			return nil, err
 		}
@@ -326,7 +470,7 @@ func encodeJSONPayload(payload any) (io.Reader, error) {
 	}
 }
 
-func encodeJSONObject(payload any) (io.Reader, error) {
+func encodeJSONObject(codec Codec, payload any) (io.Reader, error) {
 	switch v := payload.(type) {
 	case nil:
 		return bytes.NewReader([]byte("{}")), nil
@@ -346,7 +490,7 @@ func encodeJSONObject(payload any) (io.Reader, error) {
 		}
 		return strings.NewReader(v), nil
 	case json.RawMessage:
-		return encodeJSONObject([]byte(v))
+		return encodeJSONObject(codec, []byte(v))
 	default:
 		val := reflect.ValueOf(payload)
 		switch val.Kind() { //nolint:exhaustive // interested in composite types.
@@ -359,7 +503,7 @@ func encodeJSONObject(payload any) (io.Reader, error) {
 				return bytes.NewReader([]byte("{}")), nil
 			}
 		}
-		data, err := json.Marshal(v)
+		data, err := codec.Marshal(v)
 		if err != nil {
 			return nil, err
 		}
@@ -367,10 +511,9 @@ func encodeJSONObject(payload any) (io.Reader, error) {
 	}
 }
 
-func encodeJSONLines(items []any) (io.Reader, error) {
+func encodeJSONLines(codec Codec, items []any) (io.Reader, error) {
 	buf := &bytes.Buffer{}
-	enc := json.NewEncoder(buf)
-	enc.SetEscapeHTML(false)
+	enc := codec.NewEncoder(buf)
 	for _, item := range items {
 		if err := enc.Encode(item); err != nil {
 			return nil, err
@@ -379,7 +522,7 @@ func encodeJSONLines(items []any) (io.Reader, error) {
 	return buf, nil
 }
 
-func encodeQueryRequest(payload any) (io.Reader, error) {
+func encodeQueryRequest(codec Codec, payload any) (io.Reader, error) {
 	if payload == nil {
 		return bytes.NewReader([]byte("{}")), nil
 	}
@@ -390,5 +533,5 @@ func encodeQueryRequest(payload any) (io.Reader, error) {
 			return bytes.NewReader([]byte("{}")), nil
 		}
 	}
-	return encodeJSONObject(payload)
+	return encodeJSONObject(codec, payload)
 }
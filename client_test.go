@@ -23,7 +23,7 @@ func TestOnline(t *testing.T) {
 }
 
 func TestEncodeQueryRequestNil(t *testing.T) {
-	reader, err := encodeQueryRequest((*FindRequest)(nil))
+	reader, err := encodeQueryRequest(JSONCodec{}, (*FindRequest)(nil))
 	if err != nil {
 		t.Fatalf("encodeQueryRequest() error = %v", err)
 	}
@@ -44,7 +44,7 @@ func TestEncodeQueryRequestPayload(t *testing.T) {
 			Filter: map[string]any{"name": "Fulanez"},
 		},
 	}
-	reader, err := encodeQueryRequest(req)
+	reader, err := encodeQueryRequest(JSONCodec{}, req)
 	if err != nil {
 		t.Fatalf("encodeQueryRequest() error = %v", err)
 	}
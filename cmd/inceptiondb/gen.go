@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"unicode"
+
+	"inceptiondb"
+)
+
+// runGen samples the documents of a collection and writes Go structs
+// describing them.
+func runGen(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("gen", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baseURL := urlFlag(fs)
+	collection := fs.String("collection", "", "collection to sample (required)")
+	sample := fs.Int64("sample", 1000, "number of documents to sample")
+	pkg := fs.String("package", "main", "package of the generated file")
+	typeName := fs.String("type", "", "name of the generated type (defaults to the collection name)")
+	output := fs.String("o", "", "file to write, the standard output when empty")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: inceptiondb gen -collection name [flags]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *collection == "" || fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+	if *typeName == "" {
+		*typeName = goName(*collection)
+	}
+
+	client, err := newClient(*baseURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "inceptiondb gen: %v\n", err)
+		return 2
+	}
+	defer client.Close()
+	src, err := generate(context.Background(), client, *collection, *sample, *pkg, *typeName)
+	if err != nil {
+		fmt.Fprintf(stderr, "inceptiondb gen: %v\n", err)
+		return 1
+	}
+	if *output == "" {
+		stdout.Write(src)
+		return 0
+	}
+	if err := os.WriteFile(*output, src, 0o644); err != nil {
+		fmt.Fprintf(stderr, "inceptiondb gen: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// generate samples up to sample documents of collection and returns the
+// formatted source of a file declaring typeName and its nested types.
+func generate(ctx context.Context, client *inceptiondb.Client, collection string, sample int64, pkg, typeName string) ([]byte, error) {
+	indexes, err := client.ListIndexes(ctx, collection)
+	if err != nil {
+		return nil, fmt.Errorf("list indexes: %w", err)
+	}
+	stream, err := client.Find(ctx, collection, &inceptiondb.FindRequest{
+		QueryOptions: inceptiondb.QueryOptions{Limit: sample},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find: %w", err)
+	}
+	defer stream.Close()
+
+	root := &shape{}
+	n := 0
+	for {
+		var raw json.RawMessage
+		if err := stream.Next(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("find: %w", err)
+		}
+		dec := json.NewDecoder(bytes.NewReader(raw))
+		dec.UseNumber()
+		var doc any
+		if err := dec.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("decode document: %w", err)
+		}
+		root.add(doc)
+		n++
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("collection %q has no documents to sample", collection)
+	}
+
+	g := &generator{indexTags: indexTags(indexes), names: map[string]bool{}}
+	fmt.Fprintf(&g.buf, "// Code generated by inceptiondb gen from %d documents of %q. DO NOT EDIT.\n\n", n, collection)
+	fmt.Fprintf(&g.buf, "package %s\n", pkg)
+	g.structType(typeName, root, "")
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// shape accumulates what the sampled values at one position look like.
+type shape struct {
+	count  int // values seen, nulls included
+	nulls  int
+	bools  int
+	ints   int
+	floats int
+	strs   int
+	arrays int
+	objs   int
+
+	fields map[string]*shape
+	order  []string // field names in order of appearance
+	elem   *shape
+}
+
+func (s *shape) add(v any) {
+	s.count++
+	switch v := v.(type) {
+	case nil:
+		s.nulls++
+	case bool:
+		s.bools++
+	case string:
+		s.strs++
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			s.ints++
+		} else {
+			s.floats++
+		}
+	case []any:
+		s.arrays++
+		if s.elem == nil {
+			s.elem = &shape{}
+		}
+		for _, item := range v {
+			s.elem.add(item)
+		}
+	case map[string]any:
+		s.objs++
+		if s.fields == nil {
+			s.fields = map[string]*shape{}
+		}
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			f, ok := s.fields[name]
+			if !ok {
+				f = &shape{}
+				s.fields[name] = f
+				s.order = append(s.order, name)
+			}
+			f.add(v[name])
+		}
+	}
+}
+
+// kinds returns how many different JSON types were seen, integers and
+// floats counting as one, and nulls not at all.
+func (s *shape) kinds() int {
+	n := 0
+	for _, c := range []int{s.bools, s.ints + s.floats, s.strs, s.arrays, s.objs} {
+		if c > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+type generator struct {
+	buf       bytes.Buffer
+	indexTags map[string]string
+	names     map[string]bool
+	pending   []pendingType
+}
+
+type pendingType struct {
+	name  string
+	shape *shape
+	path  string
+}
+
+// structType writes the struct for an object shape, then the structs of its
+// nested objects.
+func (g *generator) structType(name string, s *shape, path string) {
+	g.names[name] = true
+	fmt.Fprintf(&g.buf, "\ntype %s struct {\n", name)
+	used := map[string]bool{}
+	for _, field := range s.order {
+		fs := s.fields[field]
+		fieldName := uniqueName(goName(field), used)
+		fieldPath := field
+		if path != "" {
+			fieldPath = path + "." + field
+		}
+		optional := fs.count < s.objs || fs.nulls > 0
+		typ := g.goType(fs, name+fieldName, fieldPath, optional)
+		tag := field
+		if optional {
+			tag += ",omitempty"
+		}
+		tags := fmt.Sprintf("json:%q", tag)
+		if idx, ok := g.indexTags[fieldPath]; ok {
+			tags += fmt.Sprintf(" index:%q", idx)
+		}
+		fmt.Fprintf(&g.buf, "\t%s %s `%s`\n", fieldName, typ, tags)
+	}
+	g.buf.WriteString("}\n")
+
+	pending := g.pending
+	g.pending = nil
+	for _, p := range pending {
+		g.structType(p.name, p.shape, p.path)
+	}
+}
+
+// goType returns the Go type for the values of s. Optional scalars and
+// structs are pointers, so a missing value can be told from a zero one.
+func (g *generator) goType(s *shape, name, path string, optional bool) string {
+	if s.kinds() != 1 {
+		return "any"
+	}
+	var typ string
+	switch {
+	case s.bools > 0:
+		typ = "bool"
+	case s.floats > 0:
+		typ = "float64"
+	case s.ints > 0:
+		typ = "int64"
+	case s.strs > 0:
+		typ = "string"
+	case s.arrays > 0:
+		if s.elem == nil || s.elem.count == 0 {
+			return "[]any"
+		}
+		elemName := name
+		if strings.HasSuffix(elemName, "s") && len(elemName) > 1 {
+			elemName = strings.TrimSuffix(elemName, "s")
+		} else {
+			elemName += "Item"
+		}
+		return "[]" + g.goType(s.elem, elemName, path, s.elem.nulls > 0)
+	case s.objs > 0:
+		if len(s.order) == 0 {
+			return "map[string]any"
+		}
+		name = uniqueName(name, g.names)
+		g.names[name] = true
+		g.pending = append(g.pending, pendingType{name: name, shape: s, path: path})
+		typ = name
+	}
+	if optional {
+		return "*" + typ
+	}
+	return typ
+}
+
+// indexTags maps indexed field paths to the value of their index tag:
+// "name,type" entries, with ",unique" and ",desc" where they apply, joined by
+// ";" when a field is covered by several indexes.
+func indexTags(indexes []inceptiondb.Index) map[string]string {
+	tags := map[string]string{}
+	for _, idx := range indexes {
+		var fields []string
+		if list, ok := idx.Options["fields"].([]any); ok {
+			for _, f := range list {
+				if name, ok := f.(string); ok {
+					fields = append(fields, name)
+				}
+			}
+		}
+		if field, ok := idx.Options["field"].(string); ok && len(fields) == 0 {
+			fields = []string{field}
+		}
+		for _, field := range fields {
+			tag := idx.Name + "," + idx.Type
+			if unique, _ := idx.Options["unique"].(bool); unique {
+				tag += ",unique"
+			}
+			if strings.HasPrefix(field, "-") {
+				field = field[1:]
+				tag += ",desc"
+			}
+			if prev, ok := tags[field]; ok {
+				tag = prev + ";" + tag
+			}
+			tags[field] = tag
+		}
+	}
+	return tags
+}
+
+var initialisms = map[string]string{
+	"id": "ID", "url": "URL", "uri": "URI", "http": "HTTP", "api": "API",
+	"uuid": "UUID", "json": "JSON", "ip": "IP", "sql": "SQL", "ttl": "TTL",
+}
+
+// goName turns a JSON key or collection name into an exported identifier:
+// "customer_id" becomes CustomerID and "created-at" CreatedAt.
+func goName(s string) string {
+	words := strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var b strings.Builder
+	for _, w := range words {
+		if up, ok := initialisms[strings.ToLower(w)]; ok {
+			b.WriteString(up)
+			continue
+		}
+		runes := []rune(w)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+	name := b.String()
+	if name == "" {
+		return "Field"
+	}
+	if unicode.IsDigit([]rune(name)[0]) {
+		name = "F" + name
+	}
+	return name
+}
+
+// uniqueName returns name, with a numeric suffix if it is already in used,
+// and marks the result as used.
+func uniqueName(name string, used map[string]bool) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		candidate = fmt.Sprintf("%s%d", name, i)
+	}
+	used[candidate] = true
+	return candidate
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+
+	"inceptiondb"
+	"inceptiondb/inceptiondbtest"
+)
+
+func TestGen(t *testing.T) {
+	ctx := context.Background()
+	srv := inceptiondbtest.NewServer()
+	defer srv.Close()
+	client, err := inceptiondb.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.InsertDocuments(ctx, "users",
+		map[string]any{"id": "u1", "email": "a@b", "age": 30, "score": 1.5, "address": map[string]any{"city": "Madrid", "zip": "28001"}, "tags": []string{"a"}, "created_at": "2024-01-01"},
+		map[string]any{"id": "u2", "email": "c@d", "age": 41, "score": 2, "address": map[string]any{"city": "Paris"}, "tags": []string{}, "nickname": nil, "created_at": "2024-02-01"},
+		map[string]any{"id": "u3", "email": "e@f", "age": 18, "score": 3, "extra": "x", "created_at": "2024-03-01"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+	for _, idx := range []inceptiondb.CreateIndexRequest{
+		{Name: "by_email", Type: "map", Options: map[string]any{"field": "email"}},
+		{Name: "by_created", Type: "btree", Options: map[string]any{"fields": []string{"-created_at", "id"}, "unique": true}},
+	} {
+		if _, err := client.CreateIndex(ctx, "users", &idx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"gen", "-url", srv.URL, "-collection", "users", "-type", "User", "-package", "models"}, nil, &stdout, &stderr)
+	if code != 0 {
+		t.Fatalf("exit code = %d; stderr: %s", code, stderr.String())
+	}
+	src := stdout.String()
+	if _, err := parser.ParseFile(token.NewFileSet(), "users.go", src, 0); err != nil {
+		t.Fatalf("generated code does not parse: %v\n%s", err, src)
+	}
+	for _, want := range []string{
+		"package models",
+		"type User struct {",
+		"Address   *UserAddress `json:\"address,omitempty\"`",
+		"Age       int64        `json:\"age\"`",
+		"CreatedAt string       `json:\"created_at\" index:\"by_created,btree,unique,desc\"`",
+		"Email     string       `json:\"email\" index:\"by_email,map\"`",
+		"Extra     *string      `json:\"extra,omitempty\"`",
+		"ID        string       `json:\"id\" index:\"by_created,btree,unique\"`",
+		"Nickname  any          `json:\"nickname,omitempty\"`",
+		"Score     float64      `json:\"score\"`",
+		"Tags      []string     `json:\"tags,omitempty\"`",
+		"type UserAddress struct {",
+		"City string  `json:\"city\"`",
+		"Zip  *string `json:\"zip,omitempty\"`",
+	} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated code lacks %q", want)
+		}
+	}
+	if t.Failed() {
+		t.Logf("generated code:\n%s", src)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"customer_id": "CustomerID",
+		"created-at":  "CreatedAt",
+		"url":         "URL",
+		"2fa":         "F2fa",
+		"_":           "Field",
+		"orderLines":  "OrderLines",
+	} {
+		if got := goName(in); got != want {
+			t.Errorf("goName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+// Command inceptiondb gathers tools for working with InceptionDB collections.
+//
+//	inceptiondb validate -schema users.schema.json users.jsonl
+//	inceptiondb gen -url http://localhost:8080 -collection users -type User
+//	inceptiondb migrate -url http://localhost:8080 status
+//
+// Commands talking to a server take its base URL from the -url flag, which
+// defaults to the INCEPTIONDB_URL environment variable.
+// Run "inceptiondb help" for the list of commands, and "inceptiondb <command>
+// -h" for the flags of a command.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"inceptiondb"
+	"inceptiondb/migrate"
+)
+
+// command is a subcommand. run returns the exit status: 0 on success, 1 when
+// the command ran and failed, 2 on usage errors.
+type command struct {
+	summary string
+	run     func(args []string, stdin io.Reader, stdout, stderr io.Writer) int
+}
+
+var commands = map[string]command{
+	"gen":      {summary: "generate Go structs from the documents of a collection", run: runGen},
+	"migrate":  {summary: "show the status of migrations", run: runMigrate},
+	"validate": {summary: "validate JSON Lines documents against a schema", run: runValidate},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		usage(stderr)
+		if len(args) == 0 {
+			return 2
+		}
+		return 0
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(stderr, "inceptiondb: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	return cmd.run(args[1:], stdin, stdout, stderr)
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: inceptiondb <command> [flags]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-10s %s\n", name, commands[name].summary)
+	}
+}
+
+// runMigrate is migrate.Command. This binary registers no migrations, so it
+// is only useful for status; up and down fail with an explanation.
+func runMigrate(args []string, _ io.Reader, stdout, stderr io.Writer) int {
+	return migrate.Command(args, stdout, stderr)
+}
+
+// urlFlag defines the -url flag of the commands talking to a server.
+func urlFlag(fs *flag.FlagSet) *string {
+	return fs.String("url", os.Getenv("INCEPTIONDB_URL"), "base URL of the server (default $INCEPTIONDB_URL)")
+}
+
+func newClient(baseURL string) (*inceptiondb.Client, error) {
+	if baseURL == "" {
+		return nil, errors.New("no server URL: set -url or INCEPTIONDB_URL")
+	}
+	return inceptiondb.NewClient(baseURL)
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run(nil, nil, &stdout, &stderr); code != 2 {
+		t.Fatalf("exit code = %d, want 2", code)
+	}
+	if code := run([]string{"nope"}, nil, &stdout, &stderr); code != 2 {
+		t.Fatalf("exit code = %d, want 2", code)
+	}
+	if code := run([]string{"validate"}, nil, &stdout, &stderr); code != 2 {
+		t.Fatalf("exit code = %d for validate without -schema, want 2", code)
+	}
+	if !strings.Contains(stderr.String(), "validate") {
+		t.Fatalf("usage does not list validate: %q", stderr.String())
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"inceptiondb/schema"
+)
+
+// runValidate checks every line of the given JSON Lines files, or of the
+// standard input, against a schema and reports each failure as
+// file:line: path: message.
+func runValidate(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	schemaPath := fs.String("schema", "", "path of the JSON schema file (required)")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: inceptiondb validate -schema file [file.jsonl ...]")
+		fmt.Fprintln(stderr, "Reads the standard input when no file, or -, is given.")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *schemaPath == "" {
+		fs.Usage()
+		return 2
+	}
+	s, err := schema.Load(*schemaPath)
+	if err != nil {
+		fmt.Fprintf(stderr, "inceptiondb validate: %v\n", err)
+		return 1
+	}
+
+	files := fs.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	var total, invalid int
+	for _, name := range files {
+		n, bad, err := validateFile(s, name, stdin, stdout)
+		total += n
+		invalid += bad
+		if err != nil {
+			fmt.Fprintf(stderr, "inceptiondb validate: %v\n", err)
+			return 1
+		}
+	}
+	if invalid > 0 {
+		fmt.Fprintf(stderr, "%d of %d documents are invalid\n", invalid, total)
+		return 1
+	}
+	return 0
+}
+
+// validateFile validates the documents of one file and returns how many it
+// read and how many were invalid.
+func validateFile(s *schema.Schema, name string, stdin io.Reader, out io.Writer) (total, invalid int, err error) {
+	var r io.Reader = stdin
+	label := "<stdin>"
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return 0, 0, err
+		}
+		defer f.Close()
+		r, label = f, name
+	}
+
+	lines := bufio.NewReaderSize(r, 64*1024)
+	for lineNo := 1; ; lineNo++ {
+		line, err := lines.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			total++
+			if !validateLine(s, line, fmt.Sprintf("%s:%d", label, lineNo), out) {
+				invalid++
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return total, invalid, nil
+		}
+		if err != nil {
+			return total, invalid, fmt.Errorf("%s: %w", label, err)
+		}
+	}
+}
+
+func validateLine(s *schema.Schema, line []byte, pos string, out io.Writer) bool {
+	if !json.Valid(line) {
+		fmt.Fprintf(out, "%s: invalid JSON\n", pos)
+		return false
+	}
+	err := s.Validate(json.RawMessage(line))
+	if err == nil {
+		return true
+	}
+	var verr *schema.ValidationError
+	if !errors.As(err, &verr) {
+		fmt.Fprintf(out, "%s: %v\n", pos, err)
+		return false
+	}
+	for _, fe := range verr.Errors {
+		fmt.Fprintf(out, "%s: %s\n", pos, fe)
+	}
+	return false
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "user.json")
+	os.WriteFile(schemaPath, []byte(`{
+		"type": "object",
+		"required": ["id"],
+		"properties": {"id": {"type": "string"}, "age": {"type": "integer", "minimum": 0}}
+	}`), 0o644)
+	dataPath := filepath.Join(dir, "users.jsonl")
+	os.WriteFile(dataPath, []byte(`{"id":"1","age":3}`+"\n\n"+`{"age":-1}`+"\n"+`{oops`+"\n"), 0o644)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"validate", "-schema", schemaPath, dataPath}, nil, &stdout, &stderr)
+	if code != 1 {
+		t.Fatalf("exit code = %d, want 1; stderr: %s", code, stderr.String())
+	}
+	want := dataPath + ":3: $.id: is required\n" +
+		dataPath + ":3: $.age: must be >= 0\n" +
+		dataPath + ":4: invalid JSON\n"
+	if stdout.String() != want {
+		t.Fatalf("stdout =\n%s\nwant\n%s", stdout.String(), want)
+	}
+	if !strings.Contains(stderr.String(), "2 of 3 documents are invalid") {
+		t.Fatalf("stderr = %q", stderr.String())
+	}
+
+	stdout.Reset()
+	code = run([]string{"validate", "-schema", schemaPath}, strings.NewReader(`{"id":"2"}`), &stdout, &stderr)
+	if code != 0 || stdout.Len() != 0 {
+		t.Fatalf("exit code = %d, stdout = %q; want 0 and no output", code, stdout.String())
+	}
+}
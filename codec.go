@@ -0,0 +1,79 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+// Codec encodes request payloads and decodes responses. Codecs with an
+// Unmarshal(data []byte, v any) error method use it to decode stream items,
+// which saves setting up a Decoder for every line.
+type Codec interface {
+	Marshal(v any) ([]byte, error)
+	NewDecoder(r io.Reader) Decoder
+	NewEncoder(w io.Writer) Encoder
+}
+
+// Decoder reads successive values from a stream.
+type Decoder interface {
+	Decode(v any) error
+}
+
+// Encoder writes successive values to a stream.
+type Encoder interface {
+	Encode(v any) error
+}
+
+// JSONCodec is the default codec, backed by encoding/json.
+type JSONCodec struct {
+	// UseNumber decodes numbers held in interface values as json.Number
+	// instead of float64, so integers above 2^53 keep their exact value.
+	UseNumber bool
+}
+
+// Marshal implements Codec.
+func (c JSONCodec) Marshal(v any) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// NewDecoder implements Codec.
+func (c JSONCodec) NewDecoder(r io.Reader) Decoder {
+	dec := json.NewDecoder(r)
+	if c.UseNumber {
+		dec.UseNumber()
+	}
+	return dec
+}
+
+// NewEncoder implements Codec. HTML characters are not escaped.
+func (c JSONCodec) NewEncoder(w io.Writer) Encoder {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return enc
+}
+
+// Unmarshal decodes a single value.
+func (c JSONCodec) Unmarshal(data []byte, v any) error {
+	if !c.UseNumber {
+		return json.Unmarshal(data, v)
+	}
+	return c.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// WithCodec sets the codec used for request payloads, responses and streams.
+// It defaults to JSONCodec{}.
+func WithCodec(codec Codec) Option {
+	return func(c *Client) {
+		c.codec = codec
+	}
+}
+
+// unmarshal decodes data with codec, through its Unmarshal method when it has
+// one.
+func unmarshal(codec Codec, data []byte, v any) error {
+	if u, ok := codec.(interface{ Unmarshal([]byte, any) error }); ok {
+		return u.Unmarshal(data, v)
+	}
+	return codec.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
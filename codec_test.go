@@ -0,0 +1,117 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCodecUseNumber(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ":setDefaults") {
+			io.Copy(w, r.Body)
+			return
+		}
+		w.Write([]byte("{\"id\":9007199254740993}\n"))
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL, WithCodec(JSONCodec{UseNumber: true}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stream, err := client.Find(ctx, "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	var doc map[string]any
+	if err := stream.Next(&doc); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if got := doc["id"]; got != json.Number("9007199254740993") {
+		t.Fatalf("id = %v (%T), want json.Number 9007199254740993", got, got)
+	}
+
+	defaults, err := client.SetDefaults(ctx, "items", map[string]any{"seq": json.Number("9007199254740993")})
+	if err != nil {
+		t.Fatalf("SetDefaults() error = %v", err)
+	}
+	if got := defaults["seq"]; got != json.Number("9007199254740993") {
+		t.Fatalf("seq = %v (%T), want json.Number 9007199254740993", got, got)
+	}
+}
+
+// countingCodec wraps JSONCodec without its Unmarshal method, so streams go
+// through NewDecoder.
+type countingCodec struct {
+	marshal, decoders *int
+}
+
+func (c countingCodec) Marshal(v any) ([]byte, error) {
+	*c.marshal++
+	return JSONCodec{}.Marshal(v)
+}
+
+func (c countingCodec) NewDecoder(r io.Reader) Decoder {
+	*c.decoders++
+	return JSONCodec{}.NewDecoder(r)
+}
+
+func (c countingCodec) NewEncoder(w io.Writer) Encoder {
+	return JSONCodec{}.NewEncoder(w)
+}
+
+func TestCustomCodec(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{\"id\":1}\n{\"id\":2}\n"))
+	}))
+	defer srv.Close()
+	var marshal, decoders int
+	client, err := NewClient(srv.URL, WithCodec(countingCodec{&marshal, &decoders}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Find(context.Background(), "items", &FindRequest{QueryOptions: QueryOptions{Limit: 2}})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	var ids []int
+	if err := Iterate(stream, func(doc *testDocument) error {
+		ids = append(ids, doc.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Iterate() error = %v", err)
+	}
+	if len(ids) != 2 || marshal != 1 || decoders != 2 {
+		t.Fatalf("ids = %v, Marshal calls = %d, decoders = %d; want 2 ids, 1 and 2", ids, marshal, decoders)
+	}
+}
+
+func TestStreamRawMessageReusesBuffer(t *testing.T) {
+	long := `{"blob":"` + strings.Repeat("x", 100*1024) + `"}`
+	stream := newTestStream(t, "{\"id\":1}\n\n{\"id\":2}\n"+long+"\n{\"id\":3}")
+
+	raw := make(json.RawMessage, 0, 256)
+	var got []string
+	for {
+		if err := stream.Next(&raw); err != nil {
+			if err == io.EOF {
+				break
+			}
+			t.Fatalf("Next() error = %v", err)
+		}
+		if len(got) < 2 && cap(raw) != 256 {
+			t.Fatalf("Next() reallocated the destination, cap = %d", cap(raw))
+		}
+		got = append(got, string(raw[:min(len(raw), 8)]))
+	}
+	want := `{"id":1},{"id":2},{"blob":,{"id":3}`
+	if strings.Join(got, ",") != want {
+		t.Fatalf("items = %s, want %s", strings.Join(got, ","), want)
+	}
+}
@@ -0,0 +1,100 @@
+package inceptiondb
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+)
+
+// minCompressedBody is the size under which request bodies of known length
+// are sent as they are; gzip would hardly make them smaller.
+const minCompressedBody = 1024
+
+// WithCompression gzip-encodes request bodies and asks the server for gzip
+// encoded responses, which are decompressed transparently, streams included.
+// Small bodies of known length are not compressed. When an endpoint rejects a
+// compressed body with 415 Unsupported Media Type, the client remembers it and
+// sends that endpoint plain bodies from then on; the rejected request is sent
+// again uncompressed when its body can be rewound.
+func WithCompression() Option {
+	return func(c *Client) {
+		c.compression = true
+	}
+}
+
+// shouldCompress reports whether body is worth compressing for ep.
+func (c *Client) shouldCompress(ep *endpoint, body io.Reader) bool {
+	if !c.compression || body == nil || body == http.NoBody || ep.plainBodies.Load() {
+		return false
+	}
+	if sized, ok := body.(interface{ Len() int }); ok && sized.Len() < minCompressedBody {
+		return false
+	}
+	return true
+}
+
+// gzipReader compresses body on the fly, so streamed inserts keep streaming.
+func gzipReader(body io.Reader) *gzipPipe {
+	pr, pw := io.Pipe()
+	g := &gzipPipe{PipeReader: pr, done: make(chan struct{})}
+	go func() {
+		defer close(g.done)
+		zw := gzip.NewWriter(pw)
+		_, err := io.Copy(zw, body)
+		if cerr := zw.Close(); err == nil {
+			err = cerr
+		}
+		pw.CloseWithError(err)
+	}()
+	return g
+}
+
+// gzipPipe is the compressed side of a request body. Its goroutine ends when
+// the body is exhausted or the pipe is closed, which the transport always
+// does, possibly after RoundTrip returns.
+type gzipPipe struct {
+	*io.PipeReader
+	done chan struct{}
+}
+
+// release closes the pipe and waits until the goroutine stops reading the
+// original body, so it can be rewound and sent again. The body must not block
+// on reads.
+func (g *gzipPipe) release() {
+	g.Close()
+	<-g.done
+}
+
+// decompressResponse replaces a gzip encoded body with its decoded content.
+func decompressResponse(resp *http.Response) {
+	if resp.Header.Get("Content-Encoding") != "gzip" {
+		return
+	}
+	resp.Body = &gzipBody{body: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+}
+
+// gzipBody decodes a gzip response. The gzip header is read lazily so a
+// stream is handed over before its first bytes arrive.
+type gzipBody struct {
+	body io.ReadCloser
+	zr   *gzip.Reader
+	err  error
+}
+
+func (b *gzipBody) Read(p []byte) (int, error) {
+	if b.zr == nil && b.err == nil {
+		b.zr, b.err = gzip.NewReader(b.body)
+	}
+	if b.err != nil {
+		return 0, b.err
+	}
+	return b.zr.Read(p)
+}
+
+func (b *gzipBody) Close() error {
+	return b.body.Close()
+}
@@ -0,0 +1,160 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// gzipServer echoes insert payloads gzip encoded and records the encoding of
+// the request bodies it receives. It rejects compressed bodies while reject415
+// is set.
+type gzipServer struct {
+	mu        sync.Mutex
+	encodings []string
+	reject415 bool
+}
+
+func (s *gzipServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.encodings = append(s.encodings, r.Header.Get("Content-Encoding"))
+	reject := s.reject415
+	s.mu.Unlock()
+
+	body := io.Reader(r.Body)
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		if reject {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	data, _ := io.ReadAll(body)
+	if r.Header.Get("Accept-Encoding") != "gzip" {
+		w.Write(data)
+		return
+	}
+	w.Header().Set("Content-Encoding", "gzip")
+	zw := gzip.NewWriter(w)
+	zw.Write(data)
+	zw.Close()
+}
+
+func largePayload() string {
+	var b strings.Builder
+	for b.Len() < 4*minCompressedBody {
+		b.WriteString("{\"name\":\"compressible document\"}\n")
+	}
+	return b.String()
+}
+
+func TestCompressionRoundTrip(t *testing.T) {
+	server := &gzipServer{}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	client, err := NewClient(srv.URL, WithCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := largePayload()
+	// A non seekable reader is compressed on the fly.
+	stream, err := client.InsertStream(context.Background(), "items", io.MultiReader(strings.NewReader(payload)))
+	if err != nil {
+		t.Fatalf("InsertStream() error = %v", err)
+	}
+	count := 0
+	if err := Iterate(stream, func(doc *map[string]any) error {
+		count++
+		return nil
+	}); err != nil {
+		t.Fatalf("Iterate() error = %v", err)
+	}
+	if want := strings.Count(payload, "\n"); count != want {
+		t.Fatalf("decoded %d items, want %d", count, want)
+	}
+
+	// Small bodies are sent as they are.
+	if _, err := client.SetDefaults(context.Background(), "items", map[string]any{"a": 1}); err != nil {
+		t.Fatalf("SetDefaults() error = %v", err)
+	}
+	if got := strings.Join(server.encodings, ","); got != "gzip," {
+		t.Fatalf("request encodings = %q, want %q", got, "gzip,")
+	}
+}
+
+func TestCompressionFallbackOn415(t *testing.T) {
+	server := &gzipServer{reject415: true}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	client, err := NewClient(srv.URL, WithCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := largePayload()
+	for i := 0; i < 2; i++ {
+		stream, err := client.InsertStream(context.Background(), "items", bytes.NewReader([]byte(payload)))
+		if err != nil {
+			t.Fatalf("InsertStream() error = %v", err)
+		}
+		data, _ := io.ReadAll(stream.resp.Body)
+		stream.Close()
+		if string(data) != payload {
+			t.Fatalf("response body differs from payload")
+		}
+	}
+	// The first request is retried plain and the second is not compressed.
+	if got := strings.Join(server.encodings, ","); got != "gzip,," {
+		t.Fatalf("request encodings = %q, want %q", got, "gzip,,")
+	}
+}
+
+func TestCompressionWithBodyLogging(t *testing.T) {
+	srv := httptest.NewServer(&gzipServer{})
+	defer srv.Close()
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewClient(srv.URL, WithCompression(), WithLogger(logger, WithBodyLogging(64)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := largePayload()
+	stream, err := client.InsertStream(context.Background(), "items", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("InsertStream() error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log record %q: %v", buf, err)
+	}
+	// Bodies are logged and counted as the caller sees them, not gzipped.
+	for _, key := range []string{"request_body", "response_body"} {
+		if body, _ := record[key].(string); !strings.HasPrefix(body, `{"name":"compressible document"}`) {
+			t.Fatalf("%s = %q, want the plain JSON", key, body)
+		}
+	}
+	for _, key := range []string{"bytes_sent", "bytes_received"} {
+		if record[key] != float64(len(payload)) {
+			t.Fatalf("%s = %v, want %d", key, record[key], len(payload))
+		}
+	}
+}
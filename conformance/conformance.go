@@ -0,0 +1,439 @@
+// Package conformance is an end-to-end test suite checking that the client
+// and an InceptionDB server agree on the HTTP API. Run it from a test against
+// the in-process fake or a locally started server:
+//
+//	func TestConformance(t *testing.T) {
+//		url := os.Getenv("INCEPTIONDB_URL")
+//		if url == "" {
+//			t.Skip("INCEPTIONDB_URL not set")
+//		}
+//		conformance.Run(t, url)
+//	}
+//
+// Every subtest works on its own collection, named with a random prefix, and
+// drops it when done, so the suite can run against a shared server. Queries
+// always set explicit limits and range bounds that fall between stored values,
+// so the assertions do not depend on server defaults.
+package conformance
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"inceptiondb"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// Run exercises every Client method against the server at baseURL. opts are
+// passed to inceptiondb.NewClient.
+func Run(t *testing.T, baseURL string, opts ...inceptiondb.Option) {
+	t.Helper()
+	client, err := inceptiondb.NewClient(baseURL, opts...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	var prefix [4]byte
+	rand.Read(prefix[:])
+	s := &suite{client: client, prefix: "conformance-" + hex.EncodeToString(prefix[:])}
+
+	t.Run("Collections", s.collections)
+	t.Run("Defaults", s.defaults)
+	t.Run("Insert", s.insert)
+	t.Run("MapIndex", s.mapIndex)
+	t.Run("BTreeIndex", s.btreeIndex)
+	t.Run("FullScan", s.fullScan)
+	t.Run("Patch", s.patch)
+	t.Run("Remove", s.remove)
+	t.Run("Errors", s.errors)
+}
+
+type suite struct {
+	client *inceptiondb.Client
+	prefix string
+}
+
+func testContext(t *testing.T) context.Context {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	return ctx
+}
+
+// newCollection creates a collection for the running subtest and drops it at
+// the end.
+func (s *suite) newCollection(t *testing.T, ctx context.Context) string {
+	t.Helper()
+	name := s.prefix + "-" + strings.ToLower(strings.ReplaceAll(t.Name(), "/", "-"))
+	if _, err := s.client.CreateCollection(ctx, &inceptiondb.CreateCollectionRequest{Name: name}); err != nil {
+		t.Fatalf("CreateCollection(%q) error = %v", name, err)
+	}
+	t.Cleanup(func() {
+		s.client.DropCollection(context.Background(), name)
+	})
+	return name
+}
+
+// seed inserts the documents and checks the inserted documents are streamed
+// back.
+func (s *suite) seed(t *testing.T, ctx context.Context, name string, docs ...any) {
+	t.Helper()
+	got := collect(t, "InsertDocuments", func() (*inceptiondb.JSONStream, error) {
+		return s.client.InsertDocuments(ctx, name, docs...)
+	})
+	if len(got) != len(docs) {
+		t.Fatalf("InsertDocuments() streamed %d documents, want %d", len(got), len(docs))
+	}
+}
+
+func collect(t *testing.T, op string, fn func() (*inceptiondb.JSONStream, error)) []map[string]any {
+	t.Helper()
+	stream, err := fn()
+	if err != nil {
+		t.Fatalf("%s() error = %v", op, err)
+	}
+	defer stream.Close()
+	var docs []map[string]any
+	if err := inceptiondb.Iterate(stream, func(doc *map[string]any) error {
+		docs = append(docs, *doc)
+		return nil
+	}); err != nil {
+		t.Fatalf("%s() stream error = %v", op, err)
+	}
+	return docs
+}
+
+// field returns the values of key in docs, formatted for comparison.
+func field(docs []map[string]any, key string) string {
+	values := make([]string, len(docs))
+	for i, doc := range docs {
+		values[i] = fmt.Sprint(doc[key])
+	}
+	return strings.Join(values, ",")
+}
+
+func expect(t *testing.T, what, got, want string) {
+	t.Helper()
+	if got != want {
+		t.Errorf("%s = %s, want %s", what, got, want)
+	}
+}
+
+func (s *suite) find(t *testing.T, ctx context.Context, name string, q inceptiondb.QueryOptions) []map[string]any {
+	t.Helper()
+	return collect(t, "Find", func() (*inceptiondb.JSONStream, error) {
+		return s.client.Find(ctx, name, &inceptiondb.FindRequest{QueryOptions: q})
+	})
+}
+
+func (s *suite) collections(t *testing.T) {
+	ctx := testContext(t)
+	name := s.prefix + "-collections"
+	created, err := s.client.CreateCollection(ctx, &inceptiondb.CreateCollectionRequest{Name: name})
+	if err != nil {
+		t.Fatalf("CreateCollection() error = %v", err)
+	}
+	if created.Name != name || created.Total != 0 {
+		t.Errorf("CreateCollection() = %+v, want empty collection %q", created, name)
+	}
+
+	got, err := s.client.GetCollection(ctx, name)
+	if err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	if got.Name != name || got.Total != 0 || got.Indexes != 0 {
+		t.Errorf("GetCollection() = %+v", got)
+	}
+
+	list, err := s.client.ListCollections(ctx)
+	if err != nil {
+		t.Fatalf("ListCollections() error = %v", err)
+	}
+	found := false
+	for _, col := range list {
+		found = found || col.Name == name
+	}
+	if !found {
+		t.Errorf("ListCollections() does not include %q", name)
+	}
+
+	size, err := s.client.Size(ctx, name)
+	if err != nil {
+		t.Fatalf("Size() error = %v", err)
+	}
+	if size == nil {
+		t.Error("Size() = nil map")
+	}
+
+	if err := s.client.DropCollection(ctx, name); err != nil {
+		t.Fatalf("DropCollection() error = %v", err)
+	}
+	if _, err := s.client.GetCollection(ctx, name); !isStatus(err, 400) {
+		t.Errorf("GetCollection() after drop error = %v, want a 4xx *inceptiondb.Error", err)
+	}
+}
+
+func (s *suite) defaults(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+
+	want := map[string]any{"id": "uuid()", "status": "new"}
+	got, err := s.client.SetDefaults(ctx, name, want)
+	if err != nil {
+		t.Fatalf("SetDefaults() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SetDefaults() = %v, want %v", got, want)
+	}
+
+	docs := collect(t, "InsertDocuments", func() (*inceptiondb.JSONStream, error) {
+		return s.client.InsertDocuments(ctx, name, map[string]any{"name": "a"}, map[string]any{"name": "b", "status": "old"})
+	})
+	if len(docs) != 2 {
+		t.Fatalf("InsertDocuments() streamed %d documents, want 2", len(docs))
+	}
+	for _, doc := range docs {
+		id, _ := doc["id"].(string)
+		if !uuidPattern.MatchString(id) {
+			t.Errorf("inserted id = %v, want a generated uuid", doc["id"])
+		}
+	}
+	if docs[0]["id"] == docs[1]["id"] {
+		t.Error("generated ids are equal")
+	}
+	expect(t, "inserted status", field(docs, "status"), "new,old")
+
+	col, err := s.client.GetCollection(ctx, name)
+	if err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	if !reflect.DeepEqual(col.Defaults, want) {
+		t.Errorf("GetCollection().Defaults = %v, want %v", col.Defaults, want)
+	}
+}
+
+func (s *suite) insert(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+
+	docs := collect(t, "InsertStream", func() (*inceptiondb.JSONStream, error) {
+		return s.client.InsertStream(ctx, name, strings.NewReader("{\"id\":\"1\",\"n\":1}\n{\"id\":\"2\",\"n\":2,\"tags\":[\"x\"]}\n"))
+	})
+	expect(t, "InsertStream() ids", field(docs, "id"), "1,2")
+	if !reflect.DeepEqual(docs[1]["tags"], []any{"x"}) {
+		t.Errorf("InsertStream() tags = %v, want [x]", docs[1]["tags"])
+	}
+	s.seed(t, ctx, name, map[string]any{"id": "3", "nested": map[string]any{"a": true}})
+
+	col, err := s.client.GetCollection(ctx, name)
+	if err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	if col.Total != 3 {
+		t.Errorf("GetCollection().Total = %d, want 3", col.Total)
+	}
+	all := s.find(t, ctx, name, inceptiondb.QueryOptions{Limit: 10})
+	expect(t, "Find() ids", field(all, "id"), "1,2,3")
+	if !reflect.DeepEqual(all[2]["nested"], map[string]any{"a": true}) {
+		t.Errorf("Find() nested = %v", all[2]["nested"])
+	}
+}
+
+func (s *suite) mapIndex(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+	s.seed(t, ctx, name,
+		map[string]any{"id": "1", "email": "a@example.com"},
+		map[string]any{"id": "2", "email": "b@example.com"},
+	)
+
+	idx, err := s.client.CreateIndex(ctx, name, &inceptiondb.CreateIndexRequest{
+		Name:    "by-email",
+		Type:    "map",
+		Options: map[string]any{"field": "email"},
+	})
+	if err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	if idx.Name != "by-email" || idx.Type != "map" || idx.Options["field"] != "email" {
+		t.Errorf("CreateIndex() = %+v", idx)
+	}
+
+	s.checkIndexes(t, ctx, name, "by-email")
+	got, err := s.client.GetIndex(ctx, name, "by-email")
+	if err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+	if got.Type != "map" || got.Options["field"] != "email" {
+		t.Errorf("GetIndex() = %+v", got)
+	}
+
+	docs := s.find(t, ctx, name, inceptiondb.QueryOptions{Mode: "unique", Index: "by-email", Value: "b@example.com"})
+	expect(t, "Find(unique) ids", field(docs, "id"), "2")
+
+	if err := s.client.DropIndex(ctx, name, "by-email"); err != nil {
+		t.Fatalf("DropIndex() error = %v", err)
+	}
+	s.checkIndexes(t, ctx, name)
+}
+
+func (s *suite) checkIndexes(t *testing.T, ctx context.Context, name string, want ...string) {
+	t.Helper()
+	indexes, err := s.client.ListIndexes(ctx, name)
+	if err != nil {
+		t.Fatalf("ListIndexes() error = %v", err)
+	}
+	names := make([]string, len(indexes))
+	for i, idx := range indexes {
+		names[i] = idx.Name
+	}
+	expect(t, "ListIndexes() names", strings.Join(names, ","), strings.Join(want, ","))
+	col, err := s.client.GetCollection(ctx, name)
+	if err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	if col.Indexes != len(want) {
+		t.Errorf("GetCollection().Indexes = %d, want %d", col.Indexes, len(want))
+	}
+}
+
+func (s *suite) btreeIndex(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+	s.seed(t, ctx, name,
+		map[string]any{"id": "c", "age": 30, "team": "red"},
+		map[string]any{"id": "a", "age": 10, "team": "red"},
+		map[string]any{"id": "d", "age": 40, "team": "blue"},
+		map[string]any{"id": "b", "age": 20, "team": "blue"},
+	)
+	if _, err := s.client.CreateIndex(ctx, name, &inceptiondb.CreateIndexRequest{
+		Name:    "by-age",
+		Type:    "btree",
+		Options: map[string]any{"fields": []string{"age"}},
+	}); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+	s.checkIndexes(t, ctx, name, "by-age")
+
+	q := inceptiondb.QueryOptions{Mode: "btree", Index: "by-age", Limit: 10}
+	expect(t, "Find(btree) ids", field(s.find(t, ctx, name, q), "id"), "a,b,c,d")
+
+	q.Reverse = true
+	expect(t, "Find(btree, reverse) ids", field(s.find(t, ctx, name, q), "id"), "d,c,b,a")
+
+	q.Reverse = false
+	q.From = map[string]any{"age": 15}
+	q.To = map[string]any{"age": 35}
+	expect(t, "Find(btree, from, to) ids", field(s.find(t, ctx, name, q), "id"), "b,c")
+
+	q.From, q.To = nil, nil
+	q.Skip, q.Limit = 1, 2
+	expect(t, "Find(btree, skip, limit) ids", field(s.find(t, ctx, name, q), "id"), "b,c")
+
+	q.Skip, q.Limit = 0, 10
+	q.Filter = map[string]any{"team": "blue"}
+	expect(t, "Find(btree, filter) ids", field(s.find(t, ctx, name, q), "id"), "b,d")
+}
+
+func (s *suite) fullScan(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+	s.seed(t, ctx, name,
+		map[string]any{"id": "1", "kind": "x"},
+		map[string]any{"id": "2", "kind": "y"},
+		map[string]any{"id": "3", "kind": "x"},
+		map[string]any{"id": "4", "kind": "x"},
+	)
+
+	q := inceptiondb.QueryOptions{Mode: "fullscan", Filter: map[string]any{"kind": "x"}, Limit: 10}
+	expect(t, "Find(filter) ids", field(s.find(t, ctx, name, q), "id"), "1,3,4")
+	q.Skip = 1
+	expect(t, "Find(filter, skip) ids", field(s.find(t, ctx, name, q), "id"), "3,4")
+	q.Skip, q.Limit = 0, 2
+	expect(t, "Find(filter, limit) ids", field(s.find(t, ctx, name, q), "id"), "1,3")
+	expect(t, "Find(no match) ids", field(s.find(t, ctx, name, inceptiondb.QueryOptions{
+		Filter: map[string]any{"kind": "z"}, Limit: 10,
+	}), "id"), "")
+}
+
+func (s *suite) patch(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+	s.seed(t, ctx, name,
+		map[string]any{"id": "1", "state": "draft"},
+		map[string]any{"id": "2", "state": "draft"},
+		map[string]any{"id": "3", "state": "live"},
+	)
+
+	patched := collect(t, "Patch", func() (*inceptiondb.JSONStream, error) {
+		return s.client.Patch(ctx, name, &inceptiondb.PatchRequest{
+			QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"state": "draft"}, Limit: 1},
+			Patch:        map[string]any{"state": "review", "reviewer": "ana"},
+		})
+	})
+	expect(t, "Patch() ids", field(patched, "id"), "1")
+	expect(t, "Patch() reviewer", field(patched, "reviewer"), "ana")
+
+	all := s.find(t, ctx, name, inceptiondb.QueryOptions{Limit: 10})
+	expect(t, "states after Patch()", field(all, "state"), "review,draft,live")
+}
+
+func (s *suite) remove(t *testing.T) {
+	ctx := testContext(t)
+	name := s.newCollection(t, ctx)
+	s.seed(t, ctx, name,
+		map[string]any{"id": "1", "kind": "x"},
+		map[string]any{"id": "2", "kind": "y"},
+		map[string]any{"id": "3", "kind": "x"},
+	)
+
+	removed := collect(t, "Remove", func() (*inceptiondb.JSONStream, error) {
+		return s.client.Remove(ctx, name, &inceptiondb.RemoveRequest{
+			QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"kind": "x"}, Limit: 10},
+		})
+	})
+	expect(t, "Remove() ids", field(removed, "id"), "1,3")
+	expect(t, "ids after Remove()", field(s.find(t, ctx, name, inceptiondb.QueryOptions{Limit: 10}), "id"), "2")
+
+	col, err := s.client.GetCollection(ctx, name)
+	if err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	if col.Total != 1 {
+		t.Errorf("GetCollection().Total = %d, want 1", col.Total)
+	}
+}
+
+func (s *suite) errors(t *testing.T) {
+	ctx := testContext(t)
+	missing := s.prefix + "-missing"
+	if _, err := s.client.GetCollection(ctx, missing); !isStatus(err, 400) {
+		t.Errorf("GetCollection(missing) error = %v, want a 4xx *inceptiondb.Error", err)
+	}
+
+	name := s.newCollection(t, ctx)
+	if _, err := s.client.GetIndex(ctx, name, "missing"); err == nil {
+		t.Error("GetIndex(missing) error = nil")
+	}
+	var apiErr *inceptiondb.Error
+	_, err := s.client.CreateCollection(ctx, &inceptiondb.CreateCollectionRequest{Name: name})
+	if !errors.As(err, &apiErr) || apiErr.Message == "" {
+		t.Errorf("CreateCollection(existing) error = %v, want *inceptiondb.Error with a message", err)
+	}
+}
+
+// isStatus reports whether err is an *inceptiondb.Error with a status in the
+// class of status (4xx for 400).
+func isStatus(err error, status int) bool {
+	var apiErr *inceptiondb.Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode/100 == status/100
+}
@@ -0,0 +1,24 @@
+package conformance
+
+import (
+	"os"
+	"testing"
+
+	"inceptiondb/inceptiondbtest"
+)
+
+func TestFake(t *testing.T) {
+	server := inceptiondbtest.NewServer()
+	defer server.Close()
+	Run(t, server.URL)
+}
+
+// TestServer runs the suite against a real server, e.g.
+// INCEPTIONDB_URL=http://localhost:8080 go test ./conformance.
+func TestServer(t *testing.T) {
+	url := os.Getenv("INCEPTIONDB_URL")
+	if url == "" {
+		t.Skip("INCEPTIONDB_URL not set")
+	}
+	Run(t, url)
+}
@@ -0,0 +1,235 @@
+package inceptiondb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Role describes what an endpoint is used for.
+type Role int
+
+const (
+	// RolePrimary endpoints receive writes, and reads when no follower is
+	// healthy.
+	RolePrimary Role = iota
+	// RoleFollower endpoints are read-only replicas that serve reads.
+	RoleFollower
+)
+
+func (r Role) String() string {
+	switch r {
+	case RolePrimary:
+		return "primary"
+	case RoleFollower:
+		return "follower"
+	default:
+		return fmt.Sprintf("Role(%d)", int(r))
+	}
+}
+
+// Endpoint is an additional server the client can talk to.
+type Endpoint struct {
+	URL  string
+	Role Role
+}
+
+// EndpointStatus reports the health of an endpoint.
+type EndpointStatus struct {
+	URL     string
+	Role    Role
+	Healthy bool
+}
+
+// WithEndpoints registers additional servers next to the base URL, which is
+// always the first primary. Reads (ListCollections, GetCollection,
+// ListIndexes, GetIndex, Size and Find) are spread across healthy followers and
+// fall back to the primaries; everything else goes to the first healthy
+// primary. An endpoint is marked unhealthy when a request to it fails at the
+// transport level or gets a 5xx response, by calls and health checks alike.
+// Reads are retried on the next endpoint after transport failures, writes are
+// not, since they may have reached the server.
+func WithEndpoints(endpoints ...Endpoint) Option {
+	return func(c *Client) {
+		c.extraEndpoints = append(c.extraEndpoints, endpoints...)
+	}
+}
+
+// WithHealthCheck probes every endpoint with a ListCollections request each
+// interval and updates its health accordingly. Call Close to stop it.
+func WithHealthCheck(interval time.Duration) Option {
+	return func(c *Client) {
+		c.healthInterval = interval
+	}
+}
+
+// Endpoints returns the endpoints known by the client and their health.
+func (c *Client) Endpoints() []EndpointStatus {
+	out := make([]EndpointStatus, len(c.endpoints))
+	for i, ep := range c.endpoints {
+		out[i] = EndpointStatus{URL: ep.url.String(), Role: ep.role, Healthy: ep.healthy.Load()}
+	}
+	return out
+}
+
+// Close stops the background health checks. The client must not be used
+// afterwards.
+func (c *Client) Close() error {
+	c.closeOnce.Do(func() {
+		if c.stopHealth != nil {
+			close(c.stopHealth)
+			c.healthWG.Wait()
+		}
+	})
+	return nil
+}
+
+type endpoint struct {
+	url     *url.URL
+	role    Role
+	healthy atomic.Bool
+	// plainBodies is set once the endpoint rejects compressed bodies.
+	plainBodies atomic.Bool
+}
+
+var readOperations = map[string]bool{
+	"listCollections": true,
+	"getCollection":   true,
+	"listIndexes":     true,
+	"getIndex":        true,
+	"size":            true,
+	"find":            true,
+}
+
+func parseBaseURL(baseURL string) (*url.URL, error) {
+	if strings.TrimSpace(baseURL) == "" {
+		return nil, errors.New("base URL is required")
+	}
+
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("parse base url: %w", err)
+	}
+	if parsed.Scheme == "" {
+		return nil, errors.New("base URL must include the scheme (http or https)")
+	}
+	if parsed.Host == "" {
+		return nil, errors.New("base URL must include the host")
+	}
+	return parsed, nil
+}
+
+// observe marks the endpoint healthy or not after a request to it: transport
+// failures and 5xx responses are unhealthy, any other response healthy.
+func (ep *endpoint) observe(resp *http.Response, err error) {
+	ep.healthy.Store(err == nil && resp.StatusCode < http.StatusInternalServerError)
+}
+
+func newEndpoint(u *url.URL, role Role) *endpoint {
+	ep := &endpoint{url: u, role: role}
+	ep.healthy.Store(true)
+	return ep
+}
+
+// endpointsFor returns the endpoints to try, in order, for operation op.
+// Healthy endpoints come first; unhealthy ones are kept as a last resort so a
+// request is always attempted.
+func (c *Client) endpointsFor(op string) []*endpoint {
+	if len(c.endpoints) == 1 {
+		return c.endpoints
+	}
+
+	var followers, primaries []*endpoint
+	for _, ep := range c.endpoints {
+		if ep.role == RoleFollower {
+			followers = append(followers, ep)
+		} else {
+			primaries = append(primaries, ep)
+		}
+	}
+
+	var ordered []*endpoint
+	if readOperations[op] && len(followers) > 0 {
+		offset := int(c.nextFollower.Add(1)) % len(followers)
+		ordered = append(ordered, followers[offset:]...)
+		ordered = append(ordered, followers[:offset]...)
+	}
+	ordered = append(ordered, primaries...)
+
+	healthy := make([]*endpoint, 0, len(ordered))
+	var unhealthy []*endpoint
+	for _, ep := range ordered {
+		if ep.healthy.Load() {
+			healthy = append(healthy, ep)
+		} else {
+			unhealthy = append(unhealthy, ep)
+		}
+	}
+	return append(healthy, unhealthy...)
+}
+
+// rewind prepares body to be sent again, reporting false when it cannot be.
+func rewind(body io.Reader) bool {
+	if body == nil {
+		return true
+	}
+	seeker, ok := body.(io.Seeker)
+	if !ok {
+		return false
+	}
+	_, err := seeker.Seek(0, io.SeekStart)
+	return err == nil
+}
+
+func (c *Client) startHealthChecks() {
+	if c.healthInterval <= 0 {
+		return
+	}
+	c.stopHealth = make(chan struct{})
+	c.healthWG.Add(1)
+	go func() {
+		defer c.healthWG.Done()
+		ticker := time.NewTicker(c.healthInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-c.stopHealth:
+				return
+			case <-ticker.C:
+				c.checkHealth()
+			}
+		}
+	}()
+}
+
+func (c *Client) checkHealth() {
+	var wg sync.WaitGroup
+	for _, ep := range c.endpoints {
+		wg.Add(1)
+		go func(ep *endpoint) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), c.healthInterval)
+			defer cancel()
+			target := ep.url.ResolveReference(&url.URL{Path: "/v1/collections"})
+			req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+			if err != nil {
+				return
+			}
+			resp, err := c.httpClient.Do(req)
+			ep.observe(resp, err)
+			if err != nil {
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}(ep)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,131 @@
+package inceptiondb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newRoleServer(t *testing.T, name string, hits map[string]*atomic.Int32) *httptest.Server {
+	t.Helper()
+	hits[name] = &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits[name].Add(1)
+		w.Write([]byte("{\"server\":\"" + name + "\"}\n"))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestEndpointRouting(t *testing.T) {
+	hits := map[string]*atomic.Int32{}
+	primary := newRoleServer(t, "primary", hits)
+	follower := newRoleServer(t, "follower", hits)
+
+	client, err := NewClient(primary.URL, WithEndpoints(Endpoint{URL: follower.URL, Role: RoleFollower}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	find := func() string {
+		t.Helper()
+		stream, err := client.Find(ctx, "items", nil)
+		if err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		var doc struct{ Server string }
+		if err := stream.Next(&doc); err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		stream.Close()
+		return doc.Server
+	}
+
+	if got := find(); got != "follower" {
+		t.Fatalf("Find() served by %s, want follower", got)
+	}
+	stream, err := client.InsertDocuments(ctx, "items", map[string]any{"id": 1})
+	if err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	stream.Close()
+	if got := hits["primary"].Load(); got != 1 {
+		t.Fatalf("primary hits = %d, want 1", got)
+	}
+
+	follower.Close()
+	if got := find(); got != "primary" {
+		t.Fatalf("Find() served by %s after follower failure, want primary", got)
+	}
+	if status := client.Endpoints(); status[1].Healthy {
+		t.Fatalf("Endpoints() = %+v, want follower unhealthy", status)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithHealthCheck(5*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	waitHealthy := func(want bool) {
+		t.Helper()
+		deadline := time.Now().Add(time.Second)
+		for client.Endpoints()[0].Healthy != want {
+			if time.Now().After(deadline) {
+				t.Fatalf("endpoint healthy = %v, want %v", !want, want)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	failing.Store(true)
+	waitHealthy(false)
+	failing.Store(false)
+	waitHealthy(true)
+}
+
+func TestServerErrorMarksEndpointUnhealthy(t *testing.T) {
+	var failing atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing.Store(true)
+	if _, err := client.ListCollections(context.Background()); err == nil {
+		t.Fatal("ListCollections() expected error")
+	}
+	if client.Endpoints()[0].Healthy {
+		t.Fatal("endpoint healthy after a 500 response")
+	}
+	failing.Store(false)
+	if _, err := client.ListCollections(context.Background()); err != nil {
+		t.Fatalf("ListCollections() error = %v", err)
+	}
+	if !client.Endpoints()[0].Healthy {
+		t.Fatal("endpoint unhealthy after a successful response")
+	}
+}
@@ -2,6 +2,7 @@ package inceptiondb
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -16,6 +17,8 @@ type Error struct {
 	Message     string
 	Description string
 	Body        []byte
+	// Timings is set when the client was configured with WithTimings.
+	Timings *Timings
 }
 
 func (e *Error) Error() string {
@@ -35,6 +38,14 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("inceptiondb: %s: %s", status, e.Message)
 }
 
+// IsConflict reports whether err is an *Error with status 409 Conflict, as
+// returned for a collection or index that already exists or a document that
+// breaks a unique index.
+func IsConflict(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
 func parseErrorResponse(resp *http.Response) error {
 	data, err := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
 	if err != nil {
@@ -0,0 +1,367 @@
+// Package inceptiondbmock provides a programmable implementation of
+// inceptiondb.API for unit tests.
+//
+// Expectations are registered with On, naming the method and the arguments
+// that follow the context, and answered with Return using the method's result
+// types:
+//
+//	m := inceptiondbmock.New()
+//	m.On("GetCollection", "users").Return(&inceptiondb.Collection{Name: "users"}, nil)
+//	m.On("Find", "users", inceptiondbmock.Any).ReturnStream(map[string]any{"id": "1"})
+//
+//	svc := NewService(m) // accepts an inceptiondb.API
+//	...
+//	m.AssertExpectations(t)
+package inceptiondbmock
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sync"
+
+	"inceptiondb"
+)
+
+// ErrUnexpectedCall is returned by calls that match no expectation.
+var ErrUnexpectedCall = errors.New("inceptiondbmock: unexpected call")
+
+// Any matches any argument value.
+var Any = anyValue{}
+
+type anyValue struct{}
+
+// TB is the subset of testing.TB used by the mock.
+type TB interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// Call is a recorded method invocation. Args excludes the context.
+type Call struct {
+	Method string
+	Args   []any
+}
+
+// Mock implements inceptiondb.API. The zero value is a mock without
+// expectations, ready to use.
+type Mock struct {
+	mu           sync.Mutex
+	expectations []*Expectation
+	calls        []Call
+	unexpected   []Call
+}
+
+var _ inceptiondb.API = (*Mock)(nil)
+
+// New returns a mock without expectations, like new(Mock).
+func New() *Mock {
+	return &Mock{}
+}
+
+// Expectation describes how the mock answers matching calls.
+type Expectation struct {
+	method string
+	args   []any
+	values []any
+	docs   []any
+	stream bool
+	run    func(args []any)
+	times  int
+	calls  int
+}
+
+// On registers an expectation for method called with args. Arguments are
+// compared with reflect.DeepEqual unless they are Any. Expectations are
+// matched in registration order.
+func (m *Mock) On(method string, args ...any) *Expectation {
+	e := &Expectation{method: method, args: args}
+	m.mu.Lock()
+	m.expectations = append(m.expectations, e)
+	m.mu.Unlock()
+	return e
+}
+
+// Return sets the values returned by matching calls, in the order of the
+// method's results. Missing values are zero.
+func (e *Expectation) Return(values ...any) *Expectation {
+	e.values = values
+	return e
+}
+
+// ReturnStream makes a stream method return a new stream with docs encoded as
+// JSON Lines on every matching call, and a nil error.
+func (e *Expectation) ReturnStream(docs ...any) *Expectation {
+	e.stream = true
+	e.docs = docs
+	return e
+}
+
+// Times limits how many calls the expectation answers. By default it answers
+// any number of calls and AssertExpectations requires at least one.
+func (e *Expectation) Times(n int) *Expectation {
+	e.times = n
+	return e
+}
+
+// Run calls fn with the arguments of every matching call before returning.
+func (e *Expectation) Run(fn func(args []any)) *Expectation {
+	e.run = fn
+	return e
+}
+
+// Calls returns the recorded calls, in order.
+func (m *Mock) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// CallsTo returns the recorded calls to method.
+func (m *Mock) CallsTo(method string) []Call {
+	var out []Call
+	for _, c := range m.Calls() {
+		if c.Method == method {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// AssertExpectations reports expectations that were not called the expected
+// number of times and calls that matched no expectation.
+func (m *Mock) AssertExpectations(t TB) {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.expectations {
+		switch {
+		case e.times > 0 && e.calls != e.times:
+			t.Errorf("inceptiondbmock: %s%v called %d times, want %d", e.method, e.args, e.calls, e.times)
+		case e.times == 0 && e.calls == 0:
+			t.Errorf("inceptiondbmock: %s%v was not called", e.method, e.args)
+		}
+	}
+	for _, c := range m.unexpected {
+		t.Errorf("inceptiondbmock: unexpected call %s%v", c.Method, c.Args)
+	}
+}
+
+// called records the call and returns the result values of the matching
+// expectation.
+func (m *Mock) called(method string, args ...any) ([]any, error) {
+	m.mu.Lock()
+	call := Call{Method: method, Args: args}
+	m.calls = append(m.calls, call)
+	var match *Expectation
+	for _, e := range m.expectations {
+		if e.method == method && (e.times == 0 || e.calls < e.times) && matchArgs(e.args, args) {
+			match = e
+			break
+		}
+	}
+	if match == nil {
+		m.unexpected = append(m.unexpected, call)
+		m.mu.Unlock()
+		return nil, fmt.Errorf("%w: %s%v", ErrUnexpectedCall, method, args)
+	}
+	match.calls++
+	m.mu.Unlock()
+
+	if match.run != nil {
+		match.run(args)
+	}
+	if match.stream {
+		stream, err := newStream(match.docs)
+		return []any{stream, err}, nil
+	}
+	return match.values, nil
+}
+
+func matchArgs(want, got []any) bool {
+	if len(want) != len(got) {
+		return false
+	}
+	for i := range want {
+		if _, ok := want[i].(anyValue); ok {
+			continue
+		}
+		if !reflect.DeepEqual(want[i], got[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func newStream(docs []any) (*inceptiondb.JSONStream, error) {
+	buf := &bytes.Buffer{}
+	enc := json.NewEncoder(buf)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+	}
+	return inceptiondb.NewJSONStream(buf), nil
+}
+
+// value returns the i-th result as T, or the zero value.
+func value[T any](values []any, i int) T {
+	var zero T
+	if i >= len(values) || values[i] == nil {
+		return zero
+	}
+	v, ok := values[i].(T)
+	if !ok {
+		panic(fmt.Sprintf("inceptiondbmock: result %d is %T, want %T", i, values[i], zero))
+	}
+	return v
+}
+
+// ListCollections implements inceptiondb.API.
+func (m *Mock) ListCollections(ctx context.Context) ([]inceptiondb.Collection, error) {
+	values, err := m.called("ListCollections")
+	if err != nil {
+		return nil, err
+	}
+	return value[[]inceptiondb.Collection](values, 0), value[error](values, 1)
+}
+
+// CreateCollection implements inceptiondb.API.
+func (m *Mock) CreateCollection(ctx context.Context, req *inceptiondb.CreateCollectionRequest) (*inceptiondb.Collection, error) {
+	values, err := m.called("CreateCollection", req)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.Collection](values, 0), value[error](values, 1)
+}
+
+// GetCollection implements inceptiondb.API.
+func (m *Mock) GetCollection(ctx context.Context, collection string) (*inceptiondb.Collection, error) {
+	values, err := m.called("GetCollection", collection)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.Collection](values, 0), value[error](values, 1)
+}
+
+// DropCollection implements inceptiondb.API.
+func (m *Mock) DropCollection(ctx context.Context, collection string) error {
+	values, err := m.called("DropCollection", collection)
+	if err != nil {
+		return err
+	}
+	return value[error](values, 0)
+}
+
+// SetDefaults implements inceptiondb.API.
+func (m *Mock) SetDefaults(ctx context.Context, collection string, defaults map[string]any) (map[string]any, error) {
+	values, err := m.called("SetDefaults", collection, defaults)
+	if err != nil {
+		return nil, err
+	}
+	return value[map[string]any](values, 0), value[error](values, 1)
+}
+
+// ListIndexes implements inceptiondb.API.
+func (m *Mock) ListIndexes(ctx context.Context, collection string) ([]inceptiondb.Index, error) {
+	values, err := m.called("ListIndexes", collection)
+	if err != nil {
+		return nil, err
+	}
+	return value[[]inceptiondb.Index](values, 0), value[error](values, 1)
+}
+
+// CreateIndex implements inceptiondb.API.
+func (m *Mock) CreateIndex(ctx context.Context, collection string, req *inceptiondb.CreateIndexRequest) (*inceptiondb.Index, error) {
+	values, err := m.called("CreateIndex", collection, req)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.Index](values, 0), value[error](values, 1)
+}
+
+// GetIndex implements inceptiondb.API.
+func (m *Mock) GetIndex(ctx context.Context, collection, name string) (*inceptiondb.Index, error) {
+	values, err := m.called("GetIndex", collection, name)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.Index](values, 0), value[error](values, 1)
+}
+
+// DropIndex implements inceptiondb.API.
+func (m *Mock) DropIndex(ctx context.Context, collection, name string) error {
+	values, err := m.called("DropIndex", collection, name)
+	if err != nil {
+		return err
+	}
+	return value[error](values, 0)
+}
+
+// Size implements inceptiondb.API.
+func (m *Mock) Size(ctx context.Context, collection string) (map[string]any, error) {
+	values, err := m.called("Size", collection)
+	if err != nil {
+		return nil, err
+	}
+	return value[map[string]any](values, 0), value[error](values, 1)
+}
+
+// InsertStream implements inceptiondb.API. The reader is consumed and recorded
+// as a []byte argument.
+func (m *Mock) InsertStream(ctx context.Context, collection string, reader io.Reader) (*inceptiondb.JSONStream, error) {
+	var payload []byte
+	if reader != nil {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return nil, err
+		}
+		payload = data
+	}
+	values, err := m.called("InsertStream", collection, payload)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.JSONStream](values, 0), value[error](values, 1)
+}
+
+// InsertDocuments implements inceptiondb.API. The documents are recorded as a
+// single []any argument.
+func (m *Mock) InsertDocuments(ctx context.Context, collection string, documents ...any) (*inceptiondb.JSONStream, error) {
+	values, err := m.called("InsertDocuments", collection, documents)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.JSONStream](values, 0), value[error](values, 1)
+}
+
+// Find implements inceptiondb.API.
+func (m *Mock) Find(ctx context.Context, collection string, req *inceptiondb.FindRequest) (*inceptiondb.JSONStream, error) {
+	values, err := m.called("Find", collection, req)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.JSONStream](values, 0), value[error](values, 1)
+}
+
+// Patch implements inceptiondb.API.
+func (m *Mock) Patch(ctx context.Context, collection string, req *inceptiondb.PatchRequest) (*inceptiondb.JSONStream, error) {
+	values, err := m.called("Patch", collection, req)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.JSONStream](values, 0), value[error](values, 1)
+}
+
+// Remove implements inceptiondb.API.
+func (m *Mock) Remove(ctx context.Context, collection string, req *inceptiondb.RemoveRequest) (*inceptiondb.JSONStream, error) {
+	values, err := m.called("Remove", collection, req)
+	if err != nil {
+		return nil, err
+	}
+	return value[*inceptiondb.JSONStream](values, 0), value[error](values, 1)
+}
@@ -0,0 +1,75 @@
+package inceptiondbmock
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"inceptiondb"
+)
+
+type recordingTB struct {
+	errors []string
+}
+
+func (r *recordingTB) Helper() {}
+
+func (r *recordingTB) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, format)
+}
+
+func TestMock(t *testing.T) {
+	ctx := context.Background()
+	m := New()
+	m.On("GetCollection", "users").Return(&inceptiondb.Collection{Name: "users", Total: 2}, nil)
+	m.On("Find", "users", Any).ReturnStream(map[string]any{"id": 1}, map[string]any{"id": 2}).Times(2)
+	m.On("DropCollection", "users").Return(errors.New("boom"))
+
+	var api inceptiondb.API = m
+	col, err := api.GetCollection(ctx, "users")
+	if err != nil || col.Total != 2 {
+		t.Fatalf("GetCollection() = %+v, %v", col, err)
+	}
+	for i := 0; i < 2; i++ {
+		stream, err := api.Find(ctx, "users", &inceptiondb.FindRequest{})
+		if err != nil {
+			t.Fatalf("Find() error = %v", err)
+		}
+		var ids []int
+		if err := inceptiondb.Iterate(stream, func(doc *struct{ ID int }) error {
+			ids = append(ids, doc.ID)
+			return nil
+		}); err != nil || len(ids) != 2 {
+			t.Fatalf("Find() stream = %v, %v", ids, err)
+		}
+	}
+	if _, err := api.Find(ctx, "users", nil); !errors.Is(err, ErrUnexpectedCall) {
+		t.Fatalf("Find() third call error = %v, want ErrUnexpectedCall", err)
+	}
+
+	if got := len(m.CallsTo("Find")); got != 3 {
+		t.Fatalf("CallsTo(Find) = %d, want 3", got)
+	}
+
+	tb := &recordingTB{}
+	m.AssertExpectations(tb)
+	if len(tb.errors) != 2 {
+		t.Fatalf("AssertExpectations() reported %d errors, want 2 (DropCollection not called, unexpected Find)", len(tb.errors))
+	}
+}
+
+func TestMockZeroValue(t *testing.T) {
+	var m Mock
+	m.On("DropCollection", "users").Return(nil)
+	if err := m.DropCollection(context.Background(), "users"); err != nil {
+		t.Fatalf("DropCollection() error = %v", err)
+	}
+	if _, err := m.GetCollection(context.Background(), "users"); !errors.Is(err, ErrUnexpectedCall) {
+		t.Fatalf("GetCollection() error = %v, want ErrUnexpectedCall", err)
+	}
+	tb := &recordingTB{}
+	m.AssertExpectations(tb)
+	if len(tb.errors) != 1 {
+		t.Fatalf("AssertExpectations() reported %d errors, want 1 for the unexpected call", len(tb.errors))
+	}
+}
@@ -0,0 +1,663 @@
+// Package inceptiondbtest provides an in-memory fake of the InceptionDB HTTP
+// API for tests.
+//
+//	server := inceptiondbtest.NewServer()
+//	defer server.Close()
+//	client, err := inceptiondb.NewClient(server.URL)
+//
+// The fake implements collections, defaults (including "uuid()" generated
+// values), map and btree indexes, and the fullscan, unique and btree query
+// modes of find, patch and remove. It keeps no index structures: every query
+// scans the collection, which is fine for test-sized data.
+package inceptiondbtest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"inceptiondb"
+)
+
+const maxLine = 64 << 20
+
+// Handler is an http.Handler serving the InceptionDB API from memory. The zero
+// value is not usable; create handlers with NewHandler.
+type Handler struct {
+	mu          sync.Mutex
+	collections map[string]*collection
+	order       []string
+}
+
+type collection struct {
+	name     string
+	defaults map[string]any
+	docs     []map[string]any
+	indexes  []*inceptiondb.Index
+}
+
+// NewHandler returns an empty handler.
+func NewHandler() *Handler {
+	return &Handler{collections: map[string]*collection{}}
+}
+
+// NewServer starts an httptest.Server backed by a new Handler. Close it when
+// done.
+func NewServer() *httptest.Server {
+	return httptest.NewServer(NewHandler())
+}
+
+type apiError struct {
+	status      int
+	message     string
+	description string
+}
+
+func errorf(status int, format string, args ...any) *apiError {
+	return &apiError{status: status, message: fmt.Sprintf(format, args...)}
+}
+
+func writeError(w http.ResponseWriter, err *apiError) {
+	var payload struct {
+		Error struct {
+			Message     string `json:"message"`
+			Description string `json:"description,omitempty"`
+		} `json:"error"`
+	}
+	payload.Error.Message = err.message
+	payload.Error.Description = err.description
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(err.status)
+	json.NewEncoder(w).Encode(payload)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	rest, ok := strings.CutPrefix(r.URL.Path, "/v1/collections")
+	if !ok {
+		writeError(w, errorf(http.StatusNotFound, "not found"))
+		return
+	}
+	rest = strings.TrimPrefix(rest, "/")
+	if rest == "" {
+		switch r.Method {
+		case http.MethodGet:
+			h.listCollections(w)
+		case http.MethodPost:
+			h.createCollection(w, r)
+		default:
+			writeError(w, errorf(http.StatusMethodNotAllowed, "method not allowed"))
+		}
+		return
+	}
+
+	name, action := rest, ""
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		name, action = rest[:i], rest[i+1:]
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if action == "" {
+		if r.Method != http.MethodGet {
+			writeError(w, errorf(http.StatusMethodNotAllowed, "method not allowed"))
+			return
+		}
+		col, err := h.collection(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, col.info())
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, errorf(http.StatusMethodNotAllowed, "method not allowed"))
+		return
+	}
+
+	if action == "insert" {
+		h.insert(w, r, name)
+		return
+	}
+	col, err := h.collection(name)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	switch action {
+	case "dropCollection":
+		delete(h.collections, name)
+		for i, n := range h.order {
+			if n == name {
+				h.order = append(h.order[:i], h.order[i+1:]...)
+				break
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "setDefaults":
+		defaults := map[string]any{}
+		if err := decodeBody(r, &defaults); err != nil {
+			writeError(w, err)
+			return
+		}
+		col.defaults = defaults
+		writeJSON(w, http.StatusOK, defaults)
+	case "size":
+		data, _ := json.Marshal(col.docs)
+		writeJSON(w, http.StatusOK, map[string]any{"documents": len(col.docs), "memory": len(data)})
+	case "listIndexes":
+		indexes := col.indexes
+		if indexes == nil {
+			indexes = []*inceptiondb.Index{}
+		}
+		writeJSON(w, http.StatusOK, indexes)
+	case "createIndex":
+		h.createIndex(w, r, col)
+	case "getIndex", "dropIndex":
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := decodeBody(r, &req); err != nil {
+			writeError(w, err)
+			return
+		}
+		i := col.indexPosition(req.Name)
+		if i < 0 {
+			writeError(w, errorf(http.StatusNotFound, "index %q not found", req.Name))
+			return
+		}
+		if action == "getIndex" {
+			writeJSON(w, http.StatusOK, col.indexes[i])
+			return
+		}
+		col.indexes = append(col.indexes[:i], col.indexes[i+1:]...)
+		w.WriteHeader(http.StatusNoContent)
+	case "find", "patch", "remove":
+		h.query(w, r, col, action)
+	default:
+		writeError(w, errorf(http.StatusNotFound, "unknown action %q", action))
+	}
+}
+
+func (h *Handler) collection(name string) (*collection, *apiError) {
+	col, ok := h.collections[name]
+	if !ok {
+		return nil, errorf(http.StatusNotFound, "collection %q not found", name)
+	}
+	return col, nil
+}
+
+func (h *Handler) addCollection(name string) *collection {
+	col := &collection{name: name}
+	h.collections[name] = col
+	h.order = append(h.order, name)
+	return col
+}
+
+func (c *collection) info() inceptiondb.Collection {
+	return inceptiondb.Collection{Name: c.name, Total: len(c.docs), Indexes: len(c.indexes), Defaults: c.defaults}
+}
+
+func (c *collection) indexPosition(name string) int {
+	for i, idx := range c.indexes {
+		if idx.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func decodeBody(r *http.Request, v any) *apiError {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errorf(http.StatusBadRequest, "read body: %v", err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return errorf(http.StatusBadRequest, "decode body: %v", err)
+	}
+	return nil
+}
+
+func (h *Handler) listCollections(w http.ResponseWriter) {
+	out := make([]inceptiondb.Collection, 0, len(h.order))
+	for _, name := range h.order {
+		out = append(out, h.collections[name].info())
+	}
+	writeJSON(w, http.StatusOK, out)
+}
+
+func (h *Handler) createCollection(w http.ResponseWriter, r *http.Request) {
+	var req inceptiondb.CreateCollectionRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if req.Name == "" {
+		writeError(w, errorf(http.StatusBadRequest, "collection name is required"))
+		return
+	}
+	if _, ok := h.collections[req.Name]; ok {
+		writeError(w, errorf(http.StatusConflict, "collection %q already exists", req.Name))
+		return
+	}
+	col := h.addCollection(req.Name)
+	col.defaults = req.Defaults
+	writeJSON(w, http.StatusCreated, col.info())
+}
+
+func (h *Handler) createIndex(w http.ResponseWriter, r *http.Request, col *collection) {
+	var idx inceptiondb.Index
+	if err := decodeBody(r, &idx); err != nil {
+		writeError(w, err)
+		return
+	}
+	if idx.Name == "" {
+		writeError(w, errorf(http.StatusBadRequest, "index name is required"))
+		return
+	}
+	if col.indexPosition(idx.Name) >= 0 {
+		writeError(w, errorf(http.StatusConflict, "index %q already exists", idx.Name))
+		return
+	}
+	switch idx.Type {
+	case "map":
+		if _, ok := idx.Options["field"].(string); !ok {
+			writeError(w, errorf(http.StatusBadRequest, "map index requires a field"))
+			return
+		}
+	case "btree":
+		if len(indexFields(&idx)) == 0 {
+			writeError(w, errorf(http.StatusBadRequest, "btree index requires fields"))
+			return
+		}
+	default:
+		writeError(w, errorf(http.StatusBadRequest, "unknown index type %q", idx.Type))
+		return
+	}
+	col.indexes = append(col.indexes, &idx)
+	if err := col.checkUnique(nil); err != nil {
+		col.indexes = col.indexes[:len(col.indexes)-1]
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, idx)
+}
+
+// indexFields returns the fields of a btree index, with a "-" prefix for
+// descending ones.
+func indexFields(idx *inceptiondb.Index) []string {
+	var fields []string
+	if list, ok := idx.Options["fields"].([]any); ok {
+		for _, f := range list {
+			if name, ok := f.(string); ok {
+				fields = append(fields, name)
+			}
+		}
+	}
+	if field, ok := idx.Options["field"].(string); ok && len(fields) == 0 {
+		fields = []string{field}
+	}
+	return fields
+}
+
+// checkUnique reports map index and unique btree index conflicts between the
+// stored documents and extra.
+func (c *collection) checkUnique(extra map[string]any) *apiError {
+	for _, idx := range c.indexes {
+		unique, _ := idx.Options["unique"].(bool)
+		if idx.Type != "map" && !unique {
+			continue
+		}
+		seen := map[string]bool{}
+		docs := c.docs
+		if extra != nil {
+			docs = append(docs[:len(docs):len(docs)], extra)
+		}
+		for _, doc := range docs {
+			key, ok := indexKey(idx, doc)
+			if !ok {
+				continue
+			}
+			if seen[key] {
+				return errorf(http.StatusConflict, "index %q conflict for %s", idx.Name, key)
+			}
+			seen[key] = true
+		}
+	}
+	return nil
+}
+
+func indexKey(idx *inceptiondb.Index, doc map[string]any) (string, bool) {
+	if idx.Type == "map" {
+		field, _ := idx.Options["field"].(string)
+		v, ok := doc[field]
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprint(v), true
+	}
+	var parts []string
+	for _, field := range indexFields(idx) {
+		v, ok := doc[strings.TrimPrefix(field, "-")]
+		if !ok {
+			return "", false
+		}
+		data, _ := json.Marshal(v)
+		parts = append(parts, string(data))
+	}
+	return strings.Join(parts, ","), true
+}
+
+func (h *Handler) insert(w http.ResponseWriter, r *http.Request, name string) {
+	col, ok := h.collections[name]
+	if !ok {
+		col = h.addCollection(name)
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	scanner := bufio.NewScanner(r.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLine)
+	wrote := false
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		doc := map[string]any{}
+		if err := json.Unmarshal(line, &doc); err != nil {
+			if !wrote {
+				writeError(w, errorf(http.StatusBadRequest, "decode document: %v", err))
+			}
+			return
+		}
+		for k, v := range col.defaults {
+			if _, ok := doc[k]; ok {
+				continue
+			}
+			if v == "uuid()" {
+				v = newUUID()
+			}
+			doc[k] = v
+		}
+		if err := col.checkUnique(doc); err != nil {
+			if !wrote {
+				writeError(w, err)
+			}
+			return
+		}
+		col.docs = append(col.docs, doc)
+		enc.Encode(doc)
+		wrote = true
+	}
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+type queryRequest struct {
+	inceptiondb.QueryOptions
+	Patch map[string]any `json:"patch"`
+}
+
+func (h *Handler) query(w http.ResponseWriter, r *http.Request, col *collection, action string) {
+	var req queryRequest
+	if err := decodeBody(r, &req); err != nil {
+		writeError(w, err)
+		return
+	}
+	positions, err := col.match(req.QueryOptions)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	switch action {
+	case "find":
+		for _, i := range positions {
+			enc.Encode(col.docs[i])
+		}
+	case "patch":
+		for _, i := range positions {
+			doc := col.docs[i]
+			for k, v := range req.Patch {
+				doc[k] = v
+			}
+			enc.Encode(doc)
+		}
+	case "remove":
+		removed := map[int]bool{}
+		for _, i := range positions {
+			removed[i] = true
+			enc.Encode(col.docs[i])
+		}
+		kept := col.docs[:0]
+		for i, doc := range col.docs {
+			if !removed[i] {
+				kept = append(kept, doc)
+			}
+		}
+		col.docs = kept
+	}
+}
+
+// match returns the positions of the documents selected by the query, in
+// result order.
+func (c *collection) match(q inceptiondb.QueryOptions) ([]int, *apiError) {
+	var candidates []int
+	switch q.Mode {
+	case "", "fullscan":
+		for i := range c.docs {
+			candidates = append(candidates, i)
+		}
+		if q.Reverse {
+			for l, r := 0, len(candidates)-1; l < r; l, r = l+1, r-1 {
+				candidates[l], candidates[r] = candidates[r], candidates[l]
+			}
+		}
+	case "unique":
+		i := c.indexPosition(q.Index)
+		if i < 0 {
+			return nil, errorf(http.StatusBadRequest, "index %q not found", q.Index)
+		}
+		idx := c.indexes[i]
+		if idx.Type != "map" {
+			return nil, errorf(http.StatusBadRequest, "index %q is not a map index", q.Index)
+		}
+		for pos, doc := range c.docs {
+			if key, ok := indexKey(idx, doc); ok && key == q.Value {
+				candidates = append(candidates, pos)
+				break
+			}
+		}
+	case "btree":
+		i := c.indexPosition(q.Index)
+		if i < 0 {
+			return nil, errorf(http.StatusBadRequest, "index %q not found", q.Index)
+		}
+		idx := c.indexes[i]
+		if idx.Type != "btree" {
+			return nil, errorf(http.StatusBadRequest, "index %q is not a btree index", q.Index)
+		}
+		candidates = c.btreeScan(indexFields(idx), q)
+	default:
+		return nil, errorf(http.StatusBadRequest, "unknown mode %q", q.Mode)
+	}
+
+	var out []int
+	skipped := int64(0)
+	for _, i := range candidates {
+		if !matchFilter(c.docs[i], q.Filter) {
+			continue
+		}
+		if skipped < q.Skip {
+			skipped++
+			continue
+		}
+		out = append(out, i)
+		if q.Limit > 0 && int64(len(out)) >= q.Limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+// btreeScan orders the documents holding every index field and keeps those
+// in the range [From, To), compared on the fields present in the bounds.
+func (c *collection) btreeScan(fields []string, q inceptiondb.QueryOptions) []int {
+	var positions []int
+	for i, doc := range c.docs {
+		complete := true
+		for _, field := range fields {
+			if _, ok := doc[strings.TrimPrefix(field, "-")]; !ok {
+				complete = false
+				break
+			}
+		}
+		if complete {
+			positions = append(positions, i)
+		}
+	}
+	sort.SliceStable(positions, func(a, b int) bool {
+		return compareDocs(fields, c.docs[positions[a]], c.docs[positions[b]]) < 0
+	})
+
+	var out []int
+	for _, i := range positions {
+		doc := c.docs[i]
+		if len(q.From) > 0 && compareBound(fields, doc, q.From) < 0 {
+			continue
+		}
+		if len(q.To) > 0 && compareBound(fields, doc, q.To) >= 0 {
+			continue
+		}
+		out = append(out, i)
+	}
+	if q.Reverse {
+		for l, r := 0, len(out)-1; l < r; l, r = l+1, r-1 {
+			out[l], out[r] = out[r], out[l]
+		}
+	}
+	return out
+}
+
+func compareDocs(fields []string, a, b map[string]any) int {
+	for _, field := range fields {
+		name := strings.TrimPrefix(field, "-")
+		cmp := compareValues(a[name], b[name])
+		if strings.HasPrefix(field, "-") {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// compareBound compares doc with a range bound on the index fields the bound
+// sets.
+func compareBound(fields []string, doc, bound map[string]any) int {
+	for _, field := range fields {
+		name := strings.TrimPrefix(field, "-")
+		v, ok := bound[name]
+		if !ok {
+			continue
+		}
+		cmp := compareValues(doc[name], v)
+		if strings.HasPrefix(field, "-") {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp
+		}
+	}
+	return 0
+}
+
+// compareValues orders JSON values: null first, then numbers, strings,
+// booleans and anything else by its encoding.
+func compareValues(a, b any) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch x := a.(type) {
+	case float64:
+		y := b.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, b.(string))
+	case bool:
+		y := b.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	}
+	da, _ := json.Marshal(a)
+	db, _ := json.Marshal(b)
+	return bytes.Compare(da, db)
+}
+
+func rank(v any) int {
+	switch v.(type) {
+	case nil:
+		return 0
+	case float64:
+		return 1
+	case string:
+		return 2
+	case bool:
+		return 3
+	}
+	return 4
+}
+
+func matchFilter(doc, filter map[string]any) bool {
+	for k, v := range filter {
+		if !reflect.DeepEqual(doc[k], v) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package inceptiondbtest
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"inceptiondb"
+)
+
+func TestMapIndexConflict(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	client, err := inceptiondb.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stream, err := client.InsertDocuments(ctx, "users", map[string]any{"id": "1"})
+	if err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	stream.Close()
+	if _, err := client.CreateIndex(ctx, "users", &inceptiondb.CreateIndexRequest{
+		Name: "by-id", Type: "map", Options: map[string]any{"field": "id"},
+	}); err != nil {
+		t.Fatalf("CreateIndex() error = %v", err)
+	}
+
+	_, err = client.InsertDocuments(ctx, "users", map[string]any{"id": "1"})
+	var apiErr *inceptiondb.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Fatalf("InsertDocuments(duplicate) error = %v, want 409", err)
+	}
+	col, err := client.GetCollection(ctx, "users")
+	if err != nil || col.Total != 1 {
+		t.Fatalf("GetCollection() = %+v, %v; want 1 document", col, err)
+	}
+}
@@ -0,0 +1,289 @@
+package inceptiondb
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// call tracks a single HTTP exchange from the moment it is sent until its
+// response body is closed, so streamed responses are measured to the end.
+type call struct {
+	ctx        context.Context
+	op         string
+	collection string
+	method     string
+	path       string
+	start      time.Time
+
+	status   int
+	sent     atomic.Int64
+	received atomic.Int64
+	stream   bool
+	items    atomic.Int64
+	err      error
+	duration time.Duration
+
+	captureLimit int
+	header       http.Header
+	reqBody      *cappedBuffer
+	respBody     *cappedBuffer
+
+	span    Span
+	timer   *requestTimer
+	metrics Recorder
+	once    sync.Once
+	finish  func(*call)
+}
+
+// newCall returns nil when the client has no instrumentation configured, so
+// requests are sent untouched.
+func (c *Client) newCall(ctx context.Context, method, path string) *call {
+	if c.logger == nil && c.metrics == nil && c.tracer == nil && !c.timings {
+		return nil
+	}
+	op, collection := operation(method, path)
+	var span Span
+	if c.tracer != nil {
+		ctx, span = c.tracer.StartSpan(ctx, op, collection)
+	}
+	var timer *requestTimer
+	if c.timings {
+		timer = newRequestTimer(op, collection)
+		ctx = httptrace.WithClientTrace(ctx, timer.clientTrace())
+	}
+	return &call{
+		timer:      timer,
+		span:       span,
+		metrics:    c.metrics,
+		ctx:        ctx,
+		op:         op,
+		collection: collection,
+		method:     method,
+		path:       path,
+		start:      time.Now(),
+
+		captureLimit: c.logger.captureLimit(),
+		finish:       c.finishCall,
+	}
+}
+
+func (c *Client) finishCall(cl *call) {
+	c.logger.log(cl)
+	if cl.timer != nil && c.onTimings != nil {
+		c.onTimings(cl.timer.snapshot())
+	}
+	if cl.span != nil {
+		cl.span.End(SpanResult{
+			Status:        cl.status,
+			Stream:        cl.stream,
+			Items:         cl.items.Load(),
+			BytesSent:     cl.sent.Load(),
+			BytesReceived: cl.received.Load(),
+			Duration:      cl.duration,
+			Err:           cl.err,
+		})
+	}
+	if c.metrics != nil {
+		status := cl.status
+		if cl.err != nil && status < http.StatusBadRequest {
+			status = 0
+		}
+		c.metrics.ObserveRequest(cl.op, cl.collection, status, cl.duration)
+		c.metrics.ObserveBytes(DirectionSent, cl.sent.Load())
+		c.metrics.ObserveBytes(DirectionReceived, cl.received.Load())
+	}
+}
+
+// item counts an item read from a streamed response. It is reported to the
+// Recorder right away, so streams that are never closed are counted too.
+func (cl *call) item() {
+	if cl.items.Add(1) == 1 && cl.timer != nil {
+		cl.timer.markFirstItem()
+	}
+	if cl.metrics != nil {
+		cl.metrics.ObserveStreamItems(cl.op, 1)
+	}
+}
+
+// wrapRequest records the request headers and counts (and optionally
+// captures) the request body. Compressed bodies are counted by countBody
+// before compression instead, so logs and metrics see the plain bytes.
+func (cl *call) wrapRequest(req *http.Request, compressed bool) {
+	if cl == nil {
+		return
+	}
+	cl.header = req.Header
+	if compressed {
+		return
+	}
+	cl.resetRequestBody()
+	if req.Body != nil && req.Body != http.NoBody {
+		req.Body = &countingBody{ReadCloser: req.Body, n: &cl.sent, capture: cl.reqBody}
+	}
+}
+
+// countBody counts (and optionally captures) a request body that is
+// compressed before being sent.
+func (cl *call) countBody(body io.Reader) io.Reader {
+	if cl == nil {
+		return body
+	}
+	cl.resetRequestBody()
+	return &countingBody{ReadCloser: io.NopCloser(body), n: &cl.sent, capture: cl.reqBody}
+}
+
+func (cl *call) resetRequestBody() {
+	if cl.captureLimit > 0 {
+		cl.reqBody = &cappedBuffer{limit: cl.captureLimit}
+	}
+}
+
+// wrapResponse counts (and optionally captures) the response body and
+// completes the call when the body is closed.
+func (cl *call) wrapResponse(resp *http.Response) {
+	if cl == nil {
+		return
+	}
+	cl.status = resp.StatusCode
+	if cl.captureLimit > 0 {
+		cl.respBody = &cappedBuffer{limit: cl.captureLimit}
+	}
+	resp.Body = &countingBody{ReadCloser: resp.Body, n: &cl.received, capture: cl.respBody, onClose: cl.done}
+}
+
+// fail completes the call with err.
+func (cl *call) fail(err error) {
+	if cl == nil {
+		return
+	}
+	cl.err = err
+	cl.done()
+}
+
+func (cl *call) done() {
+	if cl == nil {
+		return
+	}
+	cl.once.Do(func() {
+		cl.duration = time.Since(cl.start)
+		if cl.timer != nil {
+			cl.timer.markEnd()
+		}
+		cl.finish(cl)
+	})
+}
+
+// attachTimings makes the timings of the call available to the caller of a
+// failed request through TimingsFromError.
+func (cl *call) attachTimings(err error) error {
+	if cl == nil || cl.timer == nil {
+		return err
+	}
+	timings := cl.timer.snapshot()
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		apiErr.Timings = &timings
+		return err
+	}
+	return &timingsError{err: err, timings: timings}
+}
+
+type countingBody struct {
+	io.ReadCloser
+	n       *atomic.Int64
+	capture *cappedBuffer
+	onClose func()
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.n.Add(int64(n))
+	if b.capture != nil {
+		b.capture.Write(p[:n])
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	err := b.ReadCloser.Close()
+	if b.onClose != nil {
+		b.onClose()
+	}
+	return err
+}
+
+// cappedBuffer keeps the first limit bytes written to it. Request bodies are
+// written from the transport goroutine, hence the lock.
+type cappedBuffer struct {
+	mu        sync.Mutex
+	limit     int
+	data      []byte
+	truncated bool
+}
+
+func (b *cappedBuffer) snapshot() ([]byte, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.data...), b.truncated
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	room := b.limit - len(b.data)
+	if room < len(p) {
+		b.truncated = true
+		if room < 0 {
+			room = 0
+		}
+		b.data = append(b.data, p[:room]...)
+		return len(p), nil
+	}
+	b.data = append(b.data, p...)
+	return len(p), nil
+}
+
+// Operation returns the API operation name and the collection of a request
+// sent by a Client, e.g. "find" and "items" for a POST to
+// "/v1/collections/items:find". Transports wrapping the client's can use it to
+// tell operations apart.
+func Operation(req *http.Request) (op, collection string) {
+	return operation(req.Method, req.URL.Path)
+}
+
+// operation derives the API operation name and the collection from a request
+// path, e.g. "find" and "items" for "/v1/collections/items:find".
+func operation(method, path string) (string, string) {
+	const prefix = "/v1/collections"
+	rest, ok := strings.CutPrefix(path, prefix)
+	if !ok {
+		return strings.ToLower(method), ""
+	}
+	if rest == "" || rest == "/" {
+		if method == http.MethodPost {
+			return "createCollection", ""
+		}
+		return "listCollections", ""
+	}
+	rest = strings.TrimPrefix(rest, "/")
+	name, action := rest, ""
+	i := strings.LastIndex(rest, ":")
+	if i >= 0 {
+		name, action = rest[:i], rest[i+1:]
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		name = unescaped
+	}
+	if i < 0 {
+		return "getCollection", name
+	}
+	return action, name
+}
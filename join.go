@@ -0,0 +1,303 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// JoinType selects what Join does with left documents that have no match.
+type JoinType int
+
+const (
+	// InnerJoin drops left documents without a matching right document.
+	InnerJoin JoinType = iota
+	// LeftJoin keeps them, with null as the right document.
+	LeftJoin
+)
+
+// JoinOptions configures a Join.
+type JoinOptions struct {
+	// Field is the path of the left document field holding the foreign key,
+	// with dots separating the keys of nested objects.
+	Field string
+	// Collection is the right collection.
+	Collection string
+	// Index is the map index of Collection the foreign keys are looked up in.
+	Index string
+	// As is the field of the joined documents holding the right document.
+	// Defaults to Collection.
+	As string
+	// Type is InnerJoin or LeftJoin.
+	Type JoinType
+	// BatchSize is the number of left documents whose keys are looked up
+	// together. Defaults to 100.
+	BatchSize int
+	// Concurrency is the number of lookups sent at once. Defaults to 8.
+	Concurrency int
+	// CacheSize is the number of lookup results, matches and misses alike,
+	// remembered across batches. Zero only shares lookups within a batch.
+	CacheSize int
+}
+
+// Join streams the documents of collection matching req, each with the right
+// document its Field refers to added under As. Left documents are read in
+// batches; the distinct keys of a batch that are not cached are looked up in
+// the right collection with unique Find requests on Index, and the joined
+// documents are written to the returned stream in left order.
+//
+// Lookups use ctx, which must stay alive while the stream is read. A failed
+// lookup ends the stream with its error.
+func (c *Client) Join(ctx context.Context, collection string, req *FindRequest, opts JoinOptions) (*JSONStream, error) {
+	if opts.Field == "" {
+		return nil, errors.New("join field is required")
+	}
+	if opts.Collection == "" {
+		return nil, errors.New("join collection is required")
+	}
+	if opts.Index == "" {
+		return nil, errors.New("join index is required")
+	}
+	if opts.As == "" {
+		opts.As = opts.Collection
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 100
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 8
+	}
+
+	left, err := c.Find(ctx, collection, req)
+	if err != nil {
+		return nil, err
+	}
+	body := &joinBody{
+		ctx:    ctx,
+		client: c,
+		opts:   opts,
+		left:   left,
+		cache:  &joinCache{size: opts.CacheSize, lru: list.New(), entries: map[string]*list.Element{}},
+	}
+	return newJSONStream(&http.Response{StatusCode: http.StatusOK, Body: body}, c.codec), nil
+}
+
+type joinBody struct {
+	ctx      context.Context
+	client   *Client
+	opts     JoinOptions
+	left     *JSONStream
+	leftDone bool
+	cache    *joinCache
+	buf      bytes.Buffer
+	err      error
+}
+
+func (b *joinBody) Read(p []byte) (int, error) {
+	for b.buf.Len() == 0 {
+		if b.err != nil {
+			return 0, b.err
+		}
+		b.err = b.fill()
+	}
+	return b.buf.Read(p)
+}
+
+func (b *joinBody) Close() error {
+	return b.left.Close()
+}
+
+// fill joins the next batch of left documents into buf.
+func (b *joinBody) fill() error {
+	if b.leftDone {
+		return io.EOF
+	}
+	type leftDoc struct {
+		fields map[string]json.RawMessage
+		key    string
+		hasKey bool
+	}
+	var batch []leftDoc
+	for len(batch) < b.opts.BatchSize {
+		var raw json.RawMessage
+		if err := b.left.Next(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				b.leftDone = true
+				break
+			}
+			return err
+		}
+		var doc leftDoc
+		if err := json.Unmarshal(raw, &doc.fields); err != nil {
+			return fmt.Errorf("join: decode left document: %w", err)
+		}
+		doc.key, doc.hasKey = joinKey(doc.fields, b.opts.Field)
+		batch = append(batch, doc)
+	}
+
+	found := map[string]json.RawMessage{}
+	var missing []string
+	for _, doc := range batch {
+		if !doc.hasKey {
+			continue
+		}
+		if _, ok := found[doc.key]; ok {
+			continue
+		}
+		if right, ok := b.cache.get(doc.key); ok {
+			found[doc.key] = right
+			continue
+		}
+		found[doc.key] = nil
+		missing = append(missing, doc.key)
+	}
+	if err := b.lookup(missing, found); err != nil {
+		return err
+	}
+
+	for _, doc := range batch {
+		var right json.RawMessage
+		if doc.hasKey {
+			right = found[doc.key]
+		}
+		if right == nil {
+			if b.opts.Type == InnerJoin {
+				continue
+			}
+			right = json.RawMessage("null")
+		}
+		doc.fields[b.opts.As] = right
+		data, err := json.Marshal(doc.fields)
+		if err != nil {
+			return fmt.Errorf("join: encode document: %w", err)
+		}
+		b.buf.Write(data)
+		b.buf.WriteByte('\n')
+	}
+	if b.buf.Len() == 0 && b.leftDone {
+		return io.EOF
+	}
+	return nil
+}
+
+// lookup fetches the right documents of keys into found, leaving nil for
+// keys without a match, and caches the results.
+func (b *joinBody) lookup(keys []string, found map[string]json.RawMessage) error {
+	results := make([]json.RawMessage, len(keys))
+	errs := make([]error, len(keys))
+	sem := make(chan struct{}, b.opts.Concurrency)
+	var wg sync.WaitGroup
+	for i, key := range keys {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, key string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i], errs[i] = b.find(key)
+		}(i, key)
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+	for i, key := range keys {
+		found[key] = results[i]
+		b.cache.put(key, results[i])
+	}
+	return nil
+}
+
+func (b *joinBody) find(key string) (json.RawMessage, error) {
+	stream, err := b.client.Find(b.ctx, b.opts.Collection, &FindRequest{QueryOptions: QueryOptions{
+		Mode:  "unique",
+		Index: b.opts.Index,
+		Value: key,
+	}})
+	if err != nil {
+		return nil, fmt.Errorf("join: look up %q: %w", key, err)
+	}
+	defer stream.Close()
+	var doc json.RawMessage
+	if err := stream.Next(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("join: look up %q: %w", key, err)
+	}
+	return doc, nil
+}
+
+// joinKey returns the value at path in doc as an index value: strings as they
+// are, other values as their JSON text. Missing and null values have no key.
+func joinKey(doc map[string]json.RawMessage, path string) (string, bool) {
+	keys := strings.Split(path, ".")
+	raw, ok := doc[keys[0]]
+	for _, key := range keys[1:] {
+		if !ok {
+			break
+		}
+		var nested map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &nested); err != nil {
+			return "", false
+		}
+		raw, ok = nested[key]
+	}
+	if !ok {
+		return "", false
+	}
+	text := strings.TrimSpace(string(raw))
+	if text == "null" {
+		return "", false
+	}
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s, true
+	}
+	return text, true
+}
+
+// joinCache is an LRU of lookup results. It is only used by the goroutine
+// reading the join stream.
+type joinCache struct {
+	size    int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+type joinCacheEntry struct {
+	key string
+	doc json.RawMessage
+}
+
+func (c *joinCache) get(key string) (json.RawMessage, bool) {
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return elem.Value.(*joinCacheEntry).doc, true
+}
+
+func (c *joinCache) put(key string, doc json.RawMessage) {
+	if c.size <= 0 {
+		return
+	}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value.(*joinCacheEntry).doc = doc
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&joinCacheEntry{key: key, doc: doc})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(*joinCacheEntry).key)
+	}
+}
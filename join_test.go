@@ -0,0 +1,136 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type joinedOrder struct {
+	ID       string         `json:"id"`
+	Customer map[string]any `json:"customer"`
+}
+
+func newJoinServer(t *testing.T) (*memoryServer, *Client) {
+	server, client := newMemoryServer(t)
+	server.collections["orders"] = []map[string]any{
+		{"id": "o1", "customer_id": "c1"},
+		{"id": "o2", "customer_id": "c2"},
+		{"id": "o3", "customer_id": "c1"},
+		{"id": "o4", "customer_id": "c9"},
+		{"id": "o5"},
+		{"id": "o6", "customer_id": "c2"},
+	}
+	server.collections["customers"] = []map[string]any{
+		{"id": "c1", "name": "Ana"},
+		{"id": "c2", "name": "Bea"},
+	}
+	return server, client
+}
+
+func joinIDs(t *testing.T, stream *JSONStream) ([]string, []joinedOrder) {
+	t.Helper()
+	var ids []string
+	var orders []joinedOrder
+	err := Iterate(stream, func(order *joinedOrder) error {
+		ids = append(ids, order.ID)
+		orders = append(orders, *order)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Iterate() error = %v", err)
+	}
+	return ids, orders
+}
+
+func TestJoinInner(t *testing.T) {
+	server, client := newJoinServer(t)
+	stream, err := client.Join(context.Background(), "orders", &FindRequest{}, JoinOptions{
+		Field:      "customer_id",
+		Collection: "customers",
+		Index:      "id",
+		As:         "customer",
+		BatchSize:  4,
+	})
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	ids, orders := joinIDs(t, stream)
+	if want := []string{"o1", "o2", "o3", "o6"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("joined ids = %v, want %v", ids, want)
+	}
+	if orders[0].Customer["name"] != "Ana" || orders[1].Customer["name"] != "Bea" {
+		t.Fatalf("joined orders = %+v", orders)
+	}
+	// One find for orders, then c1, c2 and c9 for the first batch and c2
+	// again for the second, as there is no cache.
+	if server.requests != 5 {
+		t.Fatalf("requests = %d, want 5", server.requests)
+	}
+}
+
+func TestJoinLeftWithCache(t *testing.T) {
+	server, client := newJoinServer(t)
+	stream, err := client.Join(context.Background(), "orders", &FindRequest{}, JoinOptions{
+		Field:      "customer_id",
+		Collection: "customers",
+		Index:      "id",
+		As:         "customer",
+		Type:       LeftJoin,
+		BatchSize:  2,
+		CacheSize:  10,
+	})
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	ids, orders := joinIDs(t, stream)
+	if want := []string{"o1", "o2", "o3", "o4", "o5", "o6"}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("joined ids = %v, want %v", ids, want)
+	}
+	if orders[3].Customer != nil || orders[4].Customer != nil || orders[5].Customer["name"] != "Bea" {
+		t.Fatalf("joined orders = %+v", orders)
+	}
+	// One find for orders and one per distinct customer id.
+	if server.requests != 4 {
+		t.Fatalf("requests = %d, want 4", server.requests)
+	}
+}
+
+func TestJoinLookupError(t *testing.T) {
+	server, client := newJoinServer(t)
+	server.failOn = "customers:find"
+	stream, err := client.Join(context.Background(), "orders", &FindRequest{}, JoinOptions{
+		Field:      "customer_id",
+		Collection: "customers",
+		Index:      "id",
+	})
+	if err != nil {
+		t.Fatalf("Join() error = %v", err)
+	}
+	err = Iterate(stream, func(*joinedOrder) error { return nil })
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Iterate() error = %v, want the lookup error", err)
+	}
+}
+
+func TestJoinKey(t *testing.T) {
+	doc := map[string]json.RawMessage{
+		"s":    json.RawMessage(`"x"`),
+		"n":    json.RawMessage(`42`),
+		"null": json.RawMessage(`null`),
+		"o":    json.RawMessage(`{"id":"y"}`),
+	}
+	for path, want := range map[string]string{"s": "x", "n": "42", "o.id": "y"} {
+		if got, ok := joinKey(doc, path); !ok || got != want {
+			t.Errorf("joinKey(%q) = %q, %v; want %q", path, got, ok, want)
+		}
+	}
+	for _, path := range []string{"null", "missing", "o.missing", "s.x"} {
+		if _, ok := joinKey(doc, path); ok {
+			t.Errorf("joinKey(%q) found a key", path)
+		}
+	}
+}
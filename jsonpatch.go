@@ -0,0 +1,578 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const defaultKeyField = "id"
+
+// PatchOperation is a single RFC 6902 JSON Patch operation.
+type PatchOperation struct {
+	Op    string `json:"op"`
+	Path  string `json:"path"`
+	From  string `json:"from,omitempty"`
+	Value any    `json:"value"`
+}
+
+// MergePatchRequest describes an RFC 7386 JSON Merge Patch applied to the
+// documents matched by the query.
+type MergePatchRequest struct {
+	QueryOptions
+	Patch map[string]any
+	// Key identifies documents when the patch has to be applied with a
+	// read-modify-write cycle. Defaults to "id".
+	Key string
+}
+
+// JSONPatchRequest describes an RFC 6902 JSON Patch applied to the documents
+// matched by the query.
+type JSONPatchRequest struct {
+	QueryOptions
+	Operations []PatchOperation
+	// Key identifies documents when the patch has to be applied with a
+	// read-modify-write cycle. Defaults to "id".
+	Key string
+}
+
+// PatchError is returned when a read-modify-write patch fails partway.
+// Patched matching documents were handled before the failure; the rest were
+// left as they were.
+type PatchError struct {
+	Patched int
+	// Removed is set when a document removed to be replaced could be neither
+	// inserted patched nor restored. It is no longer in the collection and
+	// holds its content before the patch.
+	Removed json.RawMessage
+	Err     error
+}
+
+func (e *PatchError) Error() string {
+	msg := fmt.Sprintf("patch failed after %d documents: %v", e.Patched, e.Err)
+	if e.Removed != nil {
+		msg += fmt.Sprintf(" (document lost: %s)", e.Removed)
+	}
+	return msg
+}
+
+func (e *PatchError) Unwrap() error { return e.Err }
+
+// MergePatch applies an RFC 7386 merge patch. Patches the server can apply
+// natively (see ServerPatch) are sent through Patch; the rest are applied with
+// a read-modify-write cycle, which is not atomic: a failure partway returns a
+// *PatchError telling how many documents were patched.
+func (c *Client) MergePatch(ctx context.Context, collection string, req *MergePatchRequest) (*JSONStream, error) {
+	if req == nil {
+		return nil, errors.New("merge patch request is nil")
+	}
+	if patch, ok := ServerPatch(req.Patch); ok {
+		return c.Patch(ctx, collection, &PatchRequest{QueryOptions: req.QueryOptions, Patch: patch})
+	}
+	return c.readModifyWrite(ctx, collection, req.QueryOptions, req.Key, func(doc any) (any, error) {
+		return ApplyMergePatch(doc, req.Patch)
+	})
+}
+
+// JSONPatch applies an RFC 6902 patch. Operation lists the server can apply
+// natively (see ServerPatch) are sent through Patch; the rest are applied with
+// a read-modify-write cycle, which is not atomic: a failure partway returns a
+// *PatchError telling how many documents were patched.
+func (c *Client) JSONPatch(ctx context.Context, collection string, req *JSONPatchRequest) (*JSONStream, error) {
+	if req == nil {
+		return nil, errors.New("json patch request is nil")
+	}
+	if patch, ok := ServerPatch(req.Operations); ok {
+		return c.Patch(ctx, collection, &PatchRequest{QueryOptions: req.QueryOptions, Patch: patch})
+	}
+	return c.readModifyWrite(ctx, collection, req.QueryOptions, req.Key, func(doc any) (any, error) {
+		return ApplyJSONPatch(doc, req.Operations)
+	})
+}
+
+// ServerPatch converts a merge patch or an operation list ([]PatchOperation)
+// into the shallow merge understood by the patch endpoint. Merge patches may
+// be maps or structs; they are normalized through JSON first. It reports false
+// when the patch removes fields or modifies nested values, and for "replace"
+// operations, whose path must exist, which the server cannot express.
+func ServerPatch(patch any) (map[string]any, bool) {
+	if ops, ok := patch.([]PatchOperation); ok {
+		result := make(map[string]any, len(ops))
+		for _, op := range ops {
+			if op.Op != "add" {
+				return nil, false
+			}
+			tokens, err := parsePointer(op.Path)
+			if err != nil || len(tokens) != 1 {
+				return nil, false
+			}
+			result[tokens[0]] = op.Value
+		}
+		return result, true
+	}
+	normalized, err := normalizeJSON(patch)
+	if err != nil {
+		return nil, false
+	}
+	p, ok := normalized.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	for _, v := range p {
+		switch v.(type) {
+		case nil, map[string]any:
+			return nil, false
+		}
+	}
+	return p, true
+}
+
+// ApplyMergePatch returns the result of applying an RFC 7386 merge patch to
+// doc. doc is not modified.
+func ApplyMergePatch(doc, patch any) (any, error) {
+	target, err := normalizeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	p, err := normalizeJSON(patch)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatch(target, p), nil
+}
+
+func mergePatch(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = map[string]any{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
+
+// ApplyJSONPatch returns the result of applying the RFC 6902 operations to
+// doc. doc is not modified.
+func ApplyJSONPatch(doc any, ops []PatchOperation) (any, error) {
+	root, err := normalizeJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range ops {
+		root, err = applyOperation(root, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return root, nil
+}
+
+func applyOperation(root any, op PatchOperation) (any, error) {
+	tokens, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch op.Op {
+	case "add", "replace":
+		value, err := normalizeJSON(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(root, tokens, value, op.Op == "replace")
+	case "remove":
+		_, root, err = removePointer(root, tokens)
+		return root, err
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if op.Op == "move" {
+			value, root, err = removePointer(root, from)
+		} else {
+			value, err = getPointer(root, from)
+			if err == nil {
+				value, err = normalizeJSON(value)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return setPointer(root, tokens, value, false)
+	case "test":
+		current, err := getPointer(root, tokens)
+		if err != nil {
+			return nil, err
+		}
+		expected, err := normalizeJSON(op.Value)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, expected) {
+			return nil, errors.New("test failed")
+		}
+		return root, nil
+	default:
+		return nil, fmt.Errorf("unknown operation %q", op.Op)
+	}
+}
+
+// Diff computes the RFC 6902 operations that transform from into to.
+func Diff(from, to any) ([]PatchOperation, error) {
+	a, err := normalizeJSON(from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := normalizeJSON(to)
+	if err != nil {
+		return nil, err
+	}
+	var ops []PatchOperation
+	diffValues("", a, b, &ops)
+	return ops, nil
+}
+
+func diffValues(path string, a, b any, ops *[]PatchOperation) {
+	if reflect.DeepEqual(a, b) {
+		return
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		bv, ok := b.(map[string]any)
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := path + "/" + escapePointer(k)
+			oldValue, inOld := av[k]
+			newValue, inNew := bv[k]
+			switch {
+			case !inNew:
+				*ops = append(*ops, PatchOperation{Op: "remove", Path: child})
+			case !inOld:
+				*ops = append(*ops, PatchOperation{Op: "add", Path: child, Value: newValue})
+			default:
+				diffValues(child, oldValue, newValue, ops)
+			}
+		}
+		return
+	case []any:
+		bv, ok := b.([]any)
+		if !ok {
+			break
+		}
+		if len(bv) >= len(av) && reflect.DeepEqual(av, bv[:len(av)]) {
+			for _, v := range bv[len(av):] {
+				*ops = append(*ops, PatchOperation{Op: "add", Path: path + "/-", Value: v})
+			}
+			return
+		}
+		if len(av) == len(bv) {
+			for i := range av {
+				diffValues(path+"/"+strconv.Itoa(i), av[i], bv[i], ops)
+			}
+			return
+		}
+	}
+	*ops = append(*ops, PatchOperation{Op: "replace", Path: path, Value: b})
+}
+
+func (c *Client) readModifyWrite(ctx context.Context, collection string, query QueryOptions, key string, apply func(any) (any, error)) (*JSONStream, error) {
+	if key == "" {
+		key = defaultKeyField
+	}
+	stream, err := c.Find(ctx, collection, &FindRequest{QueryOptions: query})
+	if err != nil {
+		return nil, err
+	}
+	documents, err := collectRaw(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	out := &bytes.Buffer{}
+	for i, raw := range documents {
+		written, err := c.writePatched(ctx, collection, key, raw, apply)
+		if err != nil {
+			if perr, ok := err.(*PatchError); ok {
+				perr.Patched = i
+				return nil, perr
+			}
+			return nil, &PatchError{Patched: i, Err: err}
+		}
+		for _, item := range written {
+			out.Write(item)
+			out.WriteByte('\n')
+		}
+	}
+	return NewJSONStream(out), nil
+}
+
+// writePatched applies the patch to the document raw and writes the result
+// back, returning the documents as written.
+func (c *Client) writePatched(ctx context.Context, collection, key string, raw json.RawMessage, apply func(any) (any, error)) ([]json.RawMessage, error) {
+	var doc any
+	if err := decodeJSONNumber(raw, &doc); err != nil {
+		return nil, err
+	}
+	updated, err := apply(doc)
+	if err != nil {
+		return nil, err
+	}
+	before, _ := doc.(map[string]any)
+	after, ok := updated.(map[string]any)
+	if !ok {
+		return nil, errors.New("patched document is not an object")
+	}
+	value, ok := before[key]
+	if !ok {
+		return nil, fmt.Errorf("document without %q field", key)
+	}
+	filter := QueryOptions{Filter: map[string]any{key: value}, Limit: 1}
+
+	changed := map[string]any{}
+	removed := false
+	for k, v := range after {
+		if !reflect.DeepEqual(before[k], v) {
+			changed[k] = v
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			removed = true
+		}
+	}
+
+	switch {
+	case removed:
+		// Fields cannot be deleted with a shallow merge, so the document is
+		// replaced. It is validated first, so an invalid result does not
+		// cost a remove and a restore.
+		if err := c.validateDocuments(collection, []any{after}); err != nil {
+			return nil, err
+		}
+		stream, err := c.Remove(ctx, collection, &RemoveRequest{QueryOptions: filter})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := collectRaw(stream); err != nil {
+			return nil, err
+		}
+		result, err := c.InsertDocuments(ctx, collection, after)
+		if err == nil {
+			var written []json.RawMessage
+			if written, err = collectRaw(result); err == nil {
+				return written, nil
+			}
+		}
+		// Put the original back, even when ctx is what failed the insert.
+		// It is restored as it was read, without checking it against a
+		// schema it may predate.
+		restored, rerr := c.InsertStream(context.WithoutCancel(ctx), collection, bytes.NewReader(append(append([]byte(nil), raw...), '\n')))
+		if rerr == nil {
+			_, rerr = collectRaw(restored)
+		}
+		if rerr != nil {
+			return nil, &PatchError{Removed: raw, Err: err}
+		}
+		return nil, err
+	case len(changed) > 0:
+		result, err := c.Patch(ctx, collection, &PatchRequest{QueryOptions: filter, Patch: changed})
+		if err != nil {
+			return nil, err
+		}
+		return collectRaw(result)
+	default:
+		return []json.RawMessage{raw}, nil
+	}
+}
+
+func normalizeJSON(v any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out any
+	if err := decodeJSONNumber(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeJSONNumber(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !allowEnd) {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	return i, nil
+}
+
+func getPointer(node any, tokens []string) (any, error) {
+	for _, token := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			v, ok := n[token]
+			if !ok {
+				return nil, fmt.Errorf("path %q not found", token)
+			}
+			node = v
+		case []any:
+			i, err := arrayIndex(token, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("path %q not found", token)
+		}
+	}
+	return node, nil
+}
+
+func setPointer(node any, tokens []string, value any, mustExist bool) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	token := tokens[0]
+	switch n := node.(type) {
+	case map[string]any:
+		current, ok := n[token]
+		if len(tokens) == 1 {
+			if mustExist && !ok {
+				return nil, fmt.Errorf("path %q not found", token)
+			}
+			n[token] = value
+			return n, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("path %q not found", token)
+		}
+		updated, err := setPointer(current, tokens[1:], value, mustExist)
+		if err != nil {
+			return nil, err
+		}
+		n[token] = updated
+		return n, nil
+	case []any:
+		if len(tokens) == 1 {
+			i, err := arrayIndex(token, len(n), !mustExist)
+			if err != nil {
+				return nil, err
+			}
+			if mustExist {
+				n[i] = value
+				return n, nil
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := setPointer(n[i], tokens[1:], value, mustExist)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = updated
+		return n, nil
+	default:
+		return nil, fmt.Errorf("path %q not found", token)
+	}
+}
+
+func removePointer(node any, tokens []string) (any, any, error) {
+	if len(tokens) == 0 {
+		return node, nil, nil
+	}
+	token := tokens[0]
+	switch n := node.(type) {
+	case map[string]any:
+		current, ok := n[token]
+		if !ok {
+			return nil, nil, fmt.Errorf("path %q not found", token)
+		}
+		if len(tokens) == 1 {
+			delete(n, token)
+			return current, n, nil
+		}
+		removed, updated, err := removePointer(current, tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[token] = updated
+		return removed, n, nil
+	case []any:
+		i, err := arrayIndex(token, len(n), false)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(tokens) == 1 {
+			removed := n[i]
+			return removed, append(n[:i], n[i+1:]...), nil
+		}
+		removed, updated, err := removePointer(n[i], tokens[1:])
+		if err != nil {
+			return nil, nil, err
+		}
+		n[i] = updated
+		return removed, n, nil
+	default:
+		return nil, nil, fmt.Errorf("path %q not found", token)
+	}
+}
@@ -0,0 +1,196 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+
+	"inceptiondb/schema"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := map[string]any{"name": "a", "tags": []any{"x"}, "meta": map[string]any{"n": 1}}
+	got, err := ApplyJSONPatch(doc, []PatchOperation{
+		{Op: "add", Path: "/tags/-", Value: "y"},
+		{Op: "remove", Path: "/meta/n"},
+		{Op: "move", From: "/name", Path: "/title"},
+		{Op: "test", Path: "/title", Value: "a"},
+	})
+	if err != nil {
+		t.Fatalf("ApplyJSONPatch() error = %v", err)
+	}
+	want := map[string]any{"title": "a", "tags": []any{"x", "y"}, "meta": map[string]any{}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ApplyJSONPatch() = %v, want %v", got, want)
+	}
+	if _, ok := doc["name"]; !ok {
+		t.Fatal("ApplyJSONPatch() modified the input document")
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	got, err := ApplyMergePatch(
+		map[string]any{"a": "b", "c": map[string]any{"d": "e", "f": "g"}},
+		map[string]any{"a": "z", "c": map[string]any{"f": nil}},
+	)
+	if err != nil {
+		t.Fatalf("ApplyMergePatch() error = %v", err)
+	}
+	want := map[string]any{"a": "z", "c": map[string]any{"d": "e"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ApplyMergePatch() = %v, want %v", got, want)
+	}
+}
+
+func TestDiffRoundTrip(t *testing.T) {
+	from := map[string]any{"id": 1, "tags": []any{"x"}, "old": true, "nested": map[string]any{"a": 1}}
+	to := map[string]any{"id": 1, "tags": []any{"x", "y"}, "nested": map[string]any{"a": 2}, "new": "v"}
+
+	ops, err := Diff(from, to)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	got, err := ApplyJSONPatch(from, ops)
+	if err != nil {
+		t.Fatalf("ApplyJSONPatch() error = %v", err)
+	}
+	want, _ := normalizeJSON(to)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ApplyJSONPatch(Diff()) = %v, want %v", got, want)
+	}
+}
+
+func TestServerPatch(t *testing.T) {
+	if _, ok := ServerPatch([]PatchOperation{{Op: "add", Path: "/status", Value: "done"}}); !ok {
+		t.Fatal("ServerPatch() rejected a top-level add")
+	}
+	if _, ok := ServerPatch([]PatchOperation{{Op: "replace", Path: "/status", Value: "done"}}); ok {
+		t.Fatal("ServerPatch() accepted a replace, which must fail on a missing path")
+	}
+	if _, ok := ServerPatch([]PatchOperation{{Op: "add", Path: "/tags/-", Value: "x"}}); ok {
+		t.Fatal("ServerPatch() accepted a nested add")
+	}
+	if _, ok := ServerPatch(map[string]any{"status": nil}); ok {
+		t.Fatal("ServerPatch() accepted a field removal")
+	}
+
+	type meta struct {
+		Owner string `json:"owner"`
+	}
+	type update struct {
+		Status string `json:"status"`
+		Meta   *meta  `json:"meta,omitempty"`
+	}
+	if patch, ok := ServerPatch(update{Status: "done"}); !ok || patch["status"] != "done" {
+		t.Fatalf("ServerPatch(struct) = %v, %v", patch, ok)
+	}
+	if _, ok := ServerPatch(update{Meta: &meta{Owner: "ana"}}); ok {
+		t.Fatal("ServerPatch() accepted a struct with a nested object")
+	}
+	if _, ok := ServerPatch(map[string]any{"labels": map[string]string{"a": "b"}}); ok {
+		t.Fatal("ServerPatch() accepted a typed nested map")
+	}
+}
+
+func TestPatchOperationMarshalsNullValue(t *testing.T) {
+	data, err := json.Marshal(PatchOperation{Op: "add", Path: "/a", Value: nil})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"op":"add","path":"/a","value":null}`; string(data) != want {
+		t.Fatalf("Marshal() = %s, want %s", data, want)
+	}
+}
+
+func TestJSONPatchReplaceMissingPath(t *testing.T) {
+	server, client := newMemoryServer(t)
+	server.collections["items"] = []map[string]any{{"id": "1"}}
+
+	_, err := client.JSONPatch(context.Background(), "items", &JSONPatchRequest{
+		Operations: []PatchOperation{{Op: "replace", Path: "/status", Value: "done"}},
+	})
+	if err == nil {
+		t.Fatal("JSONPatch() expected error")
+	}
+	want := []map[string]any{{"id": "1"}}
+	if got := server.documents("items"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("items = %v, want %v", got, want)
+	}
+}
+
+func TestMergePatchPartialFailure(t *testing.T) {
+	server, client := newMemoryServer(t)
+	server.collections["items"] = []map[string]any{{"id": "1"}, {"id": "2", "draft": true}}
+	server.failOn = "items:insert"
+
+	_, err := client.MergePatch(context.Background(), "items", &MergePatchRequest{
+		Patch: map[string]any{"draft": nil, "seen": true},
+	})
+	var perr *PatchError
+	if !errors.As(err, &perr) {
+		t.Fatalf("MergePatch() error = %v, want a *PatchError", err)
+	}
+	if perr.Patched != 1 {
+		t.Fatalf("Patched = %d, want 1", perr.Patched)
+	}
+	var removed map[string]any
+	if err := json.Unmarshal(perr.Removed, &removed); err != nil || removed["id"] != "2" {
+		t.Fatalf("Removed = %s, want the second document", perr.Removed)
+	}
+}
+
+func TestJSONPatchReadModifyWrite(t *testing.T) {
+	server, client := newMemoryServer(t)
+	server.collections["items"] = []map[string]any{{"id": "1", "tags": []any{"x"}, "draft": true}}
+
+	stream, err := client.JSONPatch(context.Background(), "items", &JSONPatchRequest{
+		Operations: []PatchOperation{
+			{Op: "add", Path: "/tags/-", Value: "y"},
+			{Op: "remove", Path: "/draft"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("JSONPatch() error = %v", err)
+	}
+	var doc map[string]any
+	if err := stream.Next(&doc); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	want := []map[string]any{{"id": "1", "tags": []any{"x", "y"}}}
+	if got := server.documents("items"); !reflect.DeepEqual(got, want) {
+		data, _ := json.Marshal(got)
+		t.Fatalf("items = %s, want %v", data, want)
+	}
+}
+
+func TestJSONPatchValidatesBeforeReplacing(t *testing.T) {
+	s, err := schema.Parse([]byte(`{"type": "object", "required": ["id", "name"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, _ := newMemoryServer(t)
+	server.collections["users"] = []map[string]any{{"id": "1", "name": "Ana"}}
+	client, err := NewClient(server.url, WithSchema("users", s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.JSONPatch(context.Background(), "users", &JSONPatchRequest{
+		Operations: []PatchOperation{{Op: "remove", Path: "/name"}},
+	})
+	var verr *schema.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("JSONPatch() error = %v, want a validation error", err)
+	}
+	var perr *PatchError
+	if errors.As(err, &perr) && perr.Removed != nil {
+		t.Fatalf("JSONPatch() removed %s before validating", perr.Removed)
+	}
+	want := []map[string]any{{"id": "1", "name": "Ana"}}
+	if got := server.documents("users"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("users = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,367 @@
+// Package lock implements leased locks on top of InceptionDB, for mutual
+// exclusion and leader election between processes sharing a server.
+//
+//	locks := lock.New(client, lock.Options{TTL: 30 * time.Second})
+//	if err := locks.Setup(ctx); err != nil {
+//		log.Fatal(err)
+//	}
+//	err := locks.Do(ctx, "billing-run", func(ctx context.Context) error {
+//		// Only one process runs this at a time. ctx is cancelled if the
+//		// lock is lost.
+//		return runBilling(ctx)
+//	})
+//
+// A lock is a document of the locks collection whose name a unique btree
+// index keeps single. It is acquired by inserting it, renewed by patching its
+// expiry with a filter on the owner and the current expiry, and released by
+// removing it. A lock whose expiry has passed is taken over with the same
+// kind of filtered patch, so when several processes race for it only one
+// wins.
+//
+// Expiry is decided with the clocks of the processes, which must agree to
+// well within the TTL.
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"inceptiondb"
+)
+
+var (
+	// ErrLocked is returned when the lock is held by another owner.
+	ErrLocked = errors.New("lock: held by another owner")
+	// ErrLost is returned when renewing or releasing a lock that expired
+	// and was taken over.
+	ErrLost = errors.New("lock: lost")
+)
+
+// Options configures a Manager.
+type Options struct {
+	// Collection holds the lock documents. Defaults to "locks".
+	Collection string
+	// TTL is how long a lock is held without being renewed. Defaults to
+	// 30 seconds.
+	TTL time.Duration
+	// Owner identifies the Manager in lock documents. It must differ
+	// between processes and defaults to the host name, process id and a
+	// random suffix.
+	Owner string
+	// RetryInterval is how often Acquire tries again while the lock is
+	// held by another owner. Defaults to TTL / 10.
+	RetryInterval time.Duration
+}
+
+// Manager acquires locks. It is safe for concurrent use.
+type Manager struct {
+	api  inceptiondb.API
+	opts Options
+}
+
+// New returns a Manager storing locks through api.
+func New(api inceptiondb.API, opts Options) *Manager {
+	if opts.Collection == "" {
+		opts.Collection = "locks"
+	}
+	if opts.TTL <= 0 {
+		opts.TTL = 30 * time.Second
+	}
+	if opts.Owner == "" {
+		host, _ := os.Hostname()
+		var suffix [4]byte
+		rand.Read(suffix[:])
+		opts.Owner = host + ":" + strconv.Itoa(os.Getpid()) + ":" + hex.EncodeToString(suffix[:])
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = opts.TTL / 10
+	}
+	return &Manager{api: api, opts: opts}
+}
+
+// Owner returns the owner written in the locks of the Manager.
+func (m *Manager) Owner() string {
+	return m.opts.Owner
+}
+
+// Setup creates the locks collection and its unique index on the lock name.
+// Both may already exist.
+func (m *Manager) Setup(ctx context.Context) error {
+	_, err := m.api.CreateCollection(ctx, &inceptiondb.CreateCollectionRequest{Name: m.opts.Collection})
+	if err != nil && !inceptiondb.IsConflict(err) {
+		return fmt.Errorf("lock: create %s: %w", m.opts.Collection, err)
+	}
+	_, err = m.api.CreateIndex(ctx, m.opts.Collection, &inceptiondb.CreateIndexRequest{
+		Name:    "name",
+		Type:    "btree",
+		Options: map[string]any{"fields": []string{"name"}, "unique": true},
+	})
+	if err != nil && !inceptiondb.IsConflict(err) {
+		return fmt.Errorf("lock: create index on %s: %w", m.opts.Collection, err)
+	}
+	return nil
+}
+
+// document is a lock as stored in the locks collection.
+type document struct {
+	Name    string `json:"name"`
+	Owner   string `json:"owner"`
+	Expires int64  `json:"expires"` // Unix milliseconds
+}
+
+// Lock is a held lock.
+type Lock struct {
+	m       *Manager
+	name    string
+	expires int64
+}
+
+// Name returns the name of the lock.
+func (l *Lock) Name() string {
+	return l.name
+}
+
+// Expires returns when the lock expires unless renewed.
+func (l *Lock) Expires() time.Time {
+	return time.UnixMilli(l.expires)
+}
+
+// maxInserts bounds how many times TryAcquire inserts a lock that keeps
+// being released between a failed insert and the read that follows it.
+const maxInserts = 3
+
+// TryAcquire takes the lock called name if it is free or expired, and fails
+// with an error wrapping ErrLocked otherwise.
+func (m *Manager) TryAcquire(ctx context.Context, name string) (*Lock, error) {
+	if name == "" {
+		return nil, errors.New("lock: empty name")
+	}
+	for i := 0; i < maxInserts; i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		l := &Lock{m: m, name: name, expires: m.deadline()}
+		stream, err := m.api.InsertDocuments(ctx, m.opts.Collection, document{Name: name, Owner: m.opts.Owner, Expires: l.expires})
+		if err == nil {
+			if _, err = drain(stream); err == nil {
+				return l, nil
+			}
+		}
+		if !inceptiondb.IsConflict(err) {
+			return nil, fmt.Errorf("lock: acquire %s: %w", name, err)
+		}
+
+		current, err := m.read(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		if current == nil {
+			// Released since the insert failed; race for it again.
+			continue
+		}
+		if time.Now().UnixMilli() < current.Expires {
+			return nil, fmt.Errorf("%w: %s is held by %s until %s", ErrLocked, name, current.Owner,
+				time.UnixMilli(current.Expires).UTC().Format(time.RFC3339Nano))
+		}
+		// The filter only matches the expired lock as read, so of several
+		// processes taking it over only the first succeeds.
+		n, err := m.patch(ctx, name, current.Owner, current.Expires, map[string]any{"owner": m.opts.Owner, "expires": l.expires})
+		if err != nil {
+			return nil, fmt.Errorf("lock: take over %s: %w", name, err)
+		}
+		if n == 0 {
+			return nil, fmt.Errorf("%w: %s was taken over by another owner", ErrLocked, name)
+		}
+		return l, nil
+	}
+	return nil, fmt.Errorf("%w: %s is contended", ErrLocked, name)
+}
+
+// Acquire waits until it takes the lock called name or ctx is done, trying
+// every Options.RetryInterval.
+func (m *Manager) Acquire(ctx context.Context, name string) (*Lock, error) {
+	for {
+		l, err := m.TryAcquire(ctx, name)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		timer := time.NewTimer(m.opts.RetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Renew pushes the expiry of the lock a TTL away. It fails with ErrLost when
+// the lock expired and was taken over by another owner.
+func (l *Lock) Renew(ctx context.Context) error {
+	expires := l.m.deadline()
+	n, err := l.m.patch(ctx, l.name, l.m.opts.Owner, l.expires, map[string]any{"expires": expires})
+	if err != nil {
+		return fmt.Errorf("lock: renew %s: %w", l.name, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrLost, l.name)
+	}
+	l.expires = expires
+	return nil
+}
+
+// Release frees the lock. It fails with ErrLost when the lock expired and
+// was taken over by another owner, which is left holding it.
+func (l *Lock) Release(ctx context.Context) error {
+	stream, err := l.m.api.Remove(ctx, l.m.opts.Collection, &inceptiondb.RemoveRequest{
+		QueryOptions: inceptiondb.QueryOptions{
+			Filter: map[string]any{"name": l.name, "owner": l.m.opts.Owner, "expires": l.expires},
+			Limit:  1,
+		},
+	})
+	n := 0
+	if err == nil {
+		n, err = drain(stream)
+	}
+	if err != nil {
+		return fmt.Errorf("lock: release %s: %w", l.name, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: %s", ErrLost, l.name)
+	}
+	return nil
+}
+
+// Do runs fn holding the lock called name, waiting for it as Acquire does.
+// The lock is renewed every third of the TTL while fn runs and released when
+// it returns. If the lock is lost, the context given to fn is cancelled and
+// Do returns an error wrapping ErrLost, unless fn fails first.
+func (m *Manager) Do(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	l, err := m.Acquire(ctx, name)
+	if err != nil {
+		return err
+	}
+	return m.hold(ctx, l, fn)
+}
+
+// TryDo is Do without waiting: it fails with an error wrapping ErrLocked when
+// the lock is held by another owner, as TryAcquire does.
+func (m *Manager) TryDo(ctx context.Context, name string, fn func(ctx context.Context) error) error {
+	l, err := m.TryAcquire(ctx, name)
+	if err != nil {
+		return err
+	}
+	return m.hold(ctx, l, fn)
+}
+
+// hold runs fn while renewing l in the background, then releases it.
+func (m *Manager) hold(ctx context.Context, l *Lock, fn func(ctx context.Context) error) error {
+	fnCtx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+
+	stopped := make(chan struct{})
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		ticker := time.NewTicker(m.opts.TTL / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stopped:
+				return
+			case <-ticker.C:
+				if err := l.Renew(fnCtx); err != nil {
+					if fnCtx.Err() == nil {
+						cancel(err)
+					}
+					return
+				}
+			}
+		}
+	}()
+
+	err := fn(fnCtx)
+	close(stopped)
+	<-renewed
+
+	var renewErr error
+	if ctx.Err() == nil {
+		renewErr = context.Cause(fnCtx)
+	}
+	if errors.Is(renewErr, ErrLost) {
+		// Someone else holds the lock now; there is nothing to release.
+		if err == nil {
+			err = renewErr
+		}
+		return err
+	}
+	rerr := l.Release(context.WithoutCancel(ctx))
+	if err == nil {
+		err = renewErr
+	}
+	if err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func (m *Manager) deadline() int64 {
+	return time.Now().Add(m.opts.TTL).UnixMilli()
+}
+
+func (m *Manager) read(ctx context.Context, name string) (*document, error) {
+	stream, err := m.api.Find(ctx, m.opts.Collection, &inceptiondb.FindRequest{
+		QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"name": name}, Limit: 1},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("lock: read %s: %w", name, err)
+	}
+	defer stream.Close()
+	var doc document
+	if err := stream.Next(&doc); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("lock: read %s: %w", name, err)
+	}
+	return &doc, nil
+}
+
+// patch applies fields to the lock called name if its owner and expiry are
+// still the given ones, and returns the number of patched documents.
+func (m *Manager) patch(ctx context.Context, name, owner string, expires int64, fields map[string]any) (int, error) {
+	stream, err := m.api.Patch(ctx, m.opts.Collection, &inceptiondb.PatchRequest{
+		QueryOptions: inceptiondb.QueryOptions{
+			Filter: map[string]any{"name": name, "owner": owner, "expires": expires},
+			Limit:  1,
+		},
+		Patch: fields,
+	})
+	if err != nil {
+		return 0, err
+	}
+	return drain(stream)
+}
+
+// drain reads a stream to its end and returns the number of documents.
+func drain(stream *inceptiondb.JSONStream) (int, error) {
+	defer stream.Close()
+	n := 0
+	for {
+		var doc map[string]any
+		if err := stream.Next(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				return n, nil
+			}
+			return n, err
+		}
+		n++
+	}
+}
@@ -0,0 +1,226 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"inceptiondb"
+	"inceptiondb/inceptiondbtest"
+)
+
+func newTestManagers(t *testing.T, ttl time.Duration, owners ...string) []*Manager {
+	t.Helper()
+	srv := inceptiondbtest.NewServer()
+	t.Cleanup(srv.Close)
+	client, err := inceptiondb.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []*Manager
+	for _, owner := range owners {
+		m := New(client, Options{Owner: owner, TTL: ttl, RetryInterval: 5 * time.Millisecond})
+		if err := m.Setup(context.Background()); err != nil {
+			t.Fatalf("Setup() error = %v", err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+func TestTryAcquire(t *testing.T) {
+	ctx := context.Background()
+	ms := newTestManagers(t, time.Minute, "a", "b")
+	a, b := ms[0], ms[1]
+
+	la, err := a.TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v", err)
+	}
+	if _, err := b.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryAcquire() of a held lock error = %v, want ErrLocked", err)
+	}
+	if _, err := b.TryAcquire(ctx, "other"); err != nil {
+		t.Fatalf("TryAcquire() of another lock error = %v", err)
+	}
+	before := la.Expires()
+	time.Sleep(2 * time.Millisecond)
+	if err := la.Renew(ctx); err != nil || !la.Expires().After(before) {
+		t.Fatalf("Renew() = %v, expires %v after %v", err, la.Expires(), before)
+	}
+	if err := la.Release(ctx); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := b.TryAcquire(ctx, "job"); err != nil {
+		t.Fatalf("TryAcquire() after release error = %v", err)
+	}
+}
+
+func TestExpiredLockTakeover(t *testing.T) {
+	ctx := context.Background()
+	ms := newTestManagers(t, 20*time.Millisecond, "a", "b", "c")
+
+	la, err := ms[0].TryAcquire(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(30 * time.Millisecond)
+
+	// b and c race for the expired lock; exactly one wins.
+	var wg sync.WaitGroup
+	var won atomic.Int32
+	var winner *Lock
+	for _, m := range ms[1:] {
+		wg.Add(1)
+		go func(m *Manager) {
+			defer wg.Done()
+			l, err := m.TryAcquire(ctx, "job")
+			if err == nil {
+				won.Add(1)
+				winner = l
+			} else if !errors.Is(err, ErrLocked) {
+				t.Errorf("TryAcquire() error = %v", err)
+			}
+		}(m)
+	}
+	wg.Wait()
+	if won.Load() != 1 {
+		t.Fatalf("%d owners took the lock over, want 1", won.Load())
+	}
+
+	if err := la.Renew(ctx); !errors.Is(err, ErrLost) {
+		t.Fatalf("Renew() of a taken over lock error = %v, want ErrLost", err)
+	}
+	if err := la.Release(ctx); !errors.Is(err, ErrLost) {
+		t.Fatalf("Release() of a taken over lock error = %v, want ErrLost", err)
+	}
+	if err := winner.Release(ctx); err != nil {
+		t.Fatalf("Release() by the new owner error = %v", err)
+	}
+}
+
+func TestDoExcludes(t *testing.T) {
+	ms := newTestManagers(t, time.Minute, "a", "b", "c")
+	var running, maxRunning atomic.Int32
+	var wg sync.WaitGroup
+	for _, m := range ms {
+		wg.Add(1)
+		go func(m *Manager) {
+			defer wg.Done()
+			err := m.Do(context.Background(), "job", func(ctx context.Context) error {
+				n := running.Add(1)
+				if n > maxRunning.Load() {
+					maxRunning.Store(n)
+				}
+				time.Sleep(10 * time.Millisecond)
+				running.Add(-1)
+				return nil
+			})
+			if err != nil {
+				t.Errorf("Do() error = %v", err)
+			}
+		}(m)
+	}
+	wg.Wait()
+	if maxRunning.Load() != 1 {
+		t.Fatalf("%d holders ran at once, want 1", maxRunning.Load())
+	}
+}
+
+func TestDoRenewsAndDetectsLoss(t *testing.T) {
+	ctx := context.Background()
+	ms := newTestManagers(t, 30*time.Millisecond, "a", "b")
+	a, b := ms[0], ms[1]
+
+	// Held for several TTLs thanks to renewals.
+	err := a.Do(ctx, "job", func(ctx context.Context) error {
+		time.Sleep(100 * time.Millisecond)
+		if _, err := b.TryAcquire(ctx, "job"); !errors.Is(err, ErrLocked) {
+			t.Errorf("TryAcquire() during Do error = %v, want ErrLocked", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do() error = %v", err)
+	}
+
+	// A stolen lock cancels fn.
+	err = a.Do(ctx, "job", func(ctx context.Context) error {
+		stream, err := a.api.Remove(ctx, a.opts.Collection, &inceptiondb.RemoveRequest{})
+		if err != nil {
+			return err
+		}
+		stream.Close()
+		<-ctx.Done()
+		return nil
+	})
+	if !errors.Is(err, ErrLost) {
+		t.Fatalf("Do() error = %v, want ErrLost", err)
+	}
+}
+
+func TestTryDo(t *testing.T) {
+	ctx := context.Background()
+	ms := newTestManagers(t, time.Minute, "a", "b")
+	err := ms[0].TryDo(ctx, "job", func(ctx context.Context) error {
+		return ms[1].TryDo(ctx, "job", func(context.Context) error {
+			t.Error("TryDo() ran fn while the lock was held")
+			return nil
+		})
+	})
+	if !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryDo() error = %v, want ErrLocked", err)
+	}
+	if _, err := ms[1].TryAcquire(ctx, "job"); err != nil {
+		t.Fatalf("TryAcquire() after TryDo() error = %v, want the lock released", err)
+	}
+}
+
+func TestAcquireHonoursContext(t *testing.T) {
+	ms := newTestManagers(t, time.Minute, "a", "b")
+	if _, err := ms[0].TryAcquire(context.Background(), "job"); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := ms[1].Acquire(ctx, "job"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Acquire() error = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestTryAcquireBoundsRetries(t *testing.T) {
+	// Every insert conflicts with a lock that is gone when read back.
+	var inserts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ":insert") {
+			inserts.Add(1)
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte(`{"error":{"message":"index conflict"}}`))
+		}
+	}))
+	defer srv.Close()
+	client, err := inceptiondb.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := New(client, Options{Owner: "a"})
+
+	if _, err := m.TryAcquire(context.Background(), "job"); !errors.Is(err, ErrLocked) {
+		t.Fatalf("TryAcquire() error = %v, want ErrLocked", err)
+	}
+	if n := inserts.Load(); n != maxInserts {
+		t.Fatalf("inserts = %d, want %d", n, maxInserts)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.TryAcquire(ctx, "job"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("TryAcquire() with a cancelled context error = %v", err)
+	}
+}
@@ -0,0 +1,189 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are never logged verbatim.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+	"X-Api-Key":           true,
+}
+
+// LoggerOption configures the logging installed by WithLogger.
+type LoggerOption func(*requestLogger)
+
+// WithBodyLogging includes the request and response bodies, truncated to limit
+// bytes, and the request headers in the debug records.
+func WithBodyLogging(limit int) LoggerOption {
+	return func(l *requestLogger) {
+		l.bodyLimit = limit
+	}
+}
+
+// WithRedactedFields replaces the value of the given document fields, at any
+// depth, with "[REDACTED]" in logged bodies.
+func WithRedactedFields(fields ...string) LoggerOption {
+	return func(l *requestLogger) {
+		for _, f := range fields {
+			l.redact[f] = true
+		}
+	}
+}
+
+// WithLogger logs every request made by the client. Completed requests are
+// logged at debug level with their operation, collection, status, latency and
+// bytes transferred; streamed responses are logged when the stream is closed.
+// Failures are logged at warn level for client errors and at error level for
+// server and transport errors.
+func WithLogger(logger *slog.Logger, opts ...LoggerOption) Option {
+	return func(c *Client) {
+		if logger == nil {
+			c.logger = nil
+			return
+		}
+		l := &requestLogger{logger: logger, redact: map[string]bool{}}
+		for _, opt := range opts {
+			if opt != nil {
+				opt(l)
+			}
+		}
+		c.logger = l
+	}
+}
+
+type requestLogger struct {
+	logger    *slog.Logger
+	bodyLimit int
+	redact    map[string]bool
+}
+
+func (l *requestLogger) captureLimit() int {
+	if l == nil {
+		return 0
+	}
+	return l.bodyLimit
+}
+
+func (l *requestLogger) log(cl *call) {
+	if l == nil {
+		return
+	}
+	level := slog.LevelDebug
+	attrs := []slog.Attr{
+		slog.String("op", cl.op),
+		slog.String("collection", cl.collection),
+		slog.String("method", cl.method),
+		slog.Int("status", cl.status),
+		slog.Duration("latency", cl.duration),
+		slog.Int64("bytes_sent", cl.sent.Load()),
+		slog.Int64("bytes_received", cl.received.Load()),
+	}
+
+	if cl.stream {
+		attrs = append(attrs, slog.Int64("items", cl.items.Load()))
+	}
+
+	msg := "inceptiondb request"
+	if cl.err != nil {
+		msg = "inceptiondb request failed"
+		level = slog.LevelError
+		var apiErr *Error
+		if errors.As(cl.err, &apiErr) {
+			if apiErr.StatusCode < http.StatusInternalServerError {
+				level = slog.LevelWarn
+			}
+			attrs = append(attrs,
+				slog.String("error_message", apiErr.Message),
+				slog.String("error_description", apiErr.Description),
+			)
+		} else {
+			attrs = append(attrs, slog.String("error", cl.err.Error()))
+		}
+	}
+
+	if l.bodyLimit > 0 {
+		attrs = append(attrs, slog.Any("request_headers", l.headers(cl.header)))
+		if cl.reqBody != nil {
+			attrs = append(attrs, slog.String("request_body", l.body(cl.reqBody)))
+		}
+		if cl.respBody != nil {
+			attrs = append(attrs, slog.String("response_body", l.body(cl.respBody)))
+		}
+	}
+
+	l.logger.LogAttrs(cl.ctx, level, msg, attrs...)
+}
+
+func (l *requestLogger) headers(h http.Header) map[string]string {
+	out := make(map[string]string, len(h))
+	for k, v := range h {
+		if sensitiveHeaders[http.CanonicalHeaderKey(k)] {
+			out[k] = redacted
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+// body renders a captured body with the configured fields redacted. Bodies
+// are JSON documents or JSON Lines; when fields must be redacted, lines that
+// cannot be parsed (typically the one cut by the limit) are omitted.
+func (l *requestLogger) body(b *cappedBuffer) string {
+	data, truncated := b.snapshot()
+	if len(l.redact) == 0 {
+		if truncated {
+			return string(data) + "…"
+		}
+		return string(data)
+	}
+
+	var out []string
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+		var doc any
+		if err := json.Unmarshal(line, &doc); err != nil {
+			out = append(out, "[OMITTED]")
+			continue
+		}
+		data, _ := json.Marshal(l.redactValue(doc))
+		out = append(out, string(data))
+	}
+	result := strings.Join(out, "\n")
+	if truncated {
+		result += "…"
+	}
+	return result
+}
+
+func (l *requestLogger) redactValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			if l.redact[k] {
+				t[k] = redacted
+				continue
+			}
+			t[k] = l.redactValue(child)
+		}
+	case []any:
+		for i, child := range t {
+			t[i] = l.redactValue(child)
+		}
+	}
+	return v
+}
@@ -0,0 +1,82 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithLogger(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ":getIndex") {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":{"message":"index not found"}}`))
+			return
+		}
+		w.Write([]byte("{\"id\":1,\"password\":\"secret\"}\n"))
+	}))
+	defer srv.Close()
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	client, err := NewClient(srv.URL, WithLogger(logger, WithBodyLogging(1024), WithRedactedFields("password")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stream, err := client.Find(ctx, "users", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if _, err := client.GetIndex(ctx, "users", "missing"); err == nil {
+		t.Fatal("GetIndex() expected error")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("logged %d records, want 2:\n%s", len(lines), buf)
+	}
+	var find, getIndex map[string]any
+	json.Unmarshal([]byte(lines[0]), &find)
+	json.Unmarshal([]byte(lines[1]), &getIndex)
+
+	if find["level"] != "DEBUG" || find["op"] != "find" || find["collection"] != "users" || find["bytes_received"] != float64(29) {
+		t.Fatalf("find record = %v", find)
+	}
+	if body := find["response_body"].(string); strings.Contains(body, "secret") {
+		t.Fatalf("response_body = %q, want password redacted", body)
+	}
+	if getIndex["level"] != "WARN" || getIndex["status"] != float64(404) || getIndex["error_message"] != "index not found" {
+		t.Fatalf("getIndex record = %v", getIndex)
+	}
+}
+
+func TestOperation(t *testing.T) {
+	tests := []struct {
+		method, path, op, collection string
+	}{
+		{http.MethodGet, "/v1/collections", "listCollections", ""},
+		{http.MethodPost, "/v1/collections", "createCollection", ""},
+		{http.MethodGet, "/v1/collections/my%20items", "getCollection", "my items"},
+		{http.MethodPost, "/v1/collections/items:find", "find", "items"},
+	}
+	for _, tt := range tests {
+		op, collection := operation(tt.method, tt.path)
+		if op != tt.op || collection != tt.collection {
+			t.Errorf("operation(%s, %s) = %s, %s; want %s, %s", tt.method, tt.path, op, collection, tt.op, tt.collection)
+		}
+		req := httptest.NewRequest(tt.method, "http://db"+tt.path, nil)
+		if op, collection := Operation(req); op != tt.op || collection != tt.collection {
+			t.Errorf("Operation(%s %s) = %s, %s; want %s, %s", tt.method, tt.path, op, collection, tt.op, tt.collection)
+		}
+	}
+}
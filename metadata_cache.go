@@ -0,0 +1,163 @@
+package inceptiondb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// MetadataCacheStats holds the hit and miss counters of the metadata cache.
+type MetadataCacheStats struct {
+	Hits   uint64
+	Misses uint64
+}
+
+// WithMetadataCache caches the results of GetCollection, ListIndexes and
+// GetIndex for ttl. Entries of a collection are invalidated when the same
+// client changes its indexes, defaults or drops it.
+func WithMetadataCache(ttl time.Duration) Option {
+	return func(c *Client) {
+		if ttl <= 0 {
+			c.metadata = nil
+			return
+		}
+		c.metadata = &metadataCache{
+			ttl:     ttl,
+			entries: map[string]map[string]metadataEntry{},
+			gens:    map[string]uint64{},
+		}
+	}
+}
+
+// MetadataCacheStats returns the metadata cache counters. It returns zero
+// values when the cache is disabled.
+func (c *Client) MetadataCacheStats() MetadataCacheStats {
+	if c.metadata == nil {
+		return MetadataCacheStats{}
+	}
+	return MetadataCacheStats{
+		Hits:   c.metadata.hits.Load(),
+		Misses: c.metadata.misses.Load(),
+	}
+}
+
+const (
+	metadataCollection = "collection"
+	metadataIndexes    = "indexes"
+	metadataIndex      = "index:"
+)
+
+type metadataCache struct {
+	ttl    time.Duration
+	hits   atomic.Uint64
+	misses atomic.Uint64
+
+	mu      sync.Mutex
+	entries map[string]map[string]metadataEntry
+	// gens counts the invalidations of each collection. A value fetched
+	// before an invalidation is not stored, as it may predate the change.
+	gens map[string]uint64
+}
+
+type metadataEntry struct {
+	value   any
+	expires time.Time
+}
+
+func (m *metadataCache) get(collection, key string) (any, bool) {
+	if m == nil {
+		return nil, false
+	}
+	m.mu.Lock()
+	entry, ok := m.entries[collection][key]
+	if ok && time.Now().After(entry.expires) {
+		delete(m.entries[collection], key)
+		ok = false
+	}
+	m.mu.Unlock()
+
+	if !ok {
+		m.misses.Add(1)
+		return nil, false
+	}
+	m.hits.Add(1)
+	return entry.value, true
+}
+
+// generation returns the value to pass to set for a fetch starting now.
+func (m *metadataCache) generation(collection string) uint64 {
+	if m == nil {
+		return 0
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gens[collection]
+}
+
+// set stores value unless the collection was invalidated since gen was
+// taken.
+func (m *metadataCache) set(collection, key string, gen uint64, value any) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.gens[collection] != gen {
+		return
+	}
+	entries, ok := m.entries[collection]
+	if !ok {
+		entries = map[string]metadataEntry{}
+		m.entries[collection] = entries
+	}
+	entries[key] = metadataEntry{value: value, expires: time.Now().Add(m.ttl)}
+}
+
+func (m *metadataCache) invalidate(collection string) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	delete(m.entries, collection)
+	m.gens[collection]++
+	m.mu.Unlock()
+}
+
+func copyIndex(idx Index) Index {
+	if idx.Options != nil {
+		idx.Options = copyMetadataMap(idx.Options)
+	}
+	return idx
+}
+
+func copyCollection(col Collection) Collection {
+	if col.Defaults != nil {
+		col.Defaults = copyMetadataMap(col.Defaults)
+	}
+	return col
+}
+
+// copyMetadataMap deep-copies a decoded JSON object, so callers can modify
+// nested values without changing the cached ones.
+func copyMetadataMap(m map[string]any) map[string]any {
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = copyMetadataValue(v)
+	}
+	return out
+}
+
+func copyMetadataValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		return copyMetadataMap(v)
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = copyMetadataValue(item)
+		}
+		return out
+	default:
+		return v
+	}
+}
@@ -0,0 +1,155 @@
+package inceptiondb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetadataCache(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/v1/collections/items:listIndexes":
+			w.Write([]byte(`[{"name":"by-id","type":"btree","field":"id"}]`))
+		case "/v1/collections/items:dropIndex":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Write([]byte(`{"name":"items","total":1}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithMetadataCache(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		indexes, err := client.ListIndexes(ctx, "items")
+		if err != nil {
+			t.Fatalf("ListIndexes() error = %v", err)
+		}
+		if len(indexes) != 1 || indexes[0].Options["field"] != "id" {
+			t.Fatalf("ListIndexes() = %v", indexes)
+		}
+		indexes[0].Options["field"] = "mutated"
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+
+	if err := client.DropIndex(ctx, "items", "by-id"); err != nil {
+		t.Fatalf("DropIndex() error = %v", err)
+	}
+	if _, err := client.ListIndexes(ctx, "items"); err != nil {
+		t.Fatalf("ListIndexes() error = %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("requests = %d, want 3 after invalidation", got)
+	}
+
+	stats := client.MetadataCacheStats()
+	if stats.Hits != 2 || stats.Misses != 2 {
+		t.Fatalf("MetadataCacheStats() = %+v, want 2 hits and 2 misses", stats)
+	}
+}
+
+func TestMetadataCacheCollection(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch r.URL.Path {
+		case "/v1/collections/items:setDefaults":
+			w.Write([]byte(`{"status":"new"}`))
+		default:
+			w.Write([]byte(`{"name":"items","total":1,"defaults":{"tags":["a"],"meta":{"owner":"x"}}}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithMetadataCache(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		col, err := client.GetCollection(ctx, "items")
+		if err != nil {
+			t.Fatalf("GetCollection() error = %v", err)
+		}
+		meta := col.Defaults["meta"].(map[string]any)
+		tags := col.Defaults["tags"].([]any)
+		if meta["owner"] != "x" || tags[0] != "a" {
+			t.Fatalf("GetCollection() defaults = %v, cached value was modified", col.Defaults)
+		}
+		meta["owner"] = "mutated"
+		tags[0] = "mutated"
+	}
+	if got := requests.Load(); got != 1 {
+		t.Fatalf("requests = %d, want 1", got)
+	}
+
+	if _, err := client.SetDefaults(ctx, "items", map[string]any{"status": "new"}); err != nil {
+		t.Fatalf("SetDefaults() error = %v", err)
+	}
+	if _, err := client.GetCollection(ctx, "items"); err != nil {
+		t.Fatalf("GetCollection() error = %v", err)
+	}
+	if got := requests.Load(); got != 3 {
+		t.Fatalf("requests = %d, want 3 after invalidation", got)
+	}
+}
+
+func TestMetadataCacheSkipsFetchDuringInvalidation(t *testing.T) {
+	var requests atomic.Int32
+	entered := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/collections/items:dropIndex":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			if requests.Add(1) == 1 {
+				entered <- struct{}{}
+				<-release
+			}
+			w.Write([]byte(`{"name":"by-id","type":"btree","field":"id"}`))
+		}
+	}))
+	defer srv.Close()
+
+	client, err := NewClient(srv.URL, WithMetadataCache(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	done := make(chan error)
+	go func() {
+		_, err := client.GetIndex(ctx, "items", "by-id")
+		done <- err
+	}()
+	<-entered
+	if err := client.DropIndex(ctx, "items", "by-id"); err != nil {
+		t.Fatalf("DropIndex() error = %v", err)
+	}
+	close(release)
+	if err := <-done; err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	// The first fetch may predate the drop, so it must not have been cached.
+	if _, err := client.GetIndex(ctx, "items", "by-id"); err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+	if got := requests.Load(); got != 2 {
+		t.Fatalf("getIndex requests = %d, want 2", got)
+	}
+}
@@ -0,0 +1,119 @@
+package inceptiondb
+
+import (
+	"expvar"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Byte directions reported to Recorder.ObserveBytes.
+const (
+	DirectionSent     = "sent"
+	DirectionReceived = "received"
+)
+
+// Recorder receives the metrics produced by a client. Implementations must be
+// safe for concurrent use.
+type Recorder interface {
+	// ObserveRequest is called once per request when it completes. For
+	// streamed responses that is when the stream is closed. status is 0 when
+	// no response was received.
+	ObserveRequest(op, collection string, status int, duration time.Duration)
+	// ObserveStreamItems reports items read from a stream as they are read,
+	// so streams that are abandoned without Close are still counted.
+	ObserveStreamItems(op string, n int)
+	// ObserveBytes reports the body bytes transferred in direction dir
+	// (DirectionSent or DirectionReceived).
+	ObserveBytes(dir string, n int64)
+}
+
+// WithMetrics reports request, stream and transfer metrics to r.
+func WithMetrics(r Recorder) Option {
+	return func(c *Client) {
+		c.metrics = r
+	}
+}
+
+// ExpvarRecorder is a Recorder that publishes its counters through expvar:
+//
+//	requests            per operation
+//	errors              per operation, for requests that got no response or a status >= 400
+//	status              per status code
+//	latency_seconds     accumulated per operation
+//	collection_requests per collection
+//	collection_errors   per collection, counted like errors
+//	stream_items        per operation
+//	bytes               per direction
+//
+// Requests that do not target a collection, such as listCollections, are not
+// counted per collection.
+type ExpvarRecorder struct {
+	requests    *expvar.Map
+	errors      *expvar.Map
+	status      *expvar.Map
+	latency     *expvar.Map
+	collections *expvar.Map
+	collErrors  *expvar.Map
+	items       *expvar.Map
+	bytes       *expvar.Map
+}
+
+var expvarMu sync.Mutex
+
+// NewExpvarRecorder publishes the counters under name. Recorders created with
+// the same name share their counters.
+func NewExpvarRecorder(name string) *ExpvarRecorder {
+	expvarMu.Lock()
+	defer expvarMu.Unlock()
+
+	root, ok := expvar.Get(name).(*expvar.Map)
+	if !ok {
+		root = expvar.NewMap(name)
+	}
+	child := func(key string) *expvar.Map {
+		if m, ok := root.Get(key).(*expvar.Map); ok {
+			return m
+		}
+		m := new(expvar.Map).Init()
+		root.Set(key, m)
+		return m
+	}
+	return &ExpvarRecorder{
+		requests:    child("requests"),
+		errors:      child("errors"),
+		status:      child("status"),
+		latency:     child("latency_seconds"),
+		collections: child("collection_requests"),
+		collErrors:  child("collection_errors"),
+		items:       child("stream_items"),
+		bytes:       child("bytes"),
+	}
+}
+
+// ObserveRequest implements Recorder.
+func (r *ExpvarRecorder) ObserveRequest(op, collection string, status int, duration time.Duration) {
+	failed := status == 0 || status >= 400
+	r.requests.Add(op, 1)
+	if failed {
+		r.errors.Add(op, 1)
+	}
+	if collection != "" {
+		r.collections.Add(collection, 1)
+		if failed {
+			r.collErrors.Add(collection, 1)
+		}
+	}
+	r.status.Add(strconv.Itoa(status), 1)
+	r.latency.AddFloat(op, duration.Seconds())
+}
+
+// ObserveStreamItems implements Recorder.
+func (r *ExpvarRecorder) ObserveStreamItems(op string, n int) {
+	r.items.Add(op, int64(n))
+}
+
+// ObserveBytes implements Recorder.
+func (r *ExpvarRecorder) ObserveBytes(dir string, n int64) {
+	r.bytes.Add(dir, n)
+}
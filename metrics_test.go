@@ -0,0 +1,98 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpvarRecorder(t *testing.T) {
+	server, _ := newMemoryServer(t)
+	server.collections["items"] = []map[string]any{{"id": "1"}, {"id": "2"}}
+
+	recorder := NewExpvarRecorder("inceptiondb_test")
+	client, err := NewClient(server.url, WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stream, err := client.Find(ctx, "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	server.failOn = "items:remove"
+	if _, err := client.Remove(ctx, "items", nil); err == nil {
+		t.Fatal("Remove() expected error")
+	}
+
+	root := expvar.Get("inceptiondb_test").(*expvar.Map)
+	get := func(m, key string) string {
+		v := root.Get(m).(*expvar.Map).Get(key)
+		if v == nil {
+			return ""
+		}
+		return v.String()
+	}
+	if got := get("requests", "find"); got != "1" {
+		t.Fatalf("requests[find] = %s, want 1", got)
+	}
+	if got := get("stream_items", "find"); got != "2" {
+		t.Fatalf("stream_items[find] = %s, want 2", got)
+	}
+	if got := get("errors", "remove"); got != "1" {
+		t.Fatalf("errors[remove] = %s, want 1", got)
+	}
+	if got := get("collection_requests", "items"); got != "2" {
+		t.Fatalf("collection_requests[items] = %s, want 2", got)
+	}
+	if got := get("collection_errors", "items"); got != "1" {
+		t.Fatalf("collection_errors[items] = %s, want 1", got)
+	}
+	if got := get("status", "500"); got != "1" {
+		t.Fatalf("status[500] = %s, want 1", got)
+	}
+	if got := get("bytes", DirectionReceived); got == "" || got == "0" {
+		t.Fatalf("bytes[received] = %q, want > 0", got)
+	}
+}
+
+func TestStreamItemsReportedBeforeClose(t *testing.T) {
+	server, _ := newMemoryServer(t)
+	server.collections["items"] = []map[string]any{{"id": "1"}, {"id": "2"}}
+
+	recorder := &itemsRecorder{}
+	client, err := NewClient(server.url, WithMetrics(recorder))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, err := client.Find(context.Background(), "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	defer stream.Close()
+
+	var item json.RawMessage
+	if err := stream.Next(&item); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if got := recorder.items.Load(); got != 1 {
+		t.Fatalf("items reported before Close = %d, want 1", got)
+	}
+}
+
+type itemsRecorder struct {
+	items atomic.Int64
+}
+
+func (r *itemsRecorder) ObserveRequest(string, string, int, time.Duration) {}
+
+func (r *itemsRecorder) ObserveStreamItems(_ string, n int) { r.items.Add(int64(n)) }
+
+func (r *itemsRecorder) ObserveBytes(string, int64) {}
@@ -0,0 +1,160 @@
+package migrate
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+	"time"
+
+	"inceptiondb"
+)
+
+// Command runs the migrate command line with the registered migrations and
+// returns the exit status:
+//
+//	migrate [-url URL] [-collection name] status
+//	migrate [-url URL] [-collection name] up [-to version]
+//	migrate [-url URL] [-collection name] down [-to version]
+//
+// down without -to reverts the latest applied migration only. The server URL
+// defaults to the INCEPTIONDB_URL environment variable.
+//
+// up and down fail when no migrations are registered, as they would
+// otherwise succeed without doing anything. "inceptiondb migrate" is this
+// command, but its binary registers no migrations, so it can only show what
+// was applied. A program registering its migrations gets the full command
+// with:
+//
+//	func main() {
+//		os.Exit(migrate.Command(os.Args[1:], os.Stdout, os.Stderr))
+//	}
+func Command(args []string, stdout, stderr io.Writer) int {
+	return command(args, Registered(), stdout, stderr)
+}
+
+func command(args []string, migrations []Migration, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baseURL := fs.String("url", os.Getenv("INCEPTIONDB_URL"), "base URL of the server (default $INCEPTIONDB_URL)")
+	collection := fs.String("collection", "", `collection holding the applied versions (default "_migrations")`)
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: migrate [flags] status | up [-to version] | down [-to version]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	if *baseURL == "" {
+		fmt.Fprintln(stderr, "migrate: no server URL: set -url or INCEPTIONDB_URL")
+		return 2
+	}
+
+	action := fs.Arg(0)
+	sub := flag.NewFlagSet("migrate "+action, flag.ContinueOnError)
+	sub.SetOutput(stderr)
+	to := sub.Int64("to", 0, "target version")
+	if err := sub.Parse(fs.Args()[1:]); err != nil {
+		return 2
+	}
+	toSet := false
+	sub.Visit(func(f *flag.Flag) { toSet = toSet || f.Name == "to" })
+	if (action == "up" || action == "down") && len(migrations) == 0 {
+		fmt.Fprintf(stderr, "migrate: %s: no migrations are registered in this binary; run it from a program that registers them with migrate.Register and calls migrate.Command\n", action)
+		return 1
+	}
+
+	client, err := inceptiondb.NewClient(*baseURL)
+	if err != nil {
+		fmt.Fprintf(stderr, "migrate: %v\n", err)
+		return 2
+	}
+	defer client.Close()
+	m, err := New(client, migrations, Options{Collection: *collection})
+	if err != nil {
+		fmt.Fprintf(stderr, "migrate: %v\n", err)
+		return 1
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	switch action {
+	case "status":
+		err = printStatus(ctx, m, stdout)
+	case "up":
+		var done []Migration
+		done, err = m.Up(ctx, *to)
+		report(stdout, "applied", done)
+	case "down":
+		if !toSet {
+			*to, err = m.previous(ctx)
+			if err != nil {
+				break
+			}
+		}
+		var done []Migration
+		done, err = m.Down(ctx, *to)
+		report(stdout, "reverted", done)
+	default:
+		fmt.Fprintf(stderr, "migrate: unknown action %q\n", action)
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func printStatus(ctx context.Context, m *Migrator, w io.Writer) error {
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tSTATUS\tAPPLIED AT\tNAME")
+	for _, st := range statuses {
+		state, at := "pending", ""
+		if st.Applied {
+			state, at = "applied", st.AppliedAt.UTC().Format(time.RFC3339)
+		}
+		if !st.Registered {
+			state += " (unknown)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", st.Version, state, at, st.Name)
+	}
+	return tw.Flush()
+}
+
+func report(w io.Writer, verb string, done []Migration) {
+	if len(done) == 0 {
+		fmt.Fprintf(w, "no migrations %s\n", verb)
+	}
+	for _, mig := range done {
+		fmt.Fprintf(w, "%s %d %s\n", verb, mig.Version, mig.Name)
+	}
+}
+
+// previous returns the version before the latest applied one, 0 when at most
+// one migration is applied.
+func (m *Migrator) previous(ctx context.Context) (int64, error) {
+	if err := m.setup(ctx); err != nil {
+		return 0, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if len(applied) < 2 {
+		return 0, nil
+	}
+	return applied[len(applied)-2].Version, nil
+}
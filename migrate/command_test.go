@@ -0,0 +1,44 @@
+package migrate
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"inceptiondb/inceptiondbtest"
+)
+
+func TestCommand(t *testing.T) {
+	srv := inceptiondbtest.NewServer()
+	defer srv.Close()
+
+	var stdout, stderr bytes.Buffer
+	if code := Command([]string{"-url", srv.URL, "status"}, &stdout, &stderr); code != 0 {
+		t.Fatalf("status exit code = %d; stderr: %s", code, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "VERSION") {
+		t.Fatalf("status output = %q", stdout.String())
+	}
+
+	for _, args := range [][]string{
+		{"-url", srv.URL},
+		{"status"},
+		{"-url", srv.URL, "sideways"},
+		{"-url", srv.URL, "up", "-to", "x"},
+	} {
+		t.Setenv("INCEPTIONDB_URL", "")
+		if code := Command(args, &stdout, &stderr); code != 2 {
+			t.Errorf("Command(%q) exit code = %d, want 2", args, code)
+		}
+	}
+
+	for _, action := range []string{"up", "down"} {
+		stderr.Reset()
+		if code := command([]string{"-url", srv.URL, action}, nil, &stdout, &stderr); code != 1 {
+			t.Errorf("%s without migrations exit code = %d, want 1", action, code)
+		}
+		if !strings.Contains(stderr.String(), "no migrations are registered") {
+			t.Errorf("%s without migrations stderr = %q", action, stderr.String())
+		}
+	}
+}
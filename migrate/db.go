@@ -0,0 +1,69 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+
+	"inceptiondb"
+)
+
+// DB is what a migration works with: the API of the Migrator, to manage
+// collections, indexes and defaults, plus helpers to rewrite documents.
+type DB struct {
+	inceptiondb.API
+}
+
+// Rewrite calls fn with each document of collection matching query and
+// patches it with the fields fn returns; fn returns nil to leave a document
+// as it is. Documents are identified by their key field, "id" when key is
+// empty. Every matching document is read before the first is patched, so fn
+// does not see its own changes. Rewrite returns the number of patched
+// documents.
+func (db *DB) Rewrite(ctx context.Context, collection string, query inceptiondb.QueryOptions, key string, fn func(doc map[string]any) (map[string]any, error)) (int, error) {
+	if key == "" {
+		key = "id"
+	}
+	stream, err := db.Find(ctx, collection, &inceptiondb.FindRequest{QueryOptions: query})
+	if err != nil {
+		return 0, err
+	}
+	var docs []map[string]any
+	err = inceptiondb.Iterate(stream, func(doc *map[string]any) error {
+		docs = append(docs, *doc)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, doc := range docs {
+		id, ok := doc[key]
+		if !ok {
+			return n, fmt.Errorf("document without %q field", key)
+		}
+		patch, err := fn(doc)
+		if err != nil {
+			return n, err
+		}
+		if patch == nil {
+			continue
+		}
+		stream, err := db.Patch(ctx, collection, &inceptiondb.PatchRequest{
+			QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{key: id}, Limit: 1},
+			Patch:        patch,
+		})
+		if err != nil {
+			return n, err
+		}
+		patched, err := count(stream)
+		if err != nil {
+			return n, err
+		}
+		if patched == 0 {
+			return n, fmt.Errorf("document %v vanished during the rewrite", id)
+		}
+		n++
+	}
+	return n, nil
+}
@@ -0,0 +1,386 @@
+// Package migrate applies versioned schema migrations to InceptionDB
+// collections. Migrations are Go functions registered with a version; the
+// versions applied so far are stored in a reserved collection, so every
+// environment can be brought to the same state.
+//
+//	func init() {
+//		migrate.Register(migrate.Migration{
+//			Version: 2024061201,
+//			Name:    "index users by email",
+//			Up: func(ctx context.Context, db *migrate.DB) error {
+//				_, err := db.CreateIndex(ctx, "users", &inceptiondb.CreateIndexRequest{
+//					Name: "by_email", Type: "map", Options: map[string]any{"field": "email"},
+//				})
+//				return err
+//			},
+//			Down: func(ctx context.Context, db *migrate.DB) error {
+//				return db.DropIndex(ctx, "users", "by_email")
+//			},
+//		})
+//	}
+//
+//	m, err := migrate.New(client, migrate.Registered(), migrate.Options{})
+//	applied, err := m.Up(ctx, 0)
+//
+// A lease from the lock package keeps concurrent runners from applying
+// migrations at the same time. InceptionDB has no transactions: a
+// migration that fails halfway is not recorded and runs again from the start
+// next time, so migrations should be safe to repeat.
+package migrate
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"inceptiondb"
+	"inceptiondb/lock"
+)
+
+// Func is the body of a migration.
+type Func func(ctx context.Context, db *DB) error
+
+// Migration is a versioned change. Versions order migrations; dates such as
+// 2024061201 make good versions.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      Func
+	// Down reverts Up. Migrations without it cannot be reverted.
+	Down Func
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = map[int64]Migration{}
+)
+
+// Register adds m to the migrations returned by Registered. It is meant to be
+// called from init functions and panics when m has no Up function, its
+// version is not positive or is already registered.
+func Register(m Migration) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if err := check(m); err != nil {
+		panic(err)
+	}
+	if _, ok := registry[m.Version]; ok {
+		panic(fmt.Sprintf("migrate: version %d registered twice", m.Version))
+	}
+	registry[m.Version] = m
+}
+
+// Registered returns the registered migrations ordered by version.
+func Registered() []Migration {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	out := make([]Migration, 0, len(registry))
+	for _, m := range registry {
+		out = append(out, m)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out
+}
+
+func check(m Migration) error {
+	if m.Version <= 0 {
+		return fmt.Errorf("migrate: version %d is not positive", m.Version)
+	}
+	if m.Up == nil {
+		return fmt.Errorf("migrate: version %d has no Up function", m.Version)
+	}
+	return nil
+}
+
+var (
+	// ErrLocked is returned when another runner holds the migration lock.
+	// It is lock.ErrLocked.
+	ErrLocked = lock.ErrLocked
+	// ErrIrreversible is returned by Down for migrations without a Down
+	// function, or applied ones that are not known to the Migrator.
+	ErrIrreversible = errors.New("migrate: migration cannot be reverted")
+)
+
+// Options configures a Migrator.
+type Options struct {
+	// Collection stores the applied versions. Defaults to "_migrations".
+	Collection string
+	// LockCollection holds the migration lock, named after Collection. It
+	// defaults to the lock package default, "locks".
+	LockCollection string
+	// Owner identifies the runner in the lock. Defaults to the lock package
+	// default, built from the host name and process id.
+	Owner string
+	// LockTTL is how long the lock is held without being renewed; it is
+	// renewed every third of it while migrations run. A runner that dies
+	// leaves the lock to be taken over once it expires. Defaults to 10
+	// minutes.
+	LockTTL time.Duration
+}
+
+// Migrator applies and reverts a set of migrations.
+type Migrator struct {
+	api        inceptiondb.API
+	migrations []Migration
+	opts       Options
+	locks      *lock.Manager
+}
+
+// New returns a Migrator for migrations on api.
+func New(api inceptiondb.API, migrations []Migration, opts Options) (*Migrator, error) {
+	if api == nil {
+		return nil, errors.New("migrate: nil API")
+	}
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if err := check(m); err != nil {
+			return nil, err
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migrate: version %d given twice", m.Version)
+		}
+	}
+	if opts.Collection == "" {
+		opts.Collection = "_migrations"
+	}
+	if opts.LockTTL <= 0 {
+		opts.LockTTL = 10 * time.Minute
+	}
+	locks := lock.New(api, lock.Options{Collection: opts.LockCollection, TTL: opts.LockTTL, Owner: opts.Owner})
+	return &Migrator{api: api, migrations: sorted, opts: opts, locks: locks}, nil
+}
+
+// Status describes a migration, registered or found applied.
+type Status struct {
+	Version   int64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Registered is false for applied versions the Migrator does not know.
+	Registered bool
+}
+
+// Status lists the migrations of the Migrator and the applied ones, ordered
+// by version.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	if err := m.setup(ctx); err != nil {
+		return nil, err
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int64]*Status{}
+	for _, mig := range m.migrations {
+		byVersion[mig.Version] = &Status{Version: mig.Version, Name: mig.Name, Registered: true}
+	}
+	for _, rec := range applied {
+		st, ok := byVersion[rec.Version]
+		if !ok {
+			st = &Status{Version: rec.Version, Name: rec.Name}
+			byVersion[rec.Version] = st
+		}
+		st.Applied = true
+		st.AppliedAt = rec.AppliedAt
+	}
+	out := make([]Status, 0, len(byVersion))
+	for _, st := range byVersion {
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// Up applies the pending migrations up to version to, all of them when to is
+// not positive, in version order. It returns the migrations it applied, which
+// are all recorded even when a later one fails.
+func (m *Migrator) Up(ctx context.Context, to int64) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		isApplied := map[int64]bool{}
+		for _, rec := range applied {
+			isApplied[rec.Version] = true
+		}
+		for _, mig := range m.migrations {
+			if isApplied[mig.Version] || (to > 0 && mig.Version > to) {
+				continue
+			}
+			if err := mig.Up(ctx, &DB{API: m.api}); err != nil {
+				return fmt.Errorf("migrate: up %d %s: %w", mig.Version, mig.Name, err)
+			}
+			if err := held(ctx); err != nil {
+				return err
+			}
+			if err := m.record(ctx, mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// Down reverts the applied migrations above version to, newest first, and
+// returns the migrations it reverted. Pass 0 to revert them all.
+func (m *Migrator) Down(ctx context.Context, to int64) ([]Migration, error) {
+	var done []Migration
+	err := m.locked(ctx, func(ctx context.Context) error {
+		applied, err := m.applied(ctx)
+		if err != nil {
+			return err
+		}
+		known := map[int64]Migration{}
+		for _, mig := range m.migrations {
+			known[mig.Version] = mig
+		}
+		for i := len(applied) - 1; i >= 0; i-- {
+			rec := applied[i]
+			if rec.Version <= to {
+				break
+			}
+			mig, ok := known[rec.Version]
+			if !ok || mig.Down == nil {
+				return fmt.Errorf("%w: %d %s", ErrIrreversible, rec.Version, rec.Name)
+			}
+			if err := mig.Down(ctx, &DB{API: m.api}); err != nil {
+				return fmt.Errorf("migrate: down %d %s: %w", mig.Version, mig.Name, err)
+			}
+			if err := held(ctx); err != nil {
+				return err
+			}
+			if err := m.forget(ctx, mig.Version); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// locked runs fn holding the migration lock, which is renewed in the
+// background while fn runs. If the lock is lost, the context given to fn is
+// cancelled.
+func (m *Migrator) locked(ctx context.Context, fn func(ctx context.Context) error) error {
+	if err := m.setup(ctx); err != nil {
+		return err
+	}
+	if err := m.locks.TryDo(ctx, m.opts.Collection, fn); err != nil {
+		if errors.Is(err, lock.ErrLocked) || errors.Is(err, lock.ErrLost) {
+			return fmt.Errorf("migrate: %w", err)
+		}
+		return err
+	}
+	return nil
+}
+
+// held returns the reason ctx, given by locked, was cancelled, such as the
+// loss of the lock. A migration that ran without the lock is not recorded,
+// since another runner may have applied it too.
+func held(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return nil
+}
+
+// setup creates the reserved collection and its index on ids, and the locks
+// collection.
+func (m *Migrator) setup(ctx context.Context) error {
+	_, err := m.api.CreateCollection(ctx, &inceptiondb.CreateCollectionRequest{Name: m.opts.Collection})
+	if err != nil && !inceptiondb.IsConflict(err) {
+		return fmt.Errorf("migrate: create %s: %w", m.opts.Collection, err)
+	}
+	_, err = m.api.CreateIndex(ctx, m.opts.Collection, &inceptiondb.CreateIndexRequest{
+		Name:    "id",
+		Type:    "map",
+		Options: map[string]any{"field": "id"},
+	})
+	if err != nil && !inceptiondb.IsConflict(err) {
+		return fmt.Errorf("migrate: create index on %s: %w", m.opts.Collection, err)
+	}
+	if err := m.locks.Setup(ctx); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+// record is an applied migration, as stored in the reserved collection.
+type record struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// applied returns the applied migrations ordered by version.
+func (m *Migrator) applied(ctx context.Context) ([]record, error) {
+	stream, err := m.api.Find(ctx, m.opts.Collection, &inceptiondb.FindRequest{
+		QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"kind": "migration"}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read applied migrations: %w", err)
+	}
+	var out []record
+	err = inceptiondb.Iterate(stream, func(rec *record) error {
+		out = append(out, *rec)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("migrate: read applied migrations: %w", err)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+func (m *Migrator) record(ctx context.Context, mig Migration) error {
+	stream, err := m.api.InsertDocuments(ctx, m.opts.Collection, record{
+		ID:        strconv.FormatInt(mig.Version, 10),
+		Kind:      "migration",
+		Version:   mig.Version,
+		Name:      mig.Name,
+		AppliedAt: time.Now().UTC(),
+	})
+	if err == nil {
+		_, err = count(stream)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate: record %d: %w", mig.Version, err)
+	}
+	return nil
+}
+
+func (m *Migrator) forget(ctx context.Context, version int64) error {
+	stream, err := m.api.Remove(ctx, m.opts.Collection, &inceptiondb.RemoveRequest{
+		QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"id": strconv.FormatInt(version, 10)}},
+	})
+	if err == nil {
+		_, err = count(stream)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate: forget %d: %w", version, err)
+	}
+	return nil
+}
+
+// count reads a stream to its end and returns the number of items.
+func count(stream *inceptiondb.JSONStream) (int, error) {
+	n := 0
+	err := inceptiondb.Iterate(stream, func(*json.RawMessage) error {
+		n++
+		return nil
+	})
+	return n, err
+}
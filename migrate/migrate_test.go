@@ -0,0 +1,277 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"inceptiondb"
+	"inceptiondb/inceptiondbtest"
+	"inceptiondb/lock"
+)
+
+func newTestClient(t *testing.T) *inceptiondb.Client {
+	t.Helper()
+	srv := inceptiondbtest.NewServer()
+	t.Cleanup(srv.Close)
+	client, err := inceptiondb.NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func testMigrations(log *[]string) []Migration {
+	return []Migration{
+		{
+			Version: 2,
+			Name:    "default status",
+			Up: func(ctx context.Context, db *DB) error {
+				*log = append(*log, "up 2")
+				_, err := db.SetDefaults(ctx, "users", map[string]any{"status": "active"})
+				return err
+			},
+			Down: func(ctx context.Context, db *DB) error {
+				*log = append(*log, "down 2")
+				_, err := db.SetDefaults(ctx, "users", map[string]any{})
+				return err
+			},
+		},
+		{
+			Version: 1,
+			Name:    "index users by email",
+			Up: func(ctx context.Context, db *DB) error {
+				*log = append(*log, "up 1")
+				_, err := db.CreateIndex(ctx, "users", &inceptiondb.CreateIndexRequest{
+					Name: "by_email", Type: "map", Options: map[string]any{"field": "email"},
+				})
+				return err
+			},
+			Down: func(ctx context.Context, db *DB) error {
+				*log = append(*log, "down 1")
+				return db.DropIndex(ctx, "users", "by_email")
+			},
+		},
+	}
+}
+
+func versions(migrations []Migration) []int64 {
+	var out []int64
+	for _, m := range migrations {
+		out = append(out, m.Version)
+	}
+	return out
+}
+
+func TestUpDown(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	if _, err := client.CreateCollection(ctx, &inceptiondb.CreateCollectionRequest{Name: "users"}); err != nil {
+		t.Fatal(err)
+	}
+	var log []string
+	m, err := New(client, testMigrations(&log), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done, err := m.Up(ctx, 1)
+	if err != nil || !reflect.DeepEqual(versions(done), []int64{1}) {
+		t.Fatalf("Up(1) = %v, %v; want [1]", versions(done), err)
+	}
+	done, err = m.Up(ctx, 0)
+	if err != nil || !reflect.DeepEqual(versions(done), []int64{2}) {
+		t.Fatalf("Up(0) = %v, %v; want [2]", versions(done), err)
+	}
+	if done, err = m.Up(ctx, 0); err != nil || len(done) != 0 {
+		t.Fatalf("Up(0) again = %v, %v; want nothing", versions(done), err)
+	}
+	if _, err := client.GetIndex(ctx, "users", "by_email"); err != nil {
+		t.Fatalf("GetIndex() error = %v", err)
+	}
+
+	statuses, err := m.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || !statuses[1].Applied || statuses[1].AppliedAt.IsZero() {
+		t.Fatalf("Status() = %+v", statuses)
+	}
+
+	done, err = m.Down(ctx, 0)
+	if err != nil || !reflect.DeepEqual(versions(done), []int64{2, 1}) {
+		t.Fatalf("Down(0) = %v, %v; want [2 1]", versions(done), err)
+	}
+	if want := []string{"up 1", "up 2", "down 2", "down 1"}; !reflect.DeepEqual(log, want) {
+		t.Fatalf("calls = %v, want %v", log, want)
+	}
+	statuses, _ = m.Status(ctx)
+	if statuses[0].Applied || statuses[1].Applied {
+		t.Fatalf("Status() after Down = %+v", statuses)
+	}
+}
+
+func TestUpStopsAtFailure(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	boom := errors.New("boom")
+	m, err := New(client, []Migration{
+		{Version: 1, Up: func(context.Context, *DB) error { return nil }},
+		{Version: 2, Up: func(context.Context, *DB) error { return boom }},
+		{Version: 3, Up: func(context.Context, *DB) error { t.Fatal("ran after a failure"); return nil }},
+	}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done, err := m.Up(ctx, 0)
+	if !errors.Is(err, boom) || !reflect.DeepEqual(versions(done), []int64{1}) {
+		t.Fatalf("Up() = %v, %v; want [1] and boom", versions(done), err)
+	}
+	// Version 1 has no Down.
+	if _, err := m.Down(ctx, 0); !errors.Is(err, ErrIrreversible) {
+		t.Fatalf("Down() error = %v, want ErrIrreversible", err)
+	}
+	// The lock was released despite the failures.
+	l, err := m.locks.TryAcquire(ctx, m.opts.Collection)
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v, want the lock released", err)
+	}
+	l.Release(ctx)
+}
+
+func TestLock(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	a, _ := New(client, nil, Options{Owner: "a", LockTTL: 50 * time.Millisecond})
+	b, _ := New(client, nil, Options{Owner: "b", LockTTL: time.Hour})
+	if err := a.setup(ctx); err != nil {
+		t.Fatal(err)
+	}
+	held, err := a.locks.TryAcquire(ctx, a.opts.Collection)
+	if err != nil {
+		t.Fatalf("TryAcquire() error = %v", err)
+	}
+	if _, err := b.Up(ctx, 0); !errors.Is(err, ErrLocked) {
+		t.Fatalf("Up() while locked error = %v, want ErrLocked", err)
+	}
+
+	// An expired lock is taken over, after which its former owner cannot
+	// renew it.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := b.Up(ctx, 0); err != nil {
+		t.Fatalf("Up() with an expired lock error = %v", err)
+	}
+	if err := held.Renew(ctx); !errors.Is(err, lock.ErrLost) {
+		t.Fatalf("Renew() of a lost lock error = %v, want ErrLost", err)
+	}
+	if _, err := a.Up(ctx, 0); err != nil {
+		t.Fatalf("Up() after release error = %v", err)
+	}
+}
+
+func TestLockRenewedDuringMigration(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	b, _ := New(client, nil, Options{Owner: "b"})
+
+	slow := Migration{Version: 1, Name: "slow", Up: func(ctx context.Context, db *DB) error {
+		// Outlives several TTLs; the lock must still be held.
+		time.Sleep(100 * time.Millisecond)
+		if _, err := b.Up(ctx, 0); !errors.Is(err, ErrLocked) {
+			t.Errorf("Up() during a long migration error = %v, want ErrLocked", err)
+		}
+		return nil
+	}}
+	a, _ := New(client, []Migration{slow}, Options{Owner: "a", LockTTL: 30 * time.Millisecond})
+	if _, err := a.Up(ctx, 0); err != nil {
+		t.Fatalf("Up() error = %v", err)
+	}
+
+	// A migration that loses the lock is not recorded.
+	stolen := Migration{Version: 2, Name: "stolen", Up: func(ctx context.Context, db *DB) error {
+		stream, err := db.Remove(ctx, "locks", &inceptiondb.RemoveRequest{})
+		if err != nil {
+			return err
+		}
+		stream.Close()
+		<-ctx.Done()
+		return nil
+	}}
+	a, _ = New(client, []Migration{slow, stolen}, Options{Owner: "a", LockTTL: 30 * time.Millisecond})
+	if _, err := a.Up(ctx, 0); !errors.Is(err, lock.ErrLost) {
+		t.Fatalf("Up() error = %v, want ErrLost", err)
+	}
+	statuses, err := a.Status(ctx)
+	if err != nil {
+		t.Fatalf("Status() error = %v", err)
+	}
+	if len(statuses) != 2 || !statuses[0].Applied || statuses[1].Applied {
+		t.Fatalf("Status() = %+v, want only version 1 applied", statuses)
+	}
+}
+
+func TestRewrite(t *testing.T) {
+	ctx := context.Background()
+	client := newTestClient(t)
+	stream, err := client.InsertDocuments(ctx, "users",
+		map[string]any{"id": "1", "name": "Ana Diaz"},
+		map[string]any{"id": "2", "name": "Bea"},
+		map[string]any{"id": "3", "first": "Cai"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Close()
+
+	db := &DB{API: client}
+	n, err := db.Rewrite(ctx, "users", inceptiondb.QueryOptions{}, "", func(doc map[string]any) (map[string]any, error) {
+		name, ok := doc["name"].(string)
+		if !ok {
+			return nil, nil
+		}
+		return map[string]any{"first": name}, nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("Rewrite() = %d, %v; want 2", n, err)
+	}
+	stream, err = client.Find(ctx, "users", &inceptiondb.FindRequest{
+		QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"id": "1"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]any
+	if err := stream.Next(&doc); err != nil || doc["first"] != "Ana Diaz" {
+		t.Fatalf("patched document = %v, %v", doc, err)
+	}
+	stream.Close()
+}
+
+func TestRegister(t *testing.T) {
+	Register(Migration{Version: 900001, Name: "registered", Up: func(context.Context, *DB) error { return nil }})
+	found := false
+	for _, m := range Registered() {
+		found = found || m.Version == 900001
+	}
+	if !found {
+		t.Fatal("Registered() lacks the registered migration")
+	}
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Register() of a duplicate version did not panic")
+		}
+	}()
+	Register(Migration{Version: 900001, Up: func(context.Context, *DB) error { return nil }})
+}
+
+func TestNewRejectsDuplicates(t *testing.T) {
+	up := func(context.Context, *DB) error { return nil }
+	if _, err := New(newTestClient(t), []Migration{{Version: 1, Up: up}, {Version: 1, Up: up}}, Options{}); err == nil {
+		t.Fatal("New() accepted a duplicate version")
+	}
+	if _, err := New(newTestClient(t), []Migration{{Version: 1}}, Options{}); err == nil {
+		t.Fatal("New() accepted a migration without Up")
+	}
+}
@@ -0,0 +1,539 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyField is the document field used by the outbox to detect
+// inserts that already reached the server.
+const DefaultIdempotencyField = "_idempotency"
+
+// ErrQueued is returned by the Outbox write methods when the request could not
+// be delivered and was stored to be replayed later. The returned error wraps
+// both ErrQueued and the delivery error, if any.
+var ErrQueued = errors.New("inceptiondb: request queued in outbox")
+
+// errOutboxEntry marks queued entries that can never be replayed.
+var errOutboxEntry = errors.New("malformed outbox entry")
+
+const (
+	outboxOpInsert = "insert"
+	outboxOpPatch  = "patch"
+	outboxOpRemove = "remove"
+)
+
+// Outbox stores writes that fail because the server is unreachable in a local
+// append-only file and replays them, in order, once requests start succeeding
+// again: after any successful request of the client, and before each new
+// write through the outbox. A write that finds entries still pending is
+// queued behind them so the server sees them in the original order.
+//
+// Every inserted document is stamped with an idempotency key (see
+// WithIdempotencyField) so a replayed insert that already reached the server is
+// skipped instead of duplicated. The key is part of the stored document, even
+// when the first attempt succeeds, since a failed attempt may have stored it.
+//
+// Patches and removes cannot be checked that way, so they are only queued, or
+// kept queued during a replay, when the failure shows they never reached the
+// server: the connection could not be made or the server answered 503 Service
+// Unavailable. After other failures the error is returned as-is, and a replay
+// drops the entry and counts it in OutboxStats.Dropped.
+type Outbox struct {
+	client        *Client
+	path          string
+	field         string
+	replayTimeout time.Duration
+
+	mu       sync.Mutex
+	file     *os.File
+	pending  []*outboxEntry
+	seq      uint64
+	dropped  uint64
+	lastErr  error
+	flushing bool
+	wg       sync.WaitGroup
+}
+
+// OutboxOption configures an Outbox instance.
+type OutboxOption func(*Outbox)
+
+// WithIdempotencyField overrides the field used to deduplicate inserts,
+// "_idempotency" by default.
+func WithIdempotencyField(field string) OutboxOption {
+	return func(o *Outbox) {
+		o.field = field
+	}
+}
+
+// WithReplayTimeout bounds how long a background replay, started after a
+// successful request, may take. Defaults to one minute. Flush uses the
+// deadline of its context instead.
+func WithReplayTimeout(d time.Duration) OutboxOption {
+	return func(o *Outbox) {
+		o.replayTimeout = d
+	}
+}
+
+// OutboxStats describes the state of the outbox queue.
+type OutboxStats struct {
+	// Depth is the number of queued requests.
+	Depth int
+	// OldestAge is how long the oldest queued request has been waiting.
+	OldestAge time.Duration
+	// Dropped counts queued requests discarded during replay because the
+	// server rejected them with a client error, or because a patch or remove
+	// failed after it may have reached the server.
+	Dropped uint64
+	// LastError is the last error observed while replaying.
+	LastError error
+}
+
+type outboxEntry struct {
+	Seq        uint64            `json:"seq"`
+	Ack        uint64            `json:"ack,omitempty"`
+	Op         string            `json:"op,omitempty"`
+	Collection string            `json:"collection,omitempty"`
+	Queued     int64             `json:"queued,omitempty"`
+	Documents  []json.RawMessage `json:"documents,omitempty"`
+	Request    json.RawMessage   `json:"request,omitempty"`
+}
+
+// NewOutbox opens (or creates) the outbox file at path and attaches it to the
+// client. Entries left by a previous process are replayed on the next
+// successful request, the next write through the outbox or when Flush is
+// called. A client has at most one outbox.
+func (c *Client) NewOutbox(path string, opts ...OutboxOption) (*Outbox, error) {
+	if path == "" {
+		return nil, errors.New("outbox path is required")
+	}
+	o := &Outbox{
+		client:        c,
+		path:          path,
+		field:         DefaultIdempotencyField,
+		replayTimeout: time.Minute,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open outbox: %w", err)
+	}
+	pending, seq, end, err := readOutbox(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read outbox: %w", err)
+	}
+	if err := resumeJournal(f, end); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("truncate outbox: %w", err)
+	}
+	o.file = f
+	o.pending = pending
+	o.seq = seq
+	c.outbox.Store(o)
+	return o, nil
+}
+
+// InsertDocuments inserts the documents, queueing them when the server cannot
+// be reached.
+func (o *Outbox) InsertDocuments(ctx context.Context, collection string, documents ...any) (*JSONStream, error) {
+	stamped := make([]json.RawMessage, len(documents))
+	for i, doc := range documents {
+		raw, err := o.stamp(doc)
+		if err != nil {
+			return nil, fmt.Errorf("encode insert payload: %w", err)
+		}
+		stamped[i] = raw
+	}
+	entry := &outboxEntry{Op: outboxOpInsert, Collection: collection, Documents: stamped}
+	return o.send(ctx, entry, func() (*JSONStream, error) {
+		return o.client.InsertDocuments(ctx, collection, rawDocuments(stamped)...)
+	})
+}
+
+// Patch patches the documents, queueing the request when the server cannot be
+// reached.
+func (o *Outbox) Patch(ctx context.Context, collection string, req *PatchRequest) (*JSONStream, error) {
+	if req == nil {
+		return nil, errors.New("patch request is nil")
+	}
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode patch request: %w", err)
+	}
+	entry := &outboxEntry{Op: outboxOpPatch, Collection: collection, Request: data}
+	return o.send(ctx, entry, func() (*JSONStream, error) {
+		return o.client.Patch(ctx, collection, req)
+	})
+}
+
+// Remove deletes the documents, queueing the request when the server cannot
+// be reached.
+func (o *Outbox) Remove(ctx context.Context, collection string, req *RemoveRequest) (*JSONStream, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("encode remove request: %w", err)
+	}
+	entry := &outboxEntry{Op: outboxOpRemove, Collection: collection, Request: data}
+	return o.send(ctx, entry, func() (*JSONStream, error) {
+		return o.client.Remove(ctx, collection, req)
+	})
+}
+
+// Stats returns the queue depth and the age of the oldest entry.
+func (o *Outbox) Stats() OutboxStats {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	stats := OutboxStats{Depth: len(o.pending), Dropped: o.dropped, LastError: o.lastErr}
+	if len(o.pending) > 0 {
+		stats.OldestAge = time.Since(time.Unix(0, o.pending[0].Queued))
+	}
+	return stats
+}
+
+// Flush replays the queued requests in order. It stops at the first request
+// that still cannot be delivered and returns its error.
+func (o *Outbox) Flush(ctx context.Context) error {
+	o.mu.Lock()
+	if o.flushing {
+		o.mu.Unlock()
+		return nil
+	}
+	o.flushing = true
+	o.mu.Unlock()
+
+	err := o.replay(ctx)
+
+	o.mu.Lock()
+	o.flushing = false
+	o.mu.Unlock()
+	return err
+}
+
+// Close waits for a background replay to finish, detaches the outbox from the
+// client and closes the file. Queued entries stay on disk.
+func (o *Outbox) Close() error {
+	o.wg.Wait()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.client.outbox.CompareAndSwap(o, nil)
+	if o.file == nil {
+		return nil
+	}
+	err := o.file.Close()
+	o.file = nil
+	return err
+}
+
+// notify is called by the client after every successful request and starts a
+// background replay when entries are pending.
+func (o *Outbox) notify() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	if o.flushing || len(o.pending) == 0 || o.file == nil {
+		o.mu.Unlock()
+		return
+	}
+	o.flushing = true
+	o.wg.Add(1)
+	o.mu.Unlock()
+
+	go func() {
+		defer o.wg.Done()
+		ctx, cancel := context.WithTimeout(context.Background(), o.replayTimeout)
+		defer cancel()
+		o.replay(ctx)
+		o.mu.Lock()
+		o.flushing = false
+		o.mu.Unlock()
+	}()
+}
+
+// send runs fn, or queues entry when it cannot be delivered. While entries
+// are pending, it first tries to replay them, so an application writing only
+// through the outbox still drains it once the server is back; the new write
+// is queued behind them unless they all went through.
+func (o *Outbox) send(ctx context.Context, entry *outboxEntry, fn func() (*JSONStream, error)) (*JSONStream, error) {
+	o.mu.Lock()
+	queued := len(o.pending) > 0
+	o.mu.Unlock()
+	if queued {
+		o.Flush(ctx)
+		o.mu.Lock()
+		queued = len(o.pending) > 0
+		o.mu.Unlock()
+	}
+
+	var err error
+	if !queued {
+		var stream *JSONStream
+		stream, err = fn()
+		if err == nil || !outboxRetryable(entry.Op, err) {
+			return stream, err
+		}
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if qerr := o.enqueue(entry); qerr != nil {
+		return nil, errors.Join(err, qerr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrQueued, err)
+	}
+	return nil, ErrQueued
+}
+
+func (o *Outbox) replay(ctx context.Context) error {
+	for {
+		o.mu.Lock()
+		if len(o.pending) == 0 || o.file == nil {
+			o.mu.Unlock()
+			return nil
+		}
+		entry := o.pending[0]
+		o.mu.Unlock()
+
+		err := o.apply(ctx, entry)
+
+		o.mu.Lock()
+		if err != nil {
+			o.lastErr = err
+			if ctx.Err() != nil || outboxRetryable(entry.Op, err) {
+				o.mu.Unlock()
+				return err
+			}
+			o.dropped++
+		}
+		werr := o.ack(entry)
+		o.mu.Unlock()
+		if werr != nil {
+			return werr
+		}
+	}
+}
+
+func (o *Outbox) apply(ctx context.Context, entry *outboxEntry) error {
+	var stream *JSONStream
+	var err error
+	switch entry.Op {
+	case outboxOpInsert:
+		var missing []any
+		for _, doc := range entry.Documents {
+			exists, err := o.delivered(ctx, entry.Collection, doc)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				missing = append(missing, doc)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		stream, err = o.client.InsertDocuments(ctx, entry.Collection, missing...)
+	case outboxOpPatch:
+		req := &PatchRequest{}
+		if err := json.Unmarshal(entry.Request, req); err != nil {
+			return fmt.Errorf("%w: %w", errOutboxEntry, err)
+		}
+		stream, err = o.client.Patch(ctx, entry.Collection, req)
+	case outboxOpRemove:
+		req := &RemoveRequest{}
+		if err := json.Unmarshal(entry.Request, req); err != nil {
+			return fmt.Errorf("%w: %w", errOutboxEntry, err)
+		}
+		stream, err = o.client.Remove(ctx, entry.Collection, req)
+	default:
+		return fmt.Errorf("%w: unknown operation %q", errOutboxEntry, entry.Op)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = collectRaw(stream)
+	return err
+}
+
+func (o *Outbox) delivered(ctx context.Context, collection string, doc json.RawMessage) (bool, error) {
+	fields, err := decodeRawObject(doc)
+	if err != nil {
+		return false, fmt.Errorf("%w: %w", errOutboxEntry, err)
+	}
+	key, ok := fields[o.field]
+	if !ok {
+		return false, nil
+	}
+	stream, err := o.client.Find(ctx, collection, &FindRequest{QueryOptions: QueryOptions{
+		Filter: map[string]any{o.field: key},
+		Limit:  1,
+	}})
+	if err != nil {
+		return false, err
+	}
+	found, err := collectRaw(stream)
+	return len(found) > 0, err
+}
+
+func (o *Outbox) stamp(doc any) (json.RawMessage, error) {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	fields, err := decodeRawObject(data)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := fields[o.field]; ok {
+		return data, nil
+	}
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	fields[o.field], _ = json.Marshal(hex.EncodeToString(key))
+	return json.Marshal(fields)
+}
+
+// enqueue must be called with o.mu held.
+func (o *Outbox) enqueue(entry *outboxEntry) error {
+	if o.file == nil {
+		return errors.New("outbox is closed")
+	}
+	o.seq++
+	entry.Seq = o.seq
+	entry.Queued = time.Now().UnixNano()
+	if err := o.write(entry); err != nil {
+		o.seq--
+		return err
+	}
+	o.pending = append(o.pending, entry)
+	return nil
+}
+
+// ack must be called with o.mu held.
+func (o *Outbox) ack(entry *outboxEntry) error {
+	o.pending = o.pending[1:]
+	if len(o.pending) == 0 {
+		if err := o.file.Truncate(0); err != nil {
+			return fmt.Errorf("truncate outbox: %w", err)
+		}
+		if _, err := o.file.Seek(0, io.SeekStart); err != nil {
+			return fmt.Errorf("seek outbox: %w", err)
+		}
+		return nil
+	}
+	return o.write(&outboxEntry{Ack: entry.Seq})
+}
+
+func (o *Outbox) write(entry *outboxEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("encode outbox entry: %w", err)
+	}
+	line := fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data)
+	if _, err := o.file.WriteString(line); err != nil {
+		return fmt.Errorf("write outbox: %w", err)
+	}
+	if err := o.file.Sync(); err != nil {
+		return fmt.Errorf("sync outbox: %w", err)
+	}
+	return nil
+}
+
+// readOutbox returns the entries not acknowledged yet, the highest sequence
+// number and the offset just past the last valid entry.
+func readOutbox(r io.Reader) ([]*outboxEntry, uint64, int64, error) {
+	var pending []*outboxEntry
+	acked := map[uint64]bool{}
+	seq := uint64(0)
+	end := int64(0)
+
+	journal := newJournalScanner(r)
+	for journal.Scan() {
+		checksum, data, ok := bytes.Cut(journal.Bytes(), []byte(" "))
+		if !ok || fmt.Sprintf("%08x", crc32.ChecksumIEEE(data)) != string(checksum) {
+			// Corrupted or torn line; skip it rather than replaying garbage.
+			continue
+		}
+		entry := &outboxEntry{}
+		if err := json.Unmarshal(data, entry); err != nil {
+			continue
+		}
+		end = journal.offset
+		if entry.Ack != 0 {
+			acked[entry.Ack] = true
+			continue
+		}
+		pending = append(pending, entry)
+		if entry.Seq > seq {
+			seq = entry.Seq
+		}
+	}
+	if err := journal.Err(); err != nil {
+		return nil, 0, 0, err
+	}
+
+	remaining := pending[:0]
+	for _, entry := range pending {
+		if !acked[entry.Seq] {
+			remaining = append(remaining, entry)
+		}
+	}
+	return remaining, seq, end, nil
+}
+
+// outboxRetryable reports whether err means the op request may succeed
+// later. Inserts, which replays deduplicate, are retried after transport
+// failures and server errors; patches and removes only when the request never
+// reached the server. Rejections and cancellations are never retried.
+func outboxRetryable(op string, err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, errOutboxEntry) {
+		return false
+	}
+	if op != outboxOpInsert {
+		return outboxUndelivered(err)
+	}
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 500
+	}
+	return true
+}
+
+// outboxUndelivered reports whether err shows the request was not applied:
+// the connection could not be made or the server was unavailable.
+func outboxUndelivered(err error) bool {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusServiceUnavailable
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func rawDocuments(docs []json.RawMessage) []any {
+	out := make([]any, len(docs))
+	for i, doc := range docs {
+		out[i] = doc
+	}
+	return out
+}
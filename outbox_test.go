@@ -0,0 +1,184 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutboxReplay(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	outbox, err := client.NewOutbox(path)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+
+	server.failOn = "orders:insert"
+	if _, err := outbox.InsertDocuments(ctx, "orders", map[string]any{"id": "1"}, map[string]any{"id": "2"}); !errors.Is(err, ErrQueued) {
+		t.Fatalf("InsertDocuments() error = %v, want ErrQueued", err)
+	}
+	if _, err := outbox.Patch(ctx, "orders", &PatchRequest{
+		QueryOptions: QueryOptions{Filter: map[string]any{"id": "1"}},
+		Patch:        map[string]any{"status": "paid"},
+	}); !errors.Is(err, ErrQueued) {
+		t.Fatalf("Patch() error = %v, want ErrQueued", err)
+	}
+	if stats := outbox.Stats(); stats.Depth != 2 || stats.OldestAge <= 0 {
+		t.Fatalf("Stats() = %+v, want depth 2", stats)
+	}
+
+	// The first document reached the server even though the client saw an
+	// error; replaying must not duplicate it.
+	first := map[string]any{}
+	json.Unmarshal(outbox.pending[0].Documents[0], &first)
+	server.collections["orders"] = []map[string]any{first}
+
+	if err := outbox.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	outbox, err = client.NewOutbox(path)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	if depth := outbox.Stats().Depth; depth != 2 {
+		t.Fatalf("Stats().Depth = %d after reopening, want 2", depth)
+	}
+
+	server.failOn = ""
+	if err := outbox.Flush(ctx); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if depth := outbox.Stats().Depth; depth != 0 {
+		t.Fatalf("Stats().Depth = %d after flush, want 0", depth)
+	}
+
+	orders := server.documents("orders")
+	if len(orders) != 2 {
+		t.Fatalf("orders = %v, want 2 documents", orders)
+	}
+	if orders[0]["status"] != "paid" || orders[0][DefaultIdempotencyField] == nil {
+		t.Fatalf("orders[0] = %v, want patched and stamped document", orders[0])
+	}
+	outbox.Close()
+}
+
+func TestOutboxAmbiguousPatchIsNotQueued(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	outbox, err := client.NewOutbox(filepath.Join(t.TempDir(), "outbox.log"))
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	defer outbox.Close()
+
+	// A 500 may come after the patch was applied, so it is not replayed.
+	server.failOn = "orders:patch"
+	_, err = outbox.Patch(ctx, "orders", &PatchRequest{Patch: map[string]any{"status": "paid"}})
+	if err == nil || errors.Is(err, ErrQueued) {
+		t.Fatalf("Patch() error = %v, want an unqueued error", err)
+	}
+	if depth := outbox.Stats().Depth; depth != 0 {
+		t.Fatalf("Stats().Depth = %d, want 0", depth)
+	}
+}
+
+func TestOutboxQueuesUndeliveredPatch(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	client, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outbox, err := client.NewOutbox(filepath.Join(t.TempDir(), "outbox.log"))
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	defer outbox.Close()
+
+	_, err = outbox.Remove(context.Background(), "orders", &RemoveRequest{})
+	if !errors.Is(err, ErrQueued) {
+		t.Fatalf("Remove() error = %v, want ErrQueued", err)
+	}
+}
+
+func TestOutboxTornEntry(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	outbox, err := client.NewOutbox(path)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	server.failOn = "orders:insert"
+	if _, err := outbox.InsertDocuments(ctx, "orders", map[string]any{"id": "1"}); !errors.Is(err, ErrQueued) {
+		t.Fatalf("InsertDocuments() error = %v, want ErrQueued", err)
+	}
+	// Simulate a crash in the middle of appending an entry.
+	outbox.file.WriteString("0badc0de {\"op\":\"ins")
+	outbox.file.Close()
+
+	outbox, err = client.NewOutbox(path)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	if _, err := outbox.InsertDocuments(ctx, "orders", map[string]any{"id": "2"}); !errors.Is(err, ErrQueued) {
+		t.Fatalf("InsertDocuments() error = %v, want ErrQueued", err)
+	}
+	outbox.Close()
+
+	outbox, err = client.NewOutbox(path)
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	defer outbox.Close()
+	if depth := outbox.Stats().Depth; depth != 2 {
+		t.Fatalf("Stats().Depth = %d after reopening, want 2", depth)
+	}
+}
+
+func TestOutboxReplaysBeforeWrite(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	outbox, err := client.NewOutbox(filepath.Join(t.TempDir(), "outbox.log"))
+	if err != nil {
+		t.Fatalf("NewOutbox() error = %v", err)
+	}
+	defer outbox.Close()
+
+	server.failOn = "orders:insert"
+	for _, id := range []string{"1", "2"} {
+		if _, err := outbox.InsertDocuments(ctx, "orders", map[string]any{"id": id}); !errors.Is(err, ErrQueued) {
+			t.Fatalf("InsertDocuments(%s) error = %v, want ErrQueued", id, err)
+		}
+	}
+
+	// The server is back; the next write drains the queue before its own.
+	server.failOn = ""
+	stream, err := outbox.InsertDocuments(ctx, "orders", map[string]any{"id": "3"})
+	if err != nil {
+		t.Fatalf("InsertDocuments(3) error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("read insert result: %v", err)
+	}
+	if depth := outbox.Stats().Depth; depth != 0 {
+		t.Fatalf("Stats().Depth = %d, want 0", depth)
+	}
+	orders := server.documents("orders")
+	if len(orders) != 3 {
+		t.Fatalf("orders = %v, want 3 documents", orders)
+	}
+	for i, want := range []string{"1", "2", "3"} {
+		if orders[i]["id"] != want {
+			t.Fatalf("orders[%d] = %v, want id %s", i, orders[i], want)
+		}
+	}
+}
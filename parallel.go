@@ -0,0 +1,176 @@
+package inceptiondb
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// ParallelOption configures ParallelIterate.
+type ParallelOption func(*parallelConfig)
+
+type parallelConfig struct {
+	ordered bool
+}
+
+// PreserveOrder makes ParallelIterate call fn sequentially in stream order.
+// Items are still decoded in parallel.
+func PreserveOrder() ParallelOption {
+	return func(c *parallelConfig) {
+		c.ordered = true
+	}
+}
+
+// ParallelIterate is Iterate with decoding spread over a pool of workers,
+// runtime.GOMAXPROCS(0) when workers is not positive. Raw items are read off
+// the stream on the calling goroutine and decoded with the stream's codec by
+// the workers. By default the workers also call fn, concurrently and in no
+// particular order, so fn must be safe for concurrent use; with PreserveOrder
+// fn is called from a single goroutine in stream order.
+//
+// The first error returned by fn or met reading the stream stops the
+// iteration: items not yet handed to fn are dropped, the stream is closed and
+// the error is returned. Returning ErrStopIteration stops it without error.
+// The stream is always closed when ParallelIterate returns.
+func ParallelIterate[T any](s *JSONStream, workers int, fn func(*T) error, opts ...ParallelOption) error {
+	if s == nil {
+		return errors.New("nil stream")
+	}
+	if fn == nil {
+		return errors.New("nil iterator callback")
+	}
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	var cfg parallelConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	defer s.Close()
+
+	type job struct {
+		seq  int64
+		data []byte
+	}
+	type result struct {
+		seq  int64
+		item *T
+		err  error
+	}
+
+	done := make(chan struct{})
+	var (
+		stopOnce sync.Once
+		firstErr error
+	)
+	stop := func(err error) {
+		stopOnce.Do(func() {
+			firstErr = err
+			close(done)
+		})
+	}
+	stopped := func() bool {
+		select {
+		case <-done:
+			return true
+		default:
+			return false
+		}
+	}
+
+	jobs := make(chan job, workers)
+	results := make(chan result, workers)
+	// window bounds the items between the reader and fn, so a slow item
+	// cannot make ordered results pile up.
+	window := make(chan struct{}, 4*workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				item := new(T)
+				err := unmarshal(s.codec, j.data, item)
+				if cfg.ordered {
+					select {
+					case results <- result{seq: j.seq, item: item, err: err}:
+					case <-done:
+					}
+					continue
+				}
+				if err == nil && !stopped() {
+					err = fn(item)
+				}
+				<-window
+				if err != nil {
+					stop(err)
+				}
+			}
+		}()
+	}
+
+	collected := make(chan struct{})
+	if cfg.ordered {
+		go func() {
+			defer close(collected)
+			pending := map[int64]result{}
+			var next int64
+			for r := range results {
+				pending[r.seq] = r
+				for {
+					r, ok := pending[next]
+					if !ok {
+						break
+					}
+					delete(pending, next)
+					next++
+					err := r.err
+					if err == nil && !stopped() {
+						err = fn(r.item)
+					}
+					<-window
+					if err != nil {
+						stop(err)
+					}
+				}
+			}
+		}()
+	} else {
+		close(collected)
+	}
+
+	var seq int64
+read:
+	for {
+		select {
+		case window <- struct{}{}:
+		case <-done:
+			break read
+		}
+		line, err := s.NextRaw()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			stop(err)
+			break
+		}
+		select {
+		case jobs <- job{seq: seq, data: append([]byte(nil), line...)}:
+			seq++
+		case <-done:
+			break read
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(results)
+	<-collected
+
+	if errors.Is(firstErr, ErrStopIteration) {
+		return nil
+	}
+	return firstErr
+}
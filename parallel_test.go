@@ -0,0 +1,101 @@
+package inceptiondb
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func parallelPayload(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "{\"id\":%d}\n", i)
+	}
+	return b.String()
+}
+
+func TestParallelIterate(t *testing.T) {
+	stream := newTestStream(t, parallelPayload(1000))
+	var (
+		mu   sync.Mutex
+		seen = map[int]bool{}
+	)
+	err := ParallelIterate(stream, 8, func(doc *testDocument) error {
+		mu.Lock()
+		seen[doc.ID] = true
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ParallelIterate() error = %v", err)
+	}
+	if len(seen) != 1000 {
+		t.Fatalf("ParallelIterate() saw %d items, want 1000", len(seen))
+	}
+	if !stream.closed {
+		t.Fatal("stream was not closed")
+	}
+}
+
+func TestParallelIteratePreserveOrder(t *testing.T) {
+	stream := newTestStream(t, parallelPayload(1000))
+	var ids []int
+	err := ParallelIterate(stream, 8, func(doc *testDocument) error {
+		ids = append(ids, doc.ID)
+		return nil
+	}, PreserveOrder())
+	if err != nil {
+		t.Fatalf("ParallelIterate() error = %v", err)
+	}
+	for i, id := range ids {
+		if id != i {
+			t.Fatalf("ids[%d] = %d, want in order", i, id)
+		}
+	}
+	if len(ids) != 1000 {
+		t.Fatalf("ParallelIterate() saw %d items, want 1000", len(ids))
+	}
+}
+
+func TestParallelIterateErrors(t *testing.T) {
+	boom := errors.New("boom")
+	for _, ordered := range []bool{false, true} {
+		var opts []ParallelOption
+		if ordered {
+			opts = append(opts, PreserveOrder())
+		}
+
+		var calls atomic.Int64
+		stream := newTestStream(t, parallelPayload(10000))
+		err := ParallelIterate(stream, 4, func(doc *testDocument) error {
+			calls.Add(1)
+			if doc.ID == 10 {
+				return boom
+			}
+			return nil
+		}, opts...)
+		if !errors.Is(err, boom) {
+			t.Fatalf("ordered=%v: ParallelIterate() error = %v, want boom", ordered, err)
+		}
+		if calls.Load() > 1000 {
+			t.Fatalf("ordered=%v: fn called %d times after the error", ordered, calls.Load())
+		}
+
+		stream = newTestStream(t, parallelPayload(100))
+		err = ParallelIterate(stream, 4, func(doc *testDocument) error {
+			return ErrStopIteration
+		}, opts...)
+		if err != nil {
+			t.Fatalf("ordered=%v: ParallelIterate() with ErrStopIteration error = %v", ordered, err)
+		}
+
+		stream = newTestStream(t, "{\"id\":1}\n{\"id\":\"x\"}\n")
+		err = ParallelIterate(stream, 2, func(doc *testDocument) error { return nil }, opts...)
+		if err == nil {
+			t.Fatalf("ordered=%v: ParallelIterate() decode error = nil", ordered)
+		}
+	}
+}
@@ -0,0 +1,454 @@
+// Package recorder provides an http.RoundTripper that records the
+// interactions of a client with an InceptionDB server into a cassette file and
+// replays them later, so tests can run offline and deterministically.
+//
+//	rec, err := recorder.New("testdata/users.json", recorder.ModeReplay)
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer rec.Close()
+//	client, err := inceptiondb.NewClient(baseURL,
+//		inceptiondb.WithHTTPClient(&http.Client{Transport: rec}))
+//
+// Requests are matched by method, path and query, and by their JSON body
+// normalised so that key order, whitespace and redacted values do not matter.
+// Each recorded interaction is replayed once, in recording order.
+package recorder
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Mode selects whether a Recorder talks to the server or to the cassette.
+type Mode int
+
+const (
+	// ModeReplay answers requests from the cassette and never reaches the
+	// network.
+	ModeReplay Mode = iota
+	// ModeRecord forwards requests to the server and writes the interactions
+	// to the cassette on Close.
+	ModeRecord
+	// ModeReplayOrRecord replays when the cassette exists and records
+	// otherwise.
+	ModeReplayOrRecord
+)
+
+// ErrNoInteraction is returned in replay mode for requests that match no
+// recorded interaction.
+var ErrNoInteraction = errors.New("recorder: no matching interaction")
+
+// RedactedValue replaces the values of fields redacted with
+// WithRedactedFields.
+const RedactedValue = "REDACTED"
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Cassette is the content of a cassette file.
+type Cassette struct {
+	Interactions []Interaction `json:"interactions"`
+}
+
+// Interaction is a recorded request and its response.
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+// Request is the recorded part of a request.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query,omitempty"`
+	Body   string `json:"body,omitempty"`
+}
+
+// Response is a recorded response. Body holds the bytes read by the client,
+// which for a stream closed early is a prefix of what the server sent.
+type Response struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   string            `json:"body,omitempty"`
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithTransport sets the transport used to reach the server when recording.
+// It defaults to http.DefaultTransport.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(r *Recorder) {
+		r.transport = rt
+	}
+}
+
+// WithRedactedFields replaces the values of the named JSON fields, at any
+// depth, with RedactedValue in the cassette and ignores them when matching.
+func WithRedactedFields(fields ...string) Option {
+	return func(r *Recorder) {
+		for _, field := range fields {
+			r.redacted[field] = true
+		}
+	}
+}
+
+// WithoutUUIDRedaction keeps UUID values as they are. By default every string
+// shaped like a UUID, such as ids generated by uuid() defaults, is replaced
+// with a stable placeholder UUID in the cassette and ignored when matching.
+func WithoutUUIDRedaction() Option {
+	return func(r *Recorder) {
+		r.keepUUIDs = true
+	}
+}
+
+// Recorder is an http.RoundTripper recording to or replaying from a cassette.
+type Recorder struct {
+	path      string
+	mode      Mode
+	transport http.RoundTripper
+	redacted  map[string]bool
+	keepUUIDs bool
+
+	mu       sync.Mutex
+	recorded []*recording
+	uuids    map[string]string
+	replay   []Interaction
+	used     []bool
+}
+
+// New returns a recorder using the cassette at path. In replay mode the
+// cassette must exist.
+func New(path string, mode Mode, opts ...Option) (*Recorder, error) {
+	if path == "" {
+		return nil, errors.New("cassette path is required")
+	}
+	r := &Recorder{
+		path:      path,
+		mode:      mode,
+		transport: http.DefaultTransport,
+		redacted:  map[string]bool{},
+		uuids:     map[string]string{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.mode == ModeReplayOrRecord {
+		r.mode = ModeRecord
+		if _, err := os.Stat(path); err == nil {
+			r.mode = ModeReplay
+		}
+	}
+	if r.mode == ModeReplay {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read cassette: %w", err)
+		}
+		var cassette Cassette
+		if err := json.Unmarshal(data, &cassette); err != nil {
+			return nil, fmt.Errorf("decode cassette: %w", err)
+		}
+		r.replay = cassette.Interactions
+		r.used = make([]bool, len(cassette.Interactions))
+	}
+	return r, nil
+}
+
+// Mode returns the mode the recorder runs in, resolving ModeReplayOrRecord.
+func (r *Recorder) Mode() Mode {
+	return r.mode
+}
+
+// RoundTrip implements http.RoundTripper.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	if r.mode == ModeReplay {
+		return r.replayRequest(req)
+	}
+	return r.record(req)
+}
+
+// Close writes the cassette when recording. Streams still open are recorded
+// with the bytes read so far.
+func (r *Recorder) Close() error {
+	if r.mode != ModeRecord {
+		return nil
+	}
+	r.mu.Lock()
+	recorded := append([]*recording(nil), r.recorded...)
+	r.mu.Unlock()
+
+	cassette := Cassette{Interactions: make([]Interaction, 0, len(recorded))}
+	for _, rec := range recorded {
+		rec.complete()
+		r.mu.Lock()
+		cassette.Interactions = append(cassette.Interactions, rec.interaction)
+		r.mu.Unlock()
+	}
+
+	data, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode cassette: %w", err)
+	}
+	if err := os.WriteFile(r.path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	return nil
+}
+
+func (r *Recorder) record(req *http.Request) (*http.Response, error) {
+	rec := &recording{recorder: r, interaction: Interaction{Request: Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.RawQuery,
+	}}}
+	if req.Body != nil && req.Body != http.NoBody {
+		// The body is captured while the transport sends it, so streamed
+		// inserts keep streaming.
+		rec.sent = &lockedBuffer{}
+		rec.sentGzip = req.Header.Get("Content-Encoding") == "gzip"
+		req = req.Clone(req.Context())
+		req.Body = &teeBody{Reader: io.TeeReader(req.Body, rec.sent), Closer: req.Body}
+	}
+
+	resp, err := r.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	rec.receivedGzip = resp.Header.Get("Content-Encoding") == "gzip"
+	rec.interaction.Response = Response{Status: resp.StatusCode}
+	if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+		rec.interaction.Response.Header = map[string]string{"Content-Type": contentType}
+	}
+	r.mu.Lock()
+	r.recorded = append(r.recorded, rec)
+	r.mu.Unlock()
+
+	resp.Body = &recordingBody{ReadCloser: resp.Body, tee: io.TeeReader(resp.Body, &rec.received), rec: rec}
+	return resp, nil
+}
+
+func (r *Recorder) replayRequest(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("read request body: %w", err)
+		}
+		body = gunzip(data, req.Header.Get("Content-Encoding") == "gzip")
+	}
+	key := r.redact(body, true)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, in := range r.replay {
+		if r.used[i] {
+			continue
+		}
+		if in.Request.Method != req.Method || in.Request.Path != req.URL.Path || in.Request.Query != req.URL.RawQuery {
+			continue
+		}
+		if r.redact([]byte(in.Request.Body), true) != key {
+			continue
+		}
+		r.used[i] = true
+		header := http.Header{}
+		for name, value := range in.Response.Header {
+			header.Set(name, value)
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+			StatusCode:    in.Response.Status,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        header,
+			Body:          io.NopCloser(strings.NewReader(in.Response.Body)),
+			ContentLength: int64(len(in.Response.Body)),
+			Request:       req,
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL.RequestURI())
+}
+
+// redact normalises a body made of JSON values, one per line or a single
+// document, and replaces volatile values. For matching keys every redacted
+// value becomes a constant; for the cassette, UUIDs are mapped to stable
+// placeholders so references between interactions survive. Bodies that are
+// not JSON are returned unchanged.
+func (r *Recorder) redact(body []byte, key bool) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+	var out strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 64*1024), 64<<20)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var value any
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&value); err != nil || dec.More() {
+			return r.redactRaw(body, key)
+		}
+		data, err := json.Marshal(r.redactValue(value, key))
+		if err != nil {
+			return r.redactRaw(body, key)
+		}
+		out.Write(data)
+		out.WriteByte('\n')
+	}
+	if scanner.Err() != nil {
+		return r.redactRaw(body, key)
+	}
+	return out.String()
+}
+
+// redactRaw handles bodies that are a single JSON document spread over
+// several lines, falling back to the raw text.
+func (r *Recorder) redactRaw(body []byte, key bool) string {
+	var value any
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	if err := dec.Decode(&value); err != nil || dec.More() {
+		return string(body)
+	}
+	data, err := json.Marshal(r.redactValue(value, key))
+	if err != nil {
+		return string(body)
+	}
+	return string(data) + "\n"
+}
+
+func (r *Recorder) redactValue(value any, key bool) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for name, field := range v {
+			if r.redacted[name] {
+				v[name] = RedactedValue
+				continue
+			}
+			v[name] = r.redactValue(field, key)
+		}
+		return v
+	case []any:
+		for i := range v {
+			v[i] = r.redactValue(v[i], key)
+		}
+		return v
+	case string:
+		if r.keepUUIDs || !uuidPattern.MatchString(v) {
+			return v
+		}
+		if key {
+			return "<uuid>"
+		}
+		placeholder, ok := r.uuids[v]
+		if !ok {
+			placeholder = fmt.Sprintf("00000000-0000-4000-8000-%012x", len(r.uuids)+1)
+			r.uuids[v] = placeholder
+		}
+		return placeholder
+	default:
+		return v
+	}
+}
+
+type teeBody struct {
+	io.Reader
+	io.Closer
+}
+
+// recording is an interaction being recorded. Its bodies are redacted into the
+// interaction once the response is read or closed, or when the cassette is
+// written.
+type recording struct {
+	recorder    *Recorder
+	interaction Interaction
+	sent        *lockedBuffer
+	received    lockedBuffer
+	// Compressed bodies are stored decoded; replayed responses are plain.
+	sentGzip     bool
+	receivedGzip bool
+	once         sync.Once
+}
+
+func (rec *recording) complete() {
+	rec.once.Do(func() {
+		r := rec.recorder
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if rec.sent != nil {
+			rec.interaction.Request.Body = r.redact(gunzip(rec.sent.Bytes(), rec.sentGzip), false)
+		}
+		rec.interaction.Response.Body = r.redact(gunzip(rec.received.Bytes(), rec.receivedGzip), false)
+	})
+}
+
+// gunzip decodes data when gzipped, keeping what could be decoded from a
+// stream closed early.
+func gunzip(data []byte, gzipped bool) []byte {
+	if !gzipped {
+		return data
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	decoded, _ := io.ReadAll(zr)
+	return decoded
+}
+
+// recordingBody captures what the client reads from a response.
+type recordingBody struct {
+	io.ReadCloser
+	tee io.Reader
+	rec *recording
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.tee.Read(p)
+	if err == io.EOF {
+		b.rec.complete()
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.rec.complete()
+	return b.ReadCloser.Close()
+}
+
+// lockedBuffer is a bytes.Buffer safe for a writer and a reader on different
+// goroutines, as the transport may still be sending a request body.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
@@ -0,0 +1,171 @@
+package recorder
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"inceptiondb"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	var generated atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/collections/users:insert":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			for _, line := range strings.Split(strings.TrimSpace(string(body)), "\n") {
+				id := fmt.Sprintf("6f1c2a4e-0000-4000-8000-%012d", generated.Add(1))
+				fmt.Fprintf(w, "{\"id\":%q,\"doc\":%s,\"token\":\"secret\"}\n", id, line)
+			}
+		case "/v1/collections/users:find":
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			fmt.Fprintf(w, "{\"id\":\"6f1c2a4e-0000-4000-8000-%012d\"}\n", generated.Load())
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	ctx := context.Background()
+
+	run := func(rec *Recorder) []string {
+		t.Helper()
+		client, err := inceptiondb.NewClient(server.URL, inceptiondb.WithHTTPClient(&http.Client{Transport: rec}))
+		if err != nil {
+			t.Fatalf("NewClient() error = %v", err)
+		}
+		var ids []string
+		collect := func(stream *inceptiondb.JSONStream, err error) {
+			t.Helper()
+			if err != nil {
+				t.Fatalf("request error = %v", err)
+			}
+			if err := inceptiondb.Iterate(stream, func(doc *struct {
+				ID    string `json:"id"`
+				Token string `json:"token"`
+			}) error {
+				ids = append(ids, doc.ID+"/"+doc.Token)
+				return nil
+			}); err != nil {
+				t.Fatalf("Iterate() error = %v", err)
+			}
+		}
+		collect(client.InsertDocuments(ctx, "users", map[string]any{"name": "a", "b": 1}, map[string]any{"name": "b"}))
+		collect(client.Find(ctx, "users", &inceptiondb.FindRequest{QueryOptions: inceptiondb.QueryOptions{Filter: map[string]any{"name": "b"}}}))
+		return ids
+	}
+
+	rec, err := New(cassette, ModeRecord, WithTransport(server.Client().Transport), WithRedactedFields("token"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	recorded := run(rec)
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if recorded[0] != "6f1c2a4e-0000-4000-8000-000000000001/secret" {
+		t.Fatalf("recording changed the live response: %v", recorded)
+	}
+
+	data, err := os.ReadFile(cassette)
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if strings.Contains(string(data), "secret") || strings.Contains(string(data), "6f1c2a4e") {
+		t.Fatalf("cassette was not redacted:\n%s", data)
+	}
+
+	server.Close()
+	rec, err = New(cassette, ModeReplayOrRecord, WithRedactedFields("token"))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if rec.Mode() != ModeReplay {
+		t.Fatalf("Mode() = %v, want ModeReplay", rec.Mode())
+	}
+	replayed := run(rec)
+	want := []string{
+		"00000000-0000-4000-8000-000000000001/REDACTED",
+		"00000000-0000-4000-8000-000000000002/REDACTED",
+		"00000000-0000-4000-8000-000000000002/",
+	}
+	if strings.Join(replayed, ",") != strings.Join(want, ",") {
+		t.Fatalf("replayed %v, want %v", replayed, want)
+	}
+
+	client, _ := inceptiondb.NewClient(server.URL, inceptiondb.WithHTTPClient(&http.Client{Transport: rec}))
+	if _, err := client.Find(ctx, "users", nil); !errors.Is(err, ErrNoInteraction) {
+		t.Fatalf("Find() after replay error = %v, want ErrNoInteraction", err)
+	}
+}
+
+func TestRecordCompressedBodies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		data, _ := io.ReadAll(zr)
+		w.Header().Set("Content-Encoding", "gzip")
+		zw := gzip.NewWriter(w)
+		zw.Write(data)
+		zw.Close()
+	}))
+	defer server.Close()
+
+	cassette := filepath.Join(t.TempDir(), "cassette.json")
+	rec, err := New(cassette, ModeRecord, WithTransport(server.Client().Transport))
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client, _ := inceptiondb.NewClient(server.URL,
+		inceptiondb.WithCompression(),
+		inceptiondb.WithHTTPClient(&http.Client{Transport: rec}),
+	)
+	payload := strings.Repeat("{\"name\":\"compressible\"}\n", 100)
+	stream, err := client.InsertStream(context.Background(), "items", strings.NewReader(payload))
+	if err != nil {
+		t.Fatalf("InsertStream() error = %v", err)
+	}
+	for stream.Next(new(json.RawMessage)) == nil {
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(cassette)
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil || len(c.Interactions) != 1 {
+		t.Fatalf("cassette = %s, %v", data, err)
+	}
+	in := c.Interactions[0]
+	if in.Request.Body != payload || in.Response.Body != payload {
+		t.Fatalf("bodies were not stored decoded: %+v", in)
+	}
+}
+
+func TestRedactNormalisesBodies(t *testing.T) {
+	rec := &Recorder{redacted: map[string]bool{"at": true}, uuids: map[string]string{}}
+	a := rec.redact([]byte(`{"b":1,"a":{"at":"now","id":"0b7c7a1e-1f2a-4c3b-9d4e-5f6a7b8c9d0e"}}`), true)
+	b := rec.redact([]byte("{ \"a\": {\"id\": \"1c8d8b2f-2a3b-4d4c-8e5f-6a7b8c9d0e1f\", \"at\": \"later\"}, \"b\": 1 }"), true)
+	if a != b {
+		t.Fatalf("redact() keys differ:\n%s\n%s", a, b)
+	}
+	if got := rec.redact([]byte("not json"), true); got != "not json" {
+		t.Fatalf("redact(non JSON) = %q", got)
+	}
+}
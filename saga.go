@@ -0,0 +1,523 @@
+package inceptiondb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// DefaultSagaKey is the document field used to identify the documents touched
+// by a saga when no key is configured.
+const DefaultSagaKey = "id"
+
+// ErrSagaFinished is returned when a step, commit or rollback is attempted on a
+// saga that has already been committed or rolled back.
+var ErrSagaFinished = errors.New("inceptiondb: saga already finished")
+
+const (
+	sagaOpInsert = "insert"
+	sagaOpPatch  = "patch"
+	sagaOpRemove = "remove"
+
+	sagaRecordStep        = "step"
+	sagaRecordCompensated = "compensated"
+	sagaRecordCommitted   = "committed"
+	sagaRecordRolledBack  = "rolledback"
+)
+
+// Saga groups several write operations so they can be undone together. Every
+// step records the before-images of the documents it touched in a journal
+// file; Rollback applies compensating operations in reverse order.
+//
+// Documents are identified by a key field (see WithSagaKey) which must be
+// present and unique in every document touched by the saga. A step that is
+// interrupted while the request is in flight is not journaled and therefore
+// cannot be compensated.
+type Saga struct {
+	client *Client
+	path   string
+	key    string
+
+	mu       sync.Mutex
+	file     *os.File
+	steps    []*sagaStep
+	finished bool
+}
+
+// SagaOption configures a Saga instance.
+type SagaOption func(*Saga)
+
+// WithSagaKey overrides the field used to identify documents, "id" by default.
+func WithSagaKey(field string) SagaOption {
+	return func(s *Saga) {
+		s.key = field
+	}
+}
+
+type sagaStep struct {
+	Type        string            `json:"type"`
+	Step        int               `json:"step,omitempty"`
+	Op          string            `json:"op,omitempty"`
+	Collection  string            `json:"collection,omitempty"`
+	Key         string            `json:"key,omitempty"`
+	Before      []json.RawMessage `json:"before,omitempty"`
+	After       []json.RawMessage `json:"after,omitempty"`
+	compensated bool
+}
+
+// NewSaga opens the journal stored at path and returns a saga bound to the
+// client. If the journal belongs to a saga that was interrupted before being
+// committed or rolled back, its steps are restored so the caller can either
+// continue it, Commit it or Rollback it. A finished journal is truncated and a
+// new saga is started.
+func (c *Client) NewSaga(path string, opts ...SagaOption) (*Saga, error) {
+	if path == "" {
+		return nil, errors.New("saga journal path is required")
+	}
+	s := &Saga{
+		client: c,
+		path:   path,
+		key:    DefaultSagaKey,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(s)
+		}
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("open saga journal: %w", err)
+	}
+	steps, finished, end, err := readSagaJournal(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("read saga journal: %w", err)
+	}
+	if finished {
+		steps, end = nil, 0
+	}
+	if err := resumeJournal(f, end); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("truncate saga journal: %w", err)
+	}
+	s.file = f
+	s.steps = steps
+	return s, nil
+}
+
+// Pending reports whether the saga has journaled steps that were neither
+// committed nor rolled back.
+func (s *Saga) Pending() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.finished && len(s.steps) > 0
+}
+
+// InsertDocuments inserts the documents and journals the inserted rows so they
+// can be removed on rollback.
+func (s *Saga) InsertDocuments(ctx context.Context, collection string, documents ...any) ([]json.RawMessage, error) {
+	return s.run(ctx, sagaOpInsert, collection, func() ([]json.RawMessage, []json.RawMessage, error) {
+		stream, err := s.client.InsertDocuments(ctx, collection, documents...)
+		if err != nil {
+			return nil, nil, err
+		}
+		after, err := collectRaw(stream)
+		return nil, after, err
+	})
+}
+
+// Patch reads the documents matched by the request, patches them and journals
+// both images. On rollback the before-image is written back. Since the server
+// merges patches shallowly and cannot delete fields, documents the patch added
+// fields to are removed and inserted again instead.
+func (s *Saga) Patch(ctx context.Context, collection string, req *PatchRequest) ([]json.RawMessage, error) {
+	if req == nil {
+		return nil, errors.New("patch request is nil")
+	}
+	return s.run(ctx, sagaOpPatch, collection, func() ([]json.RawMessage, []json.RawMessage, error) {
+		stream, err := s.client.Find(ctx, collection, &FindRequest{QueryOptions: req.QueryOptions})
+		if err != nil {
+			return nil, nil, err
+		}
+		before, err := collectRaw(stream)
+		if err != nil {
+			return nil, nil, err
+		}
+		stream, err = s.client.Patch(ctx, collection, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		after, err := collectRaw(stream)
+		return before, after, err
+	})
+}
+
+// Remove deletes the documents matched by the request and journals the
+// removed rows so they can be inserted again on rollback.
+func (s *Saga) Remove(ctx context.Context, collection string, req *RemoveRequest) ([]json.RawMessage, error) {
+	return s.run(ctx, sagaOpRemove, collection, func() ([]json.RawMessage, []json.RawMessage, error) {
+		stream, err := s.client.Remove(ctx, collection, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		before, err := collectRaw(stream)
+		return before, nil, err
+	})
+}
+
+// Commit marks the saga as successful. The journal is kept until the next saga
+// is started on the same path.
+func (s *Saga) Commit() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return ErrSagaFinished
+	}
+	if err := s.append(&sagaStep{Type: sagaRecordCommitted}); err != nil {
+		return err
+	}
+	s.finished = true
+	return s.file.Close()
+}
+
+// Rollback applies the compensating operations of every journaled step in
+// reverse order. Each compensation is journaled, so an interrupted rollback
+// can be resumed by opening the journal again and calling Rollback. The step
+// being compensated when it was interrupted runs again; compensations only
+// insert documents that are missing, so this does not duplicate them.
+func (s *Saga) Rollback(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return ErrSagaFinished
+	}
+	for i := len(s.steps) - 1; i >= 0; i-- {
+		step := s.steps[i]
+		if step.compensated {
+			continue
+		}
+		if err := s.compensate(ctx, step); err != nil {
+			return fmt.Errorf("compensate step %d (%s %s): %w", step.Step, step.Op, step.Collection, err)
+		}
+		if err := s.append(&sagaStep{Type: sagaRecordCompensated, Step: step.Step}); err != nil {
+			return err
+		}
+		step.compensated = true
+	}
+	if err := s.append(&sagaStep{Type: sagaRecordRolledBack}); err != nil {
+		return err
+	}
+	s.finished = true
+	return s.file.Close()
+}
+
+func (s *Saga) run(ctx context.Context, op, collection string, fn func() ([]json.RawMessage, []json.RawMessage, error)) ([]json.RawMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return nil, ErrSagaFinished
+	}
+
+	before, after, err := fn()
+	if len(before) == 0 && len(after) == 0 {
+		return nil, err
+	}
+
+	// Journal whatever was applied, even on a partial failure, so it can be
+	// compensated later.
+	step := &sagaStep{
+		Type:       sagaRecordStep,
+		Step:       len(s.steps) + 1,
+		Op:         op,
+		Collection: collection,
+		Key:        s.key,
+		Before:     before,
+		After:      after,
+	}
+	if jerr := s.append(step); jerr != nil {
+		return nil, errors.Join(err, jerr)
+	}
+	s.steps = append(s.steps, step)
+
+	if op == sagaOpRemove {
+		return before, err
+	}
+	return after, err
+}
+
+func (s *Saga) compensate(ctx context.Context, step *sagaStep) error {
+	switch step.Op {
+	case sagaOpInsert:
+		for _, doc := range step.After {
+			value, err := sagaKeyValue(doc, step.Key)
+			if err != nil {
+				return err
+			}
+			stream, err := s.client.Remove(ctx, step.Collection, &RemoveRequest{QueryOptions: QueryOptions{
+				Filter: map[string]any{step.Key: value},
+				Limit:  1,
+			}})
+			if err != nil {
+				return err
+			}
+			if _, err := collectRaw(stream); err != nil {
+				return err
+			}
+		}
+		return nil
+	case sagaOpPatch:
+		for i, doc := range step.Before {
+			before, err := decodeRawObject(doc)
+			if err != nil {
+				return err
+			}
+			after, err := step.afterImage(i, before)
+			if err != nil {
+				return err
+			}
+			// The patch may have changed the key, so the document is found
+			// by its current value.
+			filter := QueryOptions{Filter: map[string]any{step.Key: before[step.Key]}, Limit: 1}
+			if value, ok := after[step.Key]; ok {
+				filter.Filter[step.Key] = value
+			}
+			added := false
+			for k := range after {
+				if _, ok := before[k]; !ok {
+					added = true
+				}
+			}
+			if added {
+				stream, err := s.client.Remove(ctx, step.Collection, &RemoveRequest{QueryOptions: filter})
+				if err != nil {
+					return err
+				}
+				if _, err := collectRaw(stream); err != nil {
+					return err
+				}
+				if err := s.insertMissing(ctx, step.Collection, step.Key, doc); err != nil {
+					return err
+				}
+				continue
+			}
+			restore := make(map[string]any, len(before))
+			for k, v := range before {
+				restore[k] = v
+			}
+			stream, err := s.client.Patch(ctx, step.Collection, &PatchRequest{QueryOptions: filter, Patch: restore})
+			if err != nil {
+				return err
+			}
+			if _, err := collectRaw(stream); err != nil {
+				return err
+			}
+		}
+		return nil
+	case sagaOpRemove:
+		return s.insertMissing(ctx, step.Collection, step.Key, step.Before...)
+	default:
+		return fmt.Errorf("unknown saga operation %q", step.Op)
+	}
+}
+
+// afterImage returns the after-image of the document whose before-image is
+// the i-th of the step. Find and Patch see the matched documents in the same
+// order, so images are paired by position, or by key when documents matched
+// only one of them.
+func (step *sagaStep) afterImage(i int, before map[string]json.RawMessage) (map[string]json.RawMessage, error) {
+	value, ok := before[step.Key]
+	if !ok {
+		return nil, fmt.Errorf("document without %q field", step.Key)
+	}
+	if len(step.After) == len(step.Before) {
+		return decodeRawObject(step.After[i])
+	}
+	for _, doc := range step.After {
+		after, err := decodeRawObject(doc)
+		if err != nil {
+			return nil, err
+		}
+		if bytes.Equal(after[step.Key], value) {
+			return after, nil
+		}
+	}
+	return nil, nil
+}
+
+// insertMissing inserts the documents that are not in the collection, going
+// by their key, so that a compensation can run again without duplicating
+// them.
+func (s *Saga) insertMissing(ctx context.Context, collection, key string, docs ...json.RawMessage) error {
+	var missing []any
+	for _, doc := range docs {
+		value, err := sagaKeyValue(doc, key)
+		if err != nil {
+			return err
+		}
+		stream, err := s.client.Find(ctx, collection, &FindRequest{QueryOptions: QueryOptions{
+			Filter: map[string]any{key: value},
+			Limit:  1,
+		}})
+		if err != nil {
+			return err
+		}
+		found, err := collectRaw(stream)
+		if err != nil {
+			return err
+		}
+		if len(found) == 0 {
+			missing = append(missing, doc)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	stream, err := s.client.InsertDocuments(ctx, collection, missing...)
+	if err != nil {
+		return err
+	}
+	_, err = collectRaw(stream)
+	return err
+}
+
+func (s *Saga) append(record *sagaStep) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("encode saga journal: %w", err)
+	}
+	data = append(data, '\n')
+	if _, err := s.file.Write(data); err != nil {
+		return fmt.Errorf("write saga journal: %w", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("sync saga journal: %w", err)
+	}
+	return nil
+}
+
+// readSagaJournal returns the journaled steps, whether the saga finished and
+// the offset just past the last complete record.
+func readSagaJournal(r io.Reader) ([]*sagaStep, bool, int64, error) {
+	var steps []*sagaStep
+	byNumber := map[int]*sagaStep{}
+	finished := false
+	end := int64(0)
+
+	journal := newJournalScanner(r)
+	for journal.Scan() {
+		line := bytes.TrimSpace(journal.Bytes())
+		if len(line) == 0 {
+			end = journal.offset
+			continue
+		}
+		record := &sagaStep{}
+		if err := json.Unmarshal(line, record); err != nil {
+			// A torn write at the end of the journal is the record being
+			// appended when the process died; ignore it.
+			break
+		}
+		end = journal.offset
+		switch record.Type {
+		case sagaRecordStep:
+			steps = append(steps, record)
+			byNumber[record.Step] = record
+		case sagaRecordCompensated:
+			if step, ok := byNumber[record.Step]; ok {
+				step.compensated = true
+			}
+		case sagaRecordCommitted, sagaRecordRolledBack:
+			finished = true
+		}
+	}
+	if err := journal.Err(); err != nil {
+		return nil, false, 0, err
+	}
+	return steps, finished, end, nil
+}
+
+// journalScanner reads the lines of a journal file and tracks the offset
+// just past the line last returned by Scan.
+type journalScanner struct {
+	*bufio.Scanner
+	offset int64
+}
+
+func newJournalScanner(r io.Reader) *journalScanner {
+	j := &journalScanner{Scanner: bufio.NewScanner(r)}
+	j.Buffer(make([]byte, 64*1024), maxJournalLine)
+	j.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := bufio.ScanLines(data, atEOF)
+		j.offset += int64(advance)
+		return advance, token, err
+	})
+	return j
+}
+
+// resumeJournal drops what follows the last complete record at end, such as
+// a record torn by a crash, and positions f to append after it. A record
+// that lost only its newline is kept and terminated, so the next record
+// starts on a line of its own.
+func resumeJournal(f *os.File, end int64) error {
+	if err := f.Truncate(end); err != nil {
+		return err
+	}
+	if _, err := f.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	if end == 0 {
+		return nil
+	}
+	last := make([]byte, 1)
+	if _, err := f.ReadAt(last, end-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		_, err := f.Write(newline)
+		return err
+	}
+	return nil
+}
+
+const maxJournalLine = 64 << 20
+
+func collectRaw(stream *JSONStream) ([]json.RawMessage, error) {
+	defer stream.Close()
+	var items []json.RawMessage
+	for {
+		var item json.RawMessage
+		if err := stream.Next(&item); err != nil {
+			if errors.Is(err, io.EOF) {
+				return items, nil
+			}
+			return items, err
+		}
+		items = append(items, item)
+	}
+}
+
+func decodeRawObject(doc json.RawMessage) (map[string]json.RawMessage, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(doc, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+func sagaKeyValue(doc json.RawMessage, key string) (json.RawMessage, error) {
+	fields, err := decodeRawObject(doc)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := fields[key]
+	if !ok {
+		return nil, fmt.Errorf("document without %q field", key)
+	}
+	return value, nil
+}
@@ -0,0 +1,291 @@
+package inceptiondb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// memoryServer is a minimal in-memory implementation of the document
+// endpoints, good enough to exercise multi-step client helpers.
+type memoryServer struct {
+	mu          sync.Mutex
+	collections map[string][]map[string]any
+	failOn      string
+	requests    int
+	url         string
+}
+
+func newMemoryServer(t *testing.T) (*memoryServer, *Client) {
+	t.Helper()
+	m := &memoryServer{collections: map[string][]map[string]any{}}
+	srv := httptest.NewServer(m)
+	t.Cleanup(srv.Close)
+	m.url = srv.URL
+	c, err := NewClient(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, c
+}
+
+func (m *memoryServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requests++
+
+	name, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/collections/"), ":")
+	if m.failOn != "" && m.failOn == name+":"+action {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"error":{"message":"injected failure"}}`))
+		return
+	}
+
+	enc := json.NewEncoder(w)
+	switch action {
+	case "insert":
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			doc := map[string]any{}
+			if err := json.Unmarshal(scanner.Bytes(), &doc); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			m.collections[name] = append(m.collections[name], doc)
+			enc.Encode(doc)
+		}
+	case "find", "patch", "remove":
+		req := struct {
+			QueryOptions
+			Patch map[string]any `json:"patch"`
+		}{}
+		json.NewDecoder(r.Body).Decode(&req)
+		var kept []map[string]any
+		matched := int64(0)
+		for _, doc := range m.collections[name] {
+			if !memoryMatch(doc, req.Filter) || (req.Value != "" && fmt.Sprint(doc[req.Index]) != req.Value) ||
+				(req.Limit > 0 && matched >= req.Limit) {
+				kept = append(kept, doc)
+				continue
+			}
+			matched++
+			switch action {
+			case "patch":
+				for k, v := range req.Patch {
+					doc[k] = v
+				}
+			case "remove":
+				enc.Encode(doc)
+				continue
+			}
+			kept = append(kept, doc)
+			enc.Encode(doc)
+		}
+		m.collections[name] = kept
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (m *memoryServer) documents(collection string) []map[string]any {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]map[string]any(nil), m.collections[collection]...)
+}
+
+func memoryMatch(doc, filter map[string]any) bool {
+	for k, v := range filter {
+		if !reflect.DeepEqual(doc[k], v) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSagaRollback(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["inventory"] = []map[string]any{{"id": "sku-1", "stock": float64(3)}}
+	server.collections["cart"] = []map[string]any{{"id": "line-1", "sku": "sku-1"}}
+
+	saga, err := client.NewSaga(filepath.Join(t.TempDir(), "saga.journal"))
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if _, err := saga.InsertDocuments(ctx, "orders", map[string]any{"id": "order-1"}); err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	if _, err := saga.Patch(ctx, "inventory", &PatchRequest{
+		QueryOptions: QueryOptions{Filter: map[string]any{"id": "sku-1"}},
+		Patch:        map[string]any{"stock": 2, "reserved": true},
+	}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+
+	server.failOn = "cart:remove"
+	if _, err := saga.Remove(ctx, "cart", &RemoveRequest{}); err == nil {
+		t.Fatal("Remove() expected error")
+	}
+	server.failOn = ""
+
+	if err := saga.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+
+	if got := server.documents("orders"); len(got) != 0 {
+		t.Fatalf("orders = %v, want empty", got)
+	}
+	want := []map[string]any{{"id": "sku-1", "stock": float64(3)}}
+	if got := server.documents("inventory"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("inventory = %v, want %v", got, want)
+	}
+	if err := saga.Commit(); !errors.Is(err, ErrSagaFinished) {
+		t.Fatalf("Commit() error = %v, want ErrSagaFinished", err)
+	}
+}
+
+func TestSagaRollbackPatchedKey(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["inventory"] = []map[string]any{{"id": "sku-1", "stock": float64(3)}}
+
+	saga, err := client.NewSaga(filepath.Join(t.TempDir(), "saga.journal"))
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if _, err := saga.Patch(ctx, "inventory", &PatchRequest{
+		QueryOptions: QueryOptions{Filter: map[string]any{"id": "sku-1"}},
+		Patch:        map[string]any{"id": "sku-2", "stock": 1},
+	}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	if err := saga.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	want := []map[string]any{{"id": "sku-1", "stock": float64(3)}}
+	if got := server.documents("inventory"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("inventory = %v, want %v", got, want)
+	}
+}
+
+func TestSagaRollbackIsIdempotent(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["cart"] = []map[string]any{{"id": "line-1"}}
+	server.collections["inventory"] = []map[string]any{{"id": "sku-1", "stock": float64(3)}}
+
+	saga, err := client.NewSaga(filepath.Join(t.TempDir(), "saga.journal"))
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if _, err := saga.Remove(ctx, "cart", &RemoveRequest{}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := saga.Patch(ctx, "inventory", &PatchRequest{Patch: map[string]any{"reserved": true}}); err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	// A rollback interrupted after compensating the steps, before journaling
+	// it, compensates them again.
+	for _, step := range saga.steps {
+		if err := saga.compensate(ctx, step); err != nil {
+			t.Fatalf("compensate() error = %v", err)
+		}
+	}
+	if err := saga.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got, want := server.documents("cart"), []map[string]any{{"id": "line-1"}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("cart = %v, want %v", got, want)
+	}
+	if got, want := server.documents("inventory"), []map[string]any{{"id": "sku-1", "stock": float64(3)}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("inventory = %v, want %v", got, want)
+	}
+}
+
+func TestSagaRecoverFromJournal(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["cart"] = []map[string]any{{"id": "line-1"}}
+	journal := filepath.Join(t.TempDir(), "saga.journal")
+
+	saga, err := client.NewSaga(journal)
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if _, err := saga.Remove(ctx, "cart", &RemoveRequest{}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	saga.file.Close() // simulate a crash before Commit or Rollback
+
+	recovered, err := client.NewSaga(journal)
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if !recovered.Pending() {
+		t.Fatal("Pending() = false, want true")
+	}
+	if err := recovered.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := server.documents("cart"); len(got) != 1 {
+		t.Fatalf("cart = %v, want restored document", got)
+	}
+
+	next, err := client.NewSaga(journal)
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if next.Pending() {
+		t.Fatal("Pending() = true after finished saga, want false")
+	}
+}
+
+func TestSagaJournalTornRecord(t *testing.T) {
+	ctx := context.Background()
+	server, client := newMemoryServer(t)
+	server.collections["cart"] = []map[string]any{{"id": "line-1"}}
+	journal := filepath.Join(t.TempDir(), "saga.journal")
+
+	saga, err := client.NewSaga(journal)
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if _, err := saga.InsertDocuments(ctx, "cart", map[string]any{"id": "line-2"}); err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	// Simulate a crash in the middle of appending a record.
+	saga.file.WriteString(`{"type":"st`)
+	saga.file.Close()
+
+	resumed, err := client.NewSaga(journal)
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if _, err := resumed.Remove(ctx, "cart", &RemoveRequest{}); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	resumed.file.Close()
+
+	recovered, err := client.NewSaga(journal)
+	if err != nil {
+		t.Fatalf("NewSaga() error = %v", err)
+	}
+	if got := len(recovered.steps); got != 2 {
+		t.Fatalf("recovered %d steps, want 2", got)
+	}
+	if err := recovered.Rollback(ctx); err != nil {
+		t.Fatalf("Rollback() error = %v", err)
+	}
+	if got := server.documents("cart"); len(got) != 1 || got[0]["id"] != "line-1" {
+		t.Fatalf("cart = %v, want only line-1", got)
+	}
+}
@@ -0,0 +1,46 @@
+package inceptiondb
+
+import (
+	"fmt"
+
+	"inceptiondb/schema"
+)
+
+// WithSchema validates the documents sent to collection against s before they
+// are encoded: every document given to InsertDocuments, and the patch of
+// Patch requests with s.ValidatePartial, so required fields may be left out
+// of a patch but every field it sets must be valid as a whole. Invalid requests are not sent and fail
+// with an error wrapping a *schema.ValidationError. InsertStream bodies are
+// sent as they are.
+func WithSchema(collection string, s *schema.Schema) Option {
+	return func(c *Client) {
+		if c.schemas == nil {
+			c.schemas = map[string]*schema.Schema{}
+		}
+		c.schemas[collection] = s
+	}
+}
+
+func (c *Client) validateDocuments(collection string, documents []any) error {
+	s, ok := c.schemas[collection]
+	if !ok {
+		return nil
+	}
+	for i, doc := range documents {
+		if err := s.Validate(doc); err != nil {
+			return fmt.Errorf("document %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+func (c *Client) validatePatch(collection string, patch any) error {
+	s, ok := c.schemas[collection]
+	if !ok {
+		return nil
+	}
+	if err := s.ValidatePartial(patch); err != nil {
+		return fmt.Errorf("patch: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,472 @@
+// Package schema validates documents against a subset of JSON Schema, so bad
+// documents can be rejected before they reach the server.
+//
+//	s, err := schema.Parse([]byte(`{
+//		"type": "object",
+//		"required": ["id", "email"],
+//		"properties": {
+//			"id": {"type": "string"},
+//			"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+//			"age": {"type": "integer", "minimum": 0},
+//			"tags": {"type": "array", "items": {"enum": ["admin", "beta"]}}
+//		}
+//	}`))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	if err := s.Validate(doc); err != nil {
+//		var verr *schema.ValidationError
+//		errors.As(err, &verr) // verr.Errors lists every failure with its path
+//	}
+//
+// The supported keywords are type, properties, required,
+// additionalProperties (as a boolean or a schema), items, enum, const,
+// pattern, minimum, maximum, exclusiveMinimum, exclusiveMaximum, minLength,
+// maxLength, minItems and maxItems. Annotations such as title, description or
+// $schema are accepted and ignored; any other keyword is rejected by Parse
+// rather than silently not enforced. Patterns use RE2 syntax and, as in JSON
+// Schema, match anywhere in the string unless anchored.
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Schema is a parsed schema. It is safe for concurrent use.
+type Schema struct {
+	Type                 Types              `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Additional        `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Const                any                `json:"const,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+
+	hasConst bool
+	pattern  *regexp.Regexp
+}
+
+// Types is the type keyword, a single type name or a list of them: "null",
+// "boolean", "object", "array", "number", "integer" or "string".
+type Types []string
+
+// UnmarshalJSON accepts a type name or an array of them.
+func (t *Types) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = Types{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return errors.New("type must be a string or an array of strings")
+	}
+	*t = names
+	return nil
+}
+
+// MarshalJSON writes a single type as a string.
+func (t Types) MarshalJSON() ([]byte, error) {
+	if len(t) == 1 {
+		return json.Marshal(t[0])
+	}
+	return json.Marshal([]string(t))
+}
+
+// Additional is the additionalProperties keyword: either a boolean, where
+// false rejects properties not listed in Properties, or a schema the extra
+// properties must match.
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+// UnmarshalJSON accepts a boolean or a schema.
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// MarshalJSON writes the boolean or the schema.
+func (a Additional) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+	return json.Marshal(a.Allowed)
+}
+
+var knownTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+var keywords = map[string]bool{
+	"type": true, "properties": true, "required": true, "additionalProperties": true,
+	"items": true, "enum": true, "const": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+	"minLength": true, "maxLength": true, "minItems": true, "maxItems": true,
+}
+
+var annotations = map[string]bool{
+	"$schema": true, "$id": true, "$comment": true, "title": true,
+	"description": true, "default": true, "examples": true,
+}
+
+// UnmarshalJSON parses a schema object, rejecting unsupported keywords.
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return errors.New("schema must be an object")
+	}
+	for name := range fields {
+		if !keywords[name] && !annotations[name] {
+			return fmt.Errorf("unsupported keyword %q", name)
+		}
+	}
+	type plain Schema
+	var p plain
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&p); err != nil {
+		return err
+	}
+	*s = Schema(p)
+	_, s.hasConst = fields["const"]
+	for _, name := range s.Type {
+		if !knownTypes[name] {
+			return fmt.Errorf("unknown type %q", name)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("pattern: %w", err)
+		}
+		s.pattern = re
+	}
+	return nil
+}
+
+// Parse parses a JSON schema.
+func Parse(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parse schema: %w", err)
+	}
+	return &s, nil
+}
+
+// Load parses the JSON schema stored in the file at path.
+func Load(path string) (*Schema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+// FieldError is a validation failure.
+type FieldError struct {
+	// Path locates the failing value, "$" being the document itself, e.g.
+	// "$.customer.email" or "$.items[2].sku".
+	Path    string
+	Message string
+}
+
+func (e FieldError) String() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError lists every failure found in a document.
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Errors))
+	for i, fe := range e.Errors {
+		parts[i] = fe.String()
+	}
+	if len(parts) == 1 {
+		return "schema: " + parts[0]
+	}
+	return fmt.Sprintf("schema: %d errors: %s", len(parts), strings.Join(parts, "; "))
+}
+
+// Validate checks doc against the schema and returns a *ValidationError
+// listing every failure. doc may be a decoded JSON value, raw JSON in a
+// json.RawMessage or []byte, or any value encoding/json can marshal, in which
+// case it is checked as it would be encoded.
+func (s *Schema) Validate(doc any) error {
+	return s.validate(doc, false)
+}
+
+// ValidatePartial checks a patch for the patch endpoint, which replaces the
+// top-level fields it names: required properties may be missing from the
+// patch, but every field it sets is checked as a whole value, as by Validate.
+// Nested objects replace the stored ones entirely, so their required
+// properties must be present, and null is stored rather than removing the
+// field, so it must be allowed by the field's type.
+func (s *Schema) ValidatePartial(patch any) error {
+	return s.validate(patch, true)
+}
+
+func (s *Schema) validate(doc any, partial bool) error {
+	v, err := normalize(doc)
+	if err != nil {
+		return err
+	}
+	var errs []FieldError
+	s.check(v, "$", partial, &errs)
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// normalize turns doc into the values encoding/json decodes into an any, with
+// numbers as json.Number.
+func normalize(doc any) (any, error) {
+	var data []byte
+	switch d := doc.(type) {
+	case json.RawMessage:
+		data = d
+	case []byte:
+		data = d
+	default:
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("encode document: %w", err)
+		}
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("decode document: %w", err)
+	}
+	return v, nil
+}
+
+func (s *Schema) check(v any, path string, partial bool, errs *[]FieldError) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if len(s.Type) > 0 && !s.Type.match(v) {
+		fail("must be %s, got %s", strings.Join(s.Type, " or "), typeOf(v))
+		return
+	}
+	if s.hasConst && !equal(v, s.Const) {
+		fail("must be %s", encode(s.Const))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, e := range s.Enum {
+			if equal(v, e) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			allowed := make([]string, len(s.Enum))
+			for i, e := range s.Enum {
+				allowed[i] = encode(e)
+			}
+			fail("must be one of %s", strings.Join(allowed, ", "))
+		}
+	}
+
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		if s.Minimum != nil && f < *s.Minimum {
+			fail("must be >= %s", formatNumber(*s.Minimum))
+		}
+		if s.Maximum != nil && f > *s.Maximum {
+			fail("must be <= %s", formatNumber(*s.Maximum))
+		}
+		if s.ExclusiveMinimum != nil && f <= *s.ExclusiveMinimum {
+			fail("must be > %s", formatNumber(*s.ExclusiveMinimum))
+		}
+		if s.ExclusiveMaximum != nil && f >= *s.ExclusiveMaximum {
+			fail("must be < %s", formatNumber(*s.ExclusiveMaximum))
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			fail("must be at least %d characters long", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			fail("must be at most %d characters long", *s.MaxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("must match %q", s.Pattern)
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				// Array items are always whole values, even in a patch.
+				s.Items.check(item, fmt.Sprintf("%s[%d]", path, i), false, errs)
+			}
+		}
+	case map[string]any:
+		s.checkObject(v, path, partial, errs)
+	}
+}
+
+// checkObject checks the properties of obj. When partial, obj is a patch:
+// required properties may be missing, and the values it sets are whole
+// values.
+func (s *Schema) checkObject(obj map[string]any, path string, partial bool, errs *[]FieldError) {
+	if !partial {
+		for _, name := range s.Required {
+			if _, ok := obj[name]; !ok {
+				*errs = append(*errs, FieldError{Path: path + "." + name, Message: "is required"})
+			}
+		}
+	}
+
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value := obj[name]
+		fieldPath := path + "." + name
+		if prop, ok := s.Properties[name]; ok {
+			prop.check(value, fieldPath, false, errs)
+			continue
+		}
+		if s.AdditionalProperties == nil {
+			continue
+		}
+		if !s.AdditionalProperties.Allowed {
+			*errs = append(*errs, FieldError{Path: fieldPath, Message: "is not allowed"})
+			continue
+		}
+		if s.AdditionalProperties.Schema != nil {
+			s.AdditionalProperties.Schema.check(value, fieldPath, false, errs)
+		}
+	}
+}
+
+func (t Types) match(v any) bool {
+	actual := typeOf(v)
+	for _, name := range t {
+		if name == actual || (name == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	case json.Number:
+		if _, err := v.Int64(); err == nil {
+			return "integer"
+		}
+		if f, err := v.Float64(); err == nil && f == math.Trunc(f) && !math.IsInf(f, 0) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+// equal compares decoded JSON values, numbers by value.
+func equal(a, b any) bool {
+	na, aok := a.(json.Number)
+	nb, bok := b.(json.Number)
+	if aok || bok {
+		if !aok || !bok {
+			return false
+		}
+		fa, err1 := na.Float64()
+		fb, err2 := nb.Float64()
+		return err1 == nil && err2 == nil && fa == fb
+	}
+	switch a := a.(type) {
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func encode(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+func formatNumber(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
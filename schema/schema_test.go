@@ -0,0 +1,160 @@
+package schema
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const userSchema = `{
+	"$schema": "https://json-schema.org/draft/2020-12/schema",
+	"title": "user",
+	"type": "object",
+	"required": ["id", "email"],
+	"additionalProperties": false,
+	"properties": {
+		"id": {"type": "string", "minLength": 1},
+		"email": {"type": "string", "pattern": "^[^@]+@[^@]+$"},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"score": {"type": ["number", "null"], "exclusiveMaximum": 1},
+		"role": {"enum": ["admin", "member"]},
+		"address": {
+			"type": "object",
+			"required": ["country"],
+			"properties": {"country": {"type": "string", "maxLength": 2}}
+		},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+	}
+}`
+
+func mustParse(t *testing.T, data string) *Schema {
+	t.Helper()
+	s, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	return s
+}
+
+func fieldErrors(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("error = %v, want a *ValidationError", err)
+	}
+	var out []string
+	for _, fe := range verr.Errors {
+		out = append(out, fe.String())
+	}
+	return out
+}
+
+func TestValidate(t *testing.T) {
+	s := mustParse(t, userSchema)
+
+	valid := map[string]any{
+		"id":      "u1",
+		"email":   "ana@example.com",
+		"age":     30,
+		"score":   nil,
+		"role":    "admin",
+		"address": map[string]any{"country": "es"},
+		"tags":    []string{"a", "b"},
+	}
+	if err := s.Validate(valid); err != nil {
+		t.Fatalf("Validate(valid) error = %v", err)
+	}
+
+	invalid := `{
+		"email": "nope",
+		"age": 30.5,
+		"score": 1,
+		"role": "root",
+		"address": {"country": "spain"},
+		"tags": ["a", 2, "c"],
+		"extra": true
+	}`
+	got := fieldErrors(t, s.Validate(json.RawMessage(invalid)))
+	want := []string{
+		"$.id: is required",
+		"$.address.country: must be at most 2 characters long",
+		"$.age: must be integer, got number",
+		"$.email: must match \"^[^@]+@[^@]+$\"",
+		"$.extra: is not allowed",
+		"$.role: must be one of \"admin\", \"member\"",
+		"$.score: must be < 1",
+		"$.tags: must have at most 2 items",
+		"$.tags[1]: must be string, got integer",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Validate(invalid) errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestValidateStruct(t *testing.T) {
+	s := mustParse(t, userSchema)
+	type user struct {
+		ID    string `json:"id"`
+		Email string `json:"email"`
+		Age   int    `json:"age"`
+	}
+	if err := s.Validate(user{ID: "u1", Email: "a@b", Age: 3}); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	got := fieldErrors(t, s.Validate(user{ID: "u1", Email: "a@b", Age: -1}))
+	if want := []string{"$.age: must be >= 0"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Validate() errors = %v, want %v", got, want)
+	}
+}
+
+func TestValidatePartial(t *testing.T) {
+	s := mustParse(t, userSchema)
+	if err := s.ValidatePartial(map[string]any{"age": 31, "score": nil}); err != nil {
+		t.Fatalf("ValidatePartial() error = %v", err)
+	}
+	// The patch endpoint replaces top-level fields, so nested objects are
+	// whole values and nulls are stored.
+	got := fieldErrors(t, s.ValidatePartial(map[string]any{
+		"email":   nil,
+		"age":     nil,
+		"address": map[string]any{"city": "Paris"},
+	}))
+	want := []string{
+		"$.address.country: is required",
+		"$.age: must be integer, got null",
+		"$.email: must be string, got null",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ValidatePartial() errors = %v, want %v", got, want)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	for _, data := range []string{
+		`[]`,
+		`{"type": "text"}`,
+		`{"format": "email"}`,
+		`{"properties": {"a": {"pattern": "("}}}`,
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) succeeded", data)
+		}
+	}
+}
+
+func TestAdditionalPropertiesSchema(t *testing.T) {
+	s := mustParse(t, `{"type": "object", "additionalProperties": {"type": "number"}}`)
+	got := fieldErrors(t, s.Validate(map[string]any{"a": 1, "b": "x"}))
+	if want := []string{"$.b: must be number, got string"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Validate() errors = %v, want %v", got, want)
+	}
+	data, err := json.Marshal(s)
+	if err != nil || !strings.Contains(string(data), `"additionalProperties":{"type":"number"}`) {
+		t.Fatalf("Marshal() = %s, %v", data, err)
+	}
+}
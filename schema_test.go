@@ -0,0 +1,65 @@
+package inceptiondb
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"inceptiondb/schema"
+)
+
+func TestWithSchema(t *testing.T) {
+	ctx := context.Background()
+	s, err := schema.Parse([]byte(`{
+		"type": "object",
+		"required": ["id", "name"],
+		"properties": {"id": {"type": "string"}, "name": {"type": "string", "minLength": 1}}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &memoryServer{collections: map[string][]map[string]any{}}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+	client, err := NewClient(srv.URL, WithSchema("users", s))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.InsertDocuments(ctx, "users", map[string]any{"id": "1", "name": "Ana"}, map[string]any{"id": "2"})
+	var verr *schema.ValidationError
+	if !errors.As(err, &verr) || verr.Errors[0].Path != "$.name" {
+		t.Fatalf("InsertDocuments() error = %v, want a validation error on $.name", err)
+	}
+	if err.Error() != "document 1: schema: $.name: is required" {
+		t.Fatalf("InsertDocuments() error = %q", err)
+	}
+
+	stream, err := client.InsertDocuments(ctx, "users", map[string]any{"id": "1", "name": "Ana"})
+	if err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	stream.Close()
+
+	_, err = client.Patch(ctx, "users", &PatchRequest{Patch: map[string]any{"name": ""}})
+	if !errors.As(err, &verr) {
+		t.Fatalf("Patch() error = %v, want a validation error", err)
+	}
+	stream, err = client.Patch(ctx, "users", &PatchRequest{Patch: map[string]any{"name": "Ada"}})
+	if err != nil {
+		t.Fatalf("Patch() error = %v", err)
+	}
+	stream.Close()
+
+	// Other collections are not validated.
+	stream, err = client.InsertDocuments(ctx, "orders", map[string]any{"total": 1})
+	if err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	stream.Close()
+
+	if server.requests != 3 {
+		t.Fatalf("requests = %d, want 3: invalid requests must not be sent", server.requests)
+	}
+}
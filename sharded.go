@@ -0,0 +1,704 @@
+package inceptiondb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// shardReplicas is the number of points each shard owns on the hash ring.
+const shardReplicas = 128
+
+// Shard is a named server taking part in a ShardedClient. Names place the shard
+// on the hash ring, so they must stay stable across restarts.
+type Shard struct {
+	Name   string
+	Client *Client
+}
+
+// ShardedClient spreads collections across several servers. It offers the
+// same methods as Client:
+//
+//   - InsertDocuments and InsertStream route each document to a shard by
+//     consistent hashing of the shard key, which every document must carry.
+//   - Find, Patch and Remove go to a single shard when the filter pins the
+//     shard key to a value and fan out to all shards otherwise.
+//   - Collection and index management is applied to every shard.
+//
+// Fanned-out Find results are merged honoring Skip and Limit. When the query
+// uses a btree index, shards are merged following the index order (reversed
+// with Reverse); otherwise results are concatenated shard after shard.
+type ShardedClient struct {
+	key    string
+	shards []Shard
+	ring   []ringPoint
+}
+
+type ringPoint struct {
+	hash  uint64
+	shard int
+}
+
+// NewShardedClient returns a client that shards documents by the key field.
+func NewShardedClient(key string, shards ...Shard) (*ShardedClient, error) {
+	if key == "" {
+		return nil, errors.New("shard key is required")
+	}
+	if len(shards) == 0 {
+		return nil, errors.New("at least one shard is required")
+	}
+	s := &ShardedClient{key: key, shards: shards}
+	seen := map[string]bool{}
+	for i, shard := range shards {
+		if shard.Client == nil {
+			return nil, fmt.Errorf("shard %q has no client", shard.Name)
+		}
+		if seen[shard.Name] {
+			return nil, fmt.Errorf("duplicated shard name %q", shard.Name)
+		}
+		seen[shard.Name] = true
+		for r := 0; r < shardReplicas; r++ {
+			s.ring = append(s.ring, ringPoint{hash: hashString(shard.Name + "#" + strconv.Itoa(r)), shard: i})
+		}
+	}
+	sort.Slice(s.ring, func(i, j int) bool { return s.ring[i].hash < s.ring[j].hash })
+	return s, nil
+}
+
+// ShardFor returns the name of the shard owning documents whose shard key
+// holds value.
+func (s *ShardedClient) ShardFor(value any) (string, error) {
+	i, err := s.shardIndex(value)
+	if err != nil {
+		return "", err
+	}
+	return s.shards[i].Name, nil
+}
+
+// ListCollections lists the collections of every shard, adding up their
+// totals.
+func (s *ShardedClient) ListCollections(ctx context.Context) ([]Collection, error) {
+	results := make([][]Collection, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		cols, err := c.ListCollections(ctx)
+		results[i] = cols
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var merged []Collection
+	byName := map[string]int{}
+	for _, cols := range results {
+		for _, col := range cols {
+			if j, ok := byName[col.Name]; ok {
+				merged[j].Total += col.Total
+				continue
+			}
+			byName[col.Name] = len(merged)
+			merged = append(merged, col)
+		}
+	}
+	return merged, nil
+}
+
+// CreateCollection creates the collection on every shard.
+func (s *ShardedClient) CreateCollection(ctx context.Context, req *CreateCollectionRequest) (*Collection, error) {
+	results := make([]*Collection, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		col, err := c.CreateCollection(ctx, req)
+		results[i] = col
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// GetCollection returns the collection metadata with the totals of every
+// shard added up.
+func (s *ShardedClient) GetCollection(ctx context.Context, collection string) (*Collection, error) {
+	results := make([]*Collection, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		col, err := c.GetCollection(ctx, collection)
+		results[i] = col
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	merged := *results[0]
+	for _, col := range results[1:] {
+		merged.Total += col.Total
+	}
+	return &merged, nil
+}
+
+// DropCollection drops the collection on every shard.
+func (s *ShardedClient) DropCollection(ctx context.Context, collection string) error {
+	return s.each(func(_ int, c *Client) error {
+		return c.DropCollection(ctx, collection)
+	})
+}
+
+// SetDefaults sets the defaults on every shard.
+func (s *ShardedClient) SetDefaults(ctx context.Context, collection string, defaults map[string]any) (map[string]any, error) {
+	results := make([]map[string]any, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		result, err := c.SetDefaults(ctx, collection, defaults)
+		results[i] = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// ListIndexes returns the indexes of the first shard. Indexes are managed on
+// all shards at once, so they are expected to be the same everywhere.
+func (s *ShardedClient) ListIndexes(ctx context.Context, collection string) ([]Index, error) {
+	return s.shards[0].Client.ListIndexes(ctx, collection)
+}
+
+// CreateIndex creates the index on every shard.
+func (s *ShardedClient) CreateIndex(ctx context.Context, collection string, req *CreateIndexRequest) (*Index, error) {
+	results := make([]*Index, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		idx, err := c.CreateIndex(ctx, collection, req)
+		results[i] = idx
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return results[0], nil
+}
+
+// GetIndex returns the index as defined on the first shard.
+func (s *ShardedClient) GetIndex(ctx context.Context, collection, name string) (*Index, error) {
+	return s.shards[0].Client.GetIndex(ctx, collection, name)
+}
+
+// DropIndex drops the index on every shard.
+func (s *ShardedClient) DropIndex(ctx context.Context, collection, name string) error {
+	return s.each(func(_ int, c *Client) error {
+		return c.DropIndex(ctx, collection, name)
+	})
+}
+
+// Size adds up the numeric statistics of every shard.
+func (s *ShardedClient) Size(ctx context.Context, collection string) (map[string]any, error) {
+	results := make([]map[string]any, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		result, err := c.Size(ctx, collection)
+		results[i] = result
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	merged := map[string]any{}
+	for _, result := range results {
+		for k, v := range result {
+			n, ok := v.(float64)
+			if !ok {
+				merged[k] = v
+				continue
+			}
+			sum, _ := merged[k].(float64)
+			merged[k] = sum + n
+		}
+	}
+	return merged, nil
+}
+
+// InsertStream reads the JSON Lines payload, routes every document to its
+// shard and returns the inserted documents of all shards.
+func (s *ShardedClient) InsertStream(ctx context.Context, collection string, reader io.Reader) (*JSONStream, error) {
+	if reader == nil {
+		return s.InsertDocuments(ctx, collection)
+	}
+	var documents []any
+	dec := json.NewDecoder(reader)
+	for {
+		var doc json.RawMessage
+		if err := dec.Decode(&doc); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return nil, fmt.Errorf("decode insert payload: %w", err)
+		}
+		documents = append(documents, doc)
+	}
+	return s.InsertDocuments(ctx, collection, documents...)
+}
+
+// InsertDocuments routes every document to its shard and returns the
+// inserted documents of all shards.
+func (s *ShardedClient) InsertDocuments(ctx context.Context, collection string, documents ...any) (*JSONStream, error) {
+	groups := make([][]any, len(s.shards))
+	for _, doc := range documents {
+		data, err := json.Marshal(doc)
+		if err != nil {
+			return nil, fmt.Errorf("encode insert payload: %w", err)
+		}
+		fields, err := decodeRawObject(data)
+		if err != nil {
+			return nil, fmt.Errorf("encode insert payload: %w", err)
+		}
+		value, ok := fields[s.key]
+		if !ok {
+			return nil, fmt.Errorf("document without shard key %q", s.key)
+		}
+		i := s.lookup(string(value))
+		groups[i] = append(groups[i], json.RawMessage(data))
+	}
+
+	streams := make([]*JSONStream, len(s.shards))
+	err := s.each(func(i int, c *Client) error {
+		if len(groups[i]) == 0 {
+			return nil
+		}
+		stream, err := c.InsertDocuments(ctx, collection, groups[i]...)
+		streams[i] = stream
+		return err
+	})
+	if err != nil {
+		closeStreams(streams)
+		return nil, err
+	}
+	return mergeStreams(streams, nil, 0, 0), nil
+}
+
+// Find queries the owning shard, or every shard, and merges the results.
+func (s *ShardedClient) Find(ctx context.Context, collection string, req *FindRequest) (*JSONStream, error) {
+	query := QueryOptions{}
+	if req != nil {
+		query = req.QueryOptions
+	}
+	if i, ok := s.pinned(query.Filter); ok {
+		return s.shards[i].Client.Find(ctx, collection, req)
+	}
+
+	less, err := s.indexOrder(ctx, collection, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every shard may hold part of the page, so each one returns everything
+	// up to the end of it and the merge applies Skip.
+	shardQuery := query
+	shardQuery.Skip = 0
+	if query.Limit > 0 {
+		shardQuery.Limit = query.Skip + query.Limit
+	}
+	streams := make([]*JSONStream, len(s.shards))
+	err = s.each(func(i int, c *Client) error {
+		stream, err := c.Find(ctx, collection, &FindRequest{QueryOptions: shardQuery})
+		streams[i] = stream
+		return err
+	})
+	if err != nil {
+		closeStreams(streams)
+		return nil, err
+	}
+	return mergeStreams(streams, less, query.Skip, query.Limit), nil
+}
+
+// Patch patches the matching documents of the owning shard, or of every
+// shard. When a Limit is set on a fanned-out patch, shards are patched one
+// after the other until the limit is reached; Skip is not supported then.
+// Patches setting the shard key are rejected, since the documents would stay
+// on the shard owning their old key; remove and insert them instead.
+func (s *ShardedClient) Patch(ctx context.Context, collection string, req *PatchRequest) (*JSONStream, error) {
+	if req == nil {
+		return nil, errors.New("patch request is nil")
+	}
+	if patchSetsField(req.Patch, s.key) {
+		return nil, fmt.Errorf("patch sets the shard key %q", s.key)
+	}
+	if i, ok := s.pinned(req.Filter); ok {
+		return s.shards[i].Client.Patch(ctx, collection, req)
+	}
+	return s.fanOutWrite(req.QueryOptions, func(c *Client, query QueryOptions) (*JSONStream, error) {
+		return c.Patch(ctx, collection, &PatchRequest{QueryOptions: query, Patch: req.Patch})
+	})
+}
+
+// Remove deletes the matching documents of the owning shard, or of every
+// shard, with the same Limit and Skip rules as Patch.
+func (s *ShardedClient) Remove(ctx context.Context, collection string, req *RemoveRequest) (*JSONStream, error) {
+	query := QueryOptions{}
+	if req != nil {
+		query = req.QueryOptions
+	}
+	if i, ok := s.pinned(query.Filter); ok {
+		return s.shards[i].Client.Remove(ctx, collection, req)
+	}
+	return s.fanOutWrite(query, func(c *Client, query QueryOptions) (*JSONStream, error) {
+		return c.Remove(ctx, collection, &RemoveRequest{QueryOptions: query})
+	})
+}
+
+// patchSetsField reports whether patch may set field, which it does when it
+// cannot be read as an object.
+func patchSetsField(patch any, field string) bool {
+	if fields, ok := patch.(map[string]any); ok {
+		_, ok := fields[field]
+		return ok
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		return true
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return true
+	}
+	_, ok := fields[field]
+	return ok
+}
+
+func (s *ShardedClient) fanOutWrite(query QueryOptions, fn func(*Client, QueryOptions) (*JSONStream, error)) (*JSONStream, error) {
+	if query.Limit == 0 && query.Skip == 0 {
+		streams := make([]*JSONStream, len(s.shards))
+		err := s.each(func(i int, c *Client) error {
+			stream, err := fn(c, query)
+			streams[i] = stream
+			return err
+		})
+		if err != nil {
+			closeStreams(streams)
+			return nil, err
+		}
+		return mergeStreams(streams, nil, 0, 0), nil
+	}
+	if query.Skip > 0 {
+		return nil, errors.New("skip is not supported when writing across shards")
+	}
+
+	out := &bytes.Buffer{}
+	remaining := query.Limit
+	for _, shard := range s.shards {
+		if remaining <= 0 {
+			break
+		}
+		shardQuery := query
+		shardQuery.Limit = remaining
+		stream, err := fn(shard.Client, shardQuery)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", shard.Name, err)
+		}
+		items, err := collectRaw(stream)
+		if err != nil {
+			return nil, fmt.Errorf("shard %s: %w", shard.Name, err)
+		}
+		for _, item := range items {
+			out.Write(item)
+			out.WriteByte('\n')
+		}
+		remaining -= int64(len(items))
+	}
+	return NewJSONStream(out), nil
+}
+
+// each runs fn concurrently for every shard and joins their errors.
+func (s *ShardedClient) each(fn func(i int, c *Client) error) error {
+	errs := make([]error, len(s.shards))
+	var wg sync.WaitGroup
+	for i, shard := range s.shards {
+		wg.Add(1)
+		go func(i int, shard Shard) {
+			defer wg.Done()
+			if err := fn(i, shard.Client); err != nil {
+				errs[i] = fmt.Errorf("shard %s: %w", shard.Name, err)
+			}
+		}(i, shard)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// pinned returns the shard owning the documents matched by filter when it
+// fixes the shard key to a single value.
+func (s *ShardedClient) pinned(filter map[string]any) (int, bool) {
+	value, ok := filter[s.key]
+	if !ok {
+		return 0, false
+	}
+	switch value.(type) {
+	case map[string]any, []any:
+		return 0, false
+	}
+	i, err := s.shardIndex(value)
+	return i, err == nil
+}
+
+func (s *ShardedClient) shardIndex(value any) (int, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return 0, err
+	}
+	return s.lookup(string(data)), nil
+}
+
+// lookup maps the JSON encoding of a shard key value to a shard.
+func (s *ShardedClient) lookup(key string) int {
+	var v any
+	if err := json.Unmarshal([]byte(key), &v); err == nil {
+		// Re-encode so equal values hash alike regardless of formatting.
+		if data, err := json.Marshal(v); err == nil {
+			key = string(data)
+		}
+	}
+	h := hashString(key)
+	i := sort.Search(len(s.ring), func(i int) bool { return s.ring[i].hash >= h })
+	if i == len(s.ring) {
+		i = 0
+	}
+	return s.ring[i].shard
+}
+
+// indexOrder returns the comparison used to merge results ordered by a btree
+// index, or nil when the query is not index ordered.
+func (s *ShardedClient) indexOrder(ctx context.Context, collection string, query QueryOptions) (func(a, b json.RawMessage) bool, error) {
+	if query.Index == "" || len(s.shards) == 1 {
+		return nil, nil
+	}
+	idx, err := s.GetIndex(ctx, collection, query.Index)
+	if err != nil {
+		return nil, err
+	}
+	if idx.Type != "btree" {
+		return nil, nil
+	}
+	var fields []string
+	switch v := idx.Options["fields"].(type) {
+	case []any:
+		for _, f := range v {
+			if name, ok := f.(string); ok {
+				fields = append(fields, name)
+			}
+		}
+	}
+	if field, ok := idx.Options["field"].(string); ok && len(fields) == 0 {
+		fields = []string{field}
+	}
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return func(a, b json.RawMessage) bool {
+		da, _ := decodeRawObject(a)
+		db, _ := decodeRawObject(b)
+		for _, field := range fields {
+			desc := strings.HasPrefix(field, "-")
+			name := strings.TrimPrefix(field, "-")
+			cmp := compareJSON(da[name], db[name])
+			if desc {
+				cmp = -cmp
+			}
+			if query.Reverse {
+				cmp = -cmp
+			}
+			if cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	}, nil
+}
+
+// compareJSON orders JSON values: missing and null first, then numbers,
+// strings, booleans and anything else by its encoding.
+func compareJSON(a, b json.RawMessage) int {
+	va, ra := jsonRank(a)
+	vb, rb := jsonRank(b)
+	if ra != rb {
+		return ra - rb
+	}
+	switch x := va.(type) {
+	case float64:
+		y := vb.(float64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case string:
+		return strings.Compare(x, vb.(string))
+	case bool:
+		y := vb.(bool)
+		switch {
+		case x == y:
+			return 0
+		case !x:
+			return -1
+		}
+		return 1
+	}
+	return bytes.Compare(a, b)
+}
+
+func jsonRank(raw json.RawMessage) (any, int) {
+	var v any
+	if len(raw) == 0 || json.Unmarshal(raw, &v) != nil || v == nil {
+		return nil, 0
+	}
+	switch v.(type) {
+	case float64:
+		return v, 1
+	case string:
+		return v, 2
+	case bool:
+		return v, 3
+	}
+	return v, 4
+}
+
+// hashString hashes s with FNV-1a followed by the murmur3 finalizer, since
+// FNV alone barely changes the high bits for keys that differ at the end.
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func closeStreams(streams []*JSONStream) {
+	for _, stream := range streams {
+		if stream != nil {
+			stream.Close()
+		}
+	}
+}
+
+// mergeStreams combines several streams into one. With a nil less function
+// the sources are concatenated; otherwise they are merged in order. skip and
+// limit are applied to the merged sequence.
+func mergeStreams(sources []*JSONStream, less func(a, b json.RawMessage) bool, skip, limit int64) *JSONStream {
+	var live []*JSONStream
+	for _, src := range sources {
+		if src != nil {
+			live = append(live, src)
+		}
+	}
+	body := &mergedBody{
+		sources: live,
+		heads:   make([]json.RawMessage, len(live)),
+		done:    make([]bool, len(live)),
+		less:    less,
+		skip:    skip,
+		limit:   limit,
+	}
+	return NewJSONStream(body)
+}
+
+type mergedBody struct {
+	sources []*JSONStream
+	heads   []json.RawMessage
+	done    []bool
+	less    func(a, b json.RawMessage) bool
+	skip    int64
+	limit   int64
+	emitted int64
+	current int
+	buf     bytes.Buffer
+	err     error
+}
+
+func (m *mergedBody) Read(p []byte) (int, error) {
+	for m.buf.Len() == 0 {
+		if m.err != nil {
+			return 0, m.err
+		}
+		if m.limit > 0 && m.emitted >= m.limit {
+			m.err = io.EOF
+			continue
+		}
+		item, err := m.next()
+		if err != nil {
+			m.err = err
+			continue
+		}
+		if m.skip > 0 {
+			m.skip--
+			continue
+		}
+		m.buf.Write(bytes.TrimSpace(item))
+		m.buf.WriteByte('\n')
+		m.emitted++
+	}
+	return m.buf.Read(p)
+}
+
+func (m *mergedBody) next() (json.RawMessage, error) {
+	if m.less == nil {
+		for m.current < len(m.sources) {
+			var item json.RawMessage
+			err := m.sources[m.current].Next(&item)
+			if err == nil {
+				return item, nil
+			}
+			if !errors.Is(err, io.EOF) {
+				return nil, err
+			}
+			m.current++
+		}
+		return nil, io.EOF
+	}
+
+	best := -1
+	for i, src := range m.sources {
+		if m.done[i] {
+			continue
+		}
+		if m.heads[i] == nil {
+			var item json.RawMessage
+			if err := src.Next(&item); err != nil {
+				if !errors.Is(err, io.EOF) {
+					return nil, err
+				}
+				m.done[i] = true
+				continue
+			}
+			m.heads[i] = item
+		}
+		if best < 0 || m.less(m.heads[i], m.heads[best]) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil, io.EOF
+	}
+	item := m.heads[best]
+	m.heads[best] = nil
+	return item, nil
+}
+
+func (m *mergedBody) Close() error {
+	var errs []error
+	for _, src := range m.sources {
+		if err := src.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package inceptiondb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestShardedClientRouting(t *testing.T) {
+	ctx := context.Background()
+	servers := map[string]*memoryServer{}
+	var shards []Shard
+	for _, name := range []string{"a", "b", "c"} {
+		server, client := newMemoryServer(t)
+		servers[name] = server
+		shards = append(shards, Shard{Name: name, Client: client})
+	}
+	sharded, err := NewShardedClient("user", shards...)
+	if err != nil {
+		t.Fatalf("NewShardedClient() error = %v", err)
+	}
+
+	var docs []any
+	for i := 0; i < 30; i++ {
+		docs = append(docs, map[string]any{"user": fmt.Sprintf("u%d", i), "n": i})
+	}
+	stream, err := sharded.InsertDocuments(ctx, "events", docs...)
+	if err != nil {
+		t.Fatalf("InsertDocuments() error = %v", err)
+	}
+	if inserted, err := collectRaw(stream); err != nil || len(inserted) != 30 {
+		t.Fatalf("InsertDocuments() returned %d documents, %v", len(inserted), err)
+	}
+	for name, server := range servers {
+		stored := server.documents("events")
+		if len(stored) == 0 {
+			t.Errorf("shard %s got no documents", name)
+		}
+		for _, doc := range stored {
+			if owner, _ := sharded.ShardFor(doc["user"]); owner != name {
+				t.Errorf("document %v stored on %s, owned by %s", doc, name, owner)
+			}
+		}
+	}
+
+	stream, err = sharded.Find(ctx, "events", &FindRequest{QueryOptions: QueryOptions{Skip: 3, Limit: 5}})
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if found, err := collectRaw(stream); err != nil || len(found) != 5 {
+		t.Fatalf("Find() returned %d documents, %v; want 5", len(found), err)
+	}
+
+	owner, _ := sharded.ShardFor("u7")
+	before := map[string]int{}
+	for name, server := range servers {
+		before[name] = server.requests
+	}
+	stream, err = sharded.Remove(ctx, "events", &RemoveRequest{QueryOptions: QueryOptions{Filter: map[string]any{"user": "u7"}}})
+	if err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if removed, err := collectRaw(stream); err != nil || len(removed) != 1 {
+		t.Fatalf("Remove() returned %d documents, %v; want 1", len(removed), err)
+	}
+	for name, server := range servers {
+		if got := server.requests - before[name]; (name == owner) != (got == 1) {
+			t.Errorf("shard %s received %d requests for a pinned remove (owner %s)", name, got, owner)
+		}
+	}
+}
+
+func TestShardedClientRejectsShardKeyPatch(t *testing.T) {
+	_, a := newMemoryServer(t)
+	_, b := newMemoryServer(t)
+	sharded, err := NewShardedClient("user", Shard{Name: "a", Client: a}, Shard{Name: "b", Client: b})
+	if err != nil {
+		t.Fatalf("NewShardedClient() error = %v", err)
+	}
+	for _, patch := range []any{
+		map[string]any{"user": "u2"},
+		struct {
+			User string `json:"user"`
+		}{"u2"},
+	} {
+		_, err := sharded.Patch(context.Background(), "events", &PatchRequest{
+			QueryOptions: QueryOptions{Filter: map[string]any{"user": "u1"}},
+			Patch:        patch,
+		})
+		if err == nil {
+			t.Fatalf("Patch(%v) expected an error for the shard key", patch)
+		}
+	}
+}
+
+func TestMergeStreamsOrdered(t *testing.T) {
+	less := func(a, b json.RawMessage) bool {
+		da, _ := decodeRawObject(a)
+		db, _ := decodeRawObject(b)
+		return compareJSON(da["id"], db["id"]) < 0
+	}
+	merged := mergeStreams([]*JSONStream{
+		newTestStream(t, "{\"id\":1}\n{\"id\":4}\n{\"id\":6}\n"),
+		newTestStream(t, "{\"id\":2}\n{\"id\":3}\n{\"id\":7}\n"),
+		newTestStream(t, "{\"id\":5}\n"),
+	}, less, 1, 4)
+
+	var ids []int
+	if err := Iterate(merged, func(doc *testDocument) error {
+		ids = append(ids, doc.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Iterate() error = %v", err)
+	}
+	if want := []int{2, 3, 4, 5}; !reflect.DeepEqual(ids, want) {
+		t.Fatalf("merged ids = %v, want %v", ids, want)
+	}
+}
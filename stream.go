@@ -1,27 +1,57 @@
 package inceptiondb
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 )
 
 // JSONStream wraps a streaming JSON Lines response.
 type JSONStream struct {
-	resp   *http.Response
-	dec    *json.Decoder
+	resp  *http.Response
+	codec Codec
+	lines *bufio.Reader
+	long  []byte
+	// dec frames the items once the stream turns out not to hold one value
+	// per line.
+	dec    Decoder
 	closed bool
+	call   *call
+
+	// observe, when set, receives a copy of every raw item before it is
+	// decoded into the caller's destination.
+	observe func(json.RawMessage)
+	// tee receives every raw item followed by a newline.
+	tee io.Writer
 }
 
 // ErrStopIteration signals that a JSON stream iteration should stop without
 // treating it as an error.
 var ErrStopIteration = errors.New("driver: stop iteration")
 
-func newJSONStream(resp *http.Response) *JSONStream {
+// NewJSONStream returns a stream reading JSON Lines from r, closing it when r
+// is an io.Closer. It is meant for tests and for adapting other sources to code
+// consuming client streams.
+func NewJSONStream(r io.Reader) *JSONStream {
+	body, ok := r.(io.ReadCloser)
+	if !ok {
+		body = io.NopCloser(r)
+	}
+	return newJSONStream(&http.Response{StatusCode: http.StatusOK, Body: body}, nil)
+}
+
+func newJSONStream(resp *http.Response, codec Codec) *JSONStream {
+	if codec == nil {
+		codec = JSONCodec{}
+	}
 	return &JSONStream{
-		resp: resp,
-		dec:  json.NewDecoder(resp.Body),
+		resp:  resp,
+		codec: codec,
+		lines: bufio.NewReaderSize(resp.Body, 64*1024),
 	}
 }
 
@@ -35,23 +65,176 @@ func (s *JSONStream) Close() error {
 }
 
 // Next decodes the next JSON value from the stream into v. It returns io.EOF
-// when no more items are available.
+// when no more items are available. Decoding into a *json.RawMessage skips the
+// codec and reuses the capacity of the destination, so consumers can hand the
+// bytes to a codec of their own without extra allocations; the item is still
+// checked to be valid JSON.
 func (s *JSONStream) Next(v any) error {
 	if s == nil {
 		return errors.New("nil stream")
 	}
+	line, err := s.next()
+	if err != nil {
+		return err
+	}
+	if s.observe != nil {
+		s.observe(append(json.RawMessage(nil), line...))
+	}
+	if raw, ok := v.(*json.RawMessage); ok {
+		*raw = append((*raw)[:0], line...)
+		return nil
+	}
+	if err := unmarshal(s.codec, line, v); err != nil {
+		s.Close()
+		return err
+	}
+	return nil
+}
+
+// NextRaw returns the bytes of the next item, without the trailing newline.
+// The slice is only valid until the next read from the stream; copy it to keep
+// it. It returns io.EOF when no more items are available.
+func (s *JSONStream) NextRaw() ([]byte, error) {
+	if s == nil {
+		return nil, errors.New("nil stream")
+	}
+	line, err := s.next()
+	if err != nil {
+		return nil, err
+	}
+	if s.observe != nil {
+		s.observe(append(json.RawMessage(nil), line...))
+	}
+	return line, nil
+}
+
+// WriteTo copies the remaining items to w as JSON Lines and closes the stream,
+// implementing io.WriterTo. Unless the stream is tied to instrumentation or a
+// Tee, or Next already found items spanning several lines, the response is
+// copied as it is, without splitting it into items.
+func (s *JSONStream) WriteTo(w io.Writer) (int64, error) {
+	if s == nil {
+		return 0, errors.New("nil stream")
+	}
 	if s.closed {
-		return io.EOF
+		return 0, nil
 	}
-	if err := s.dec.Decode(v); err != nil {
+	defer s.Close()
+	if s.dec == nil && s.observe == nil && s.tee == nil && s.call == nil {
+		return s.lines.WriteTo(w)
+	}
+
+	var written int64
+	for {
+		line, err := s.NextRaw()
 		if errors.Is(err, io.EOF) {
-			s.Close()
-			return io.EOF
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+		n, err := w.Write(line)
+		written += int64(n)
+		if err == nil {
+			n, err = w.Write(newline)
+			written += int64(n)
 		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// Tee copies every item read from the stream from now on, by Next, NextRaw,
+// Iterate or WriteTo, to w as JSON Lines. A failed write fails the read. Tee
+// returns s for chaining; calling it again adds another writer.
+func (s *JSONStream) Tee(w io.Writer) *JSONStream {
+	if s == nil {
+		return nil
+	}
+	if s.tee != nil {
+		w = io.MultiWriter(s.tee, w)
+	}
+	s.tee = w
+	return s
+}
+
+var newline = []byte{'\n'}
+
+// next returns the next item. The slice is only valid until the following
+// read.
+func (s *JSONStream) next() ([]byte, error) {
+	if s.closed {
+		return nil, io.EOF
+	}
+	line, err := s.readItem()
+	if err != nil {
 		s.Close()
-		return err
+		return nil, err
+	}
+	if s.tee != nil {
+		_, err := s.tee.Write(line)
+		if err == nil {
+			_, err = s.tee.Write(newline)
+		}
+		if err != nil {
+			s.Close()
+			return nil, fmt.Errorf("tee: %w", err)
+		}
+	}
+	if s.call != nil {
+		s.call.item()
+	}
+	return line, nil
+}
+
+// readItem returns the next item, compacted to a single line. Items are read
+// one per line until a line does not hold exactly one valid JSON value, as
+// with pretty-printed or concatenated values; the rest of the stream is then
+// framed with the decoder of the codec.
+func (s *JSONStream) readItem() ([]byte, error) {
+	if s.dec == nil {
+		line, err := s.readLine()
+		if err != nil || json.Valid(line) {
+			return line, err
+		}
+		rest := append(append([]byte(nil), line...), '\n')
+		s.dec = s.codec.NewDecoder(io.MultiReader(bytes.NewReader(rest), s.lines))
+	}
+	var raw json.RawMessage
+	if err := s.dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(s.long[:0])
+	if err := json.Compact(buf, raw); err != nil {
+		return nil, err
+	}
+	s.long = buf.Bytes()
+	return s.long, nil
+}
+
+// readLine returns the next non-blank line, trimmed.
+func (s *JSONStream) readLine() ([]byte, error) {
+	for {
+		line, err := s.lines.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			s.long = append(s.long[:0], line...)
+			for err == bufio.ErrBufferFull {
+				line, err = s.lines.ReadSlice('\n')
+				s.long = append(s.long, line...)
+			}
+			line = s.long
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if trimmed := bytes.TrimSpace(line); len(trimmed) > 0 {
+			return trimmed, nil
+		}
+		if err == io.EOF {
+			return nil, io.EOF
+		}
 	}
-	return nil
 }
 
 // Iterate decodes each JSON value into a typed destination and invokes fn for
@@ -88,6 +271,16 @@ func Iterate[T any](s *JSONStream, fn func(*T) error) error {
 	}
 }
 
+// Timings returns the timing breakdown of the request behind the stream. It is
+// only populated when the client was configured with WithTimings; Total and
+// Stream stay zero until the stream is closed.
+func (s *JSONStream) Timings() Timings {
+	if s == nil || s.call == nil || s.call.timer == nil {
+		return Timings{}
+	}
+	return s.call.timer.snapshot()
+}
+
 // StatusCode returns the HTTP status code associated with the stream.
 func (s *JSONStream) StatusCode() int {
 	if s == nil || s.resp == nil {
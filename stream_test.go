@@ -1,6 +1,8 @@
 package inceptiondb
 
 import (
+	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 	"reflect"
@@ -18,7 +20,7 @@ func newTestStream(t *testing.T, payload string) *JSONStream {
 		StatusCode: http.StatusOK,
 		Body:       io.NopCloser(strings.NewReader(payload)),
 	}
-	return newJSONStream(resp)
+	return newJSONStream(resp, nil)
 }
 
 func TestJSONStreamIterate(t *testing.T) {
@@ -68,3 +70,129 @@ func TestJSONStreamIterateNilStream(t *testing.T) {
 		t.Fatal("Iterate() expected error for nil stream")
 	}
 }
+
+func TestJSONStreamNextRaw(t *testing.T) {
+	stream := newTestStream(t, "{\"id\":1}\n\n  {\"id\":2}  \n")
+
+	var got []string
+	for {
+		line, err := stream.NextRaw()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextRaw() error = %v", err)
+		}
+		got = append(got, string(line))
+	}
+	want := []string{`{"id":1}`, `{"id":2}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("NextRaw() = %v, want %v", got, want)
+	}
+}
+
+func TestJSONStreamMultilineValues(t *testing.T) {
+	stream := newTestStream(t, "{\"id\":1}\n{\n  \"id\": 2,\n  \"tags\": [\"a\"]\n}\n{\"id\":3}{\"id\":4}\n{\"id\":5}\n")
+
+	var got []string
+	for {
+		var raw json.RawMessage
+		err := stream.Next(&raw)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Next() error = %v", err)
+		}
+		got = append(got, string(raw))
+	}
+	want := []string{`{"id":1}`, `{"id":2,"tags":["a"]}`, `{"id":3}`, `{"id":4}`, `{"id":5}`}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Next() = %v, want %v", got, want)
+	}
+}
+
+func TestJSONStreamInvalidRawLine(t *testing.T) {
+	stream := newTestStream(t, "{\"id\":1}\n{\"id\":\n")
+	var raw json.RawMessage
+	if err := stream.Next(&raw); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	if err := stream.Next(&raw); err == nil || err == io.EOF {
+		t.Fatalf("Next() error = %v, want a decoding error", err)
+	}
+}
+
+func TestJSONStreamWriteTo(t *testing.T) {
+	payload := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}"
+
+	// Plain streams are copied as they are.
+	stream := newTestStream(t, payload)
+	var first testDocument
+	if err := stream.Next(&first); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	var buf strings.Builder
+	n, err := stream.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if buf.String() != "{\"id\":2}\n{\"id\":3}" || n != int64(buf.Len()) {
+		t.Fatalf("WriteTo() wrote %d bytes %q", n, buf.String())
+	}
+	if err := stream.Next(&first); err != io.EOF {
+		t.Fatalf("Next() after WriteTo() error = %v, want io.EOF", err)
+	}
+
+	// Teed streams are copied item by item.
+	var tee strings.Builder
+	buf.Reset()
+	stream = newTestStream(t, payload).Tee(&tee)
+	if _, err := stream.WriteTo(&buf); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	want := "{\"id\":1}\n{\"id\":2}\n{\"id\":3}\n"
+	if buf.String() != want || tee.String() != want {
+		t.Fatalf("WriteTo() = %q, tee = %q; want %q", buf.String(), tee.String(), want)
+	}
+
+	// Once Next switched to the decoder, the buffered items are not lost.
+	buf.Reset()
+	stream = newTestStream(t, "{\n \"id\": 1\n}\n{\"id\":2}\n{\"id\":3}\n")
+	if err := stream.Next(&first); err != nil || first.ID != 1 {
+		t.Fatalf("Next() = %v, %v", first, err)
+	}
+	n, err = stream.WriteTo(&buf)
+	if err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if want := "{\"id\":2}\n{\"id\":3}\n"; buf.String() != want || n != int64(len(want)) {
+		t.Fatalf("WriteTo() wrote %d bytes %q, want %q", n, buf.String(), want)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) { return 0, io.ErrShortWrite }
+
+func TestJSONStreamTee(t *testing.T) {
+	var disk strings.Builder
+	stream := newTestStream(t, "{\"id\":1}\n{\"id\":2}\n").Tee(&disk)
+
+	var ids []int
+	if err := Iterate(stream, func(doc *testDocument) error {
+		ids = append(ids, doc.ID)
+		return nil
+	}); err != nil {
+		t.Fatalf("Iterate() error = %v", err)
+	}
+	if !reflect.DeepEqual(ids, []int{1, 2}) || disk.String() != "{\"id\":1}\n{\"id\":2}\n" {
+		t.Fatalf("ids = %v, tee = %q", ids, disk.String())
+	}
+
+	stream = newTestStream(t, "{\"id\":1}\n").Tee(failingWriter{})
+	var doc testDocument
+	if err := stream.Next(&doc); !errors.Is(err, io.ErrShortWrite) {
+		t.Fatalf("Next() error = %v, want io.ErrShortWrite", err)
+	}
+}
@@ -0,0 +1,180 @@
+package inceptiondb
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timings breaks down where the time of a request went. Durations of phases
+// that did not happen (for instance DNS and Connect on a reused connection)
+// are zero.
+type Timings struct {
+	Op         string
+	Collection string
+
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// ReusedConn reports whether an idle connection was reused.
+	ReusedConn bool
+	// TimeToFirstByte is measured from the start of the request to the first
+	// byte of the response.
+	TimeToFirstByte time.Duration
+	// TimeToFirstItem is measured from the start of the request to the first
+	// item decoded from a stream.
+	TimeToFirstItem time.Duration
+	// Stream is the time spent reading the response after its first byte, up
+	// to the moment the body was closed.
+	Stream time.Duration
+	// Total is the time from the start of the request until its body was
+	// closed. It is zero while a stream is still open.
+	Total time.Duration
+}
+
+// WithTimings records a Timings breakdown for every request using
+// net/http/httptrace. Timings are available through JSONStream.Timings, from
+// errors through TimingsFromError and, when fn is not nil, passed to fn once
+// each request completes.
+func WithTimings(fn func(Timings)) Option {
+	return func(c *Client) {
+		c.timings = true
+		c.onTimings = fn
+	}
+}
+
+// TimingsFromError returns the timings attached to an error returned by a
+// client configured with WithTimings.
+func TimingsFromError(err error) (Timings, bool) {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.Timings != nil {
+		return *apiErr.Timings, true
+	}
+	var te *timingsError
+	if errors.As(err, &te) {
+		return te.timings, true
+	}
+	return Timings{}, false
+}
+
+// timingsError carries the timings of requests that failed without a
+// response.
+type timingsError struct {
+	err     error
+	timings Timings
+}
+
+func (e *timingsError) Error() string { return e.err.Error() }
+func (e *timingsError) Unwrap() error { return e.err }
+
+// requestTimer collects the httptrace events of a call. Callbacks run on
+// transport goroutines, hence the lock.
+type requestTimer struct {
+	mu         sync.Mutex
+	start      time.Time
+	dnsStart   time.Time
+	dns        time.Duration
+	dialStart  time.Time
+	connect    time.Duration
+	tlsStart   time.Time
+	tls        time.Duration
+	reused     bool
+	firstByte  time.Time
+	firstItem  time.Time
+	end        time.Time
+	op         string
+	collection string
+}
+
+func newRequestTimer(op, collection string) *requestTimer {
+	return &requestTimer{start: time.Now(), op: op, collection: collection}
+}
+
+func (t *requestTimer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mu.Lock()
+			t.dnsStart = time.Now()
+			t.mu.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mu.Lock()
+			t.dns = time.Since(t.dnsStart)
+			t.mu.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.dialStart.IsZero() {
+				t.dialStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			t.mu.Lock()
+			t.connect = time.Since(t.dialStart)
+			t.mu.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mu.Lock()
+			t.tlsStart = time.Now()
+			t.mu.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			t.mu.Lock()
+			t.tls = time.Since(t.tlsStart)
+			t.mu.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.mu.Lock()
+			t.reused = info.Reused
+			t.mu.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			t.mu.Lock()
+			t.firstByte = time.Now()
+			t.mu.Unlock()
+		},
+	}
+}
+
+func (t *requestTimer) markFirstItem() {
+	t.mu.Lock()
+	if t.firstItem.IsZero() {
+		t.firstItem = time.Now()
+	}
+	t.mu.Unlock()
+}
+
+func (t *requestTimer) markEnd() {
+	t.mu.Lock()
+	t.end = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *requestTimer) snapshot() Timings {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	timings := Timings{
+		Op:         t.op,
+		Collection: t.collection,
+		DNS:        t.dns,
+		Connect:    t.connect,
+		TLS:        t.tls,
+		ReusedConn: t.reused,
+	}
+	if !t.firstByte.IsZero() {
+		timings.TimeToFirstByte = t.firstByte.Sub(t.start)
+	}
+	if !t.firstItem.IsZero() {
+		timings.TimeToFirstItem = t.firstItem.Sub(t.start)
+	}
+	if !t.end.IsZero() {
+		timings.Total = t.end.Sub(t.start)
+		if !t.firstByte.IsZero() {
+			timings.Stream = t.end.Sub(t.firstByte)
+		}
+	}
+	return timings
+}
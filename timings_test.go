@@ -0,0 +1,61 @@
+package inceptiondb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithTimings(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, ":remove") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte("{\"id\":1}\n"))
+		w.(http.Flusher).Flush()
+		time.Sleep(10 * time.Millisecond)
+		w.Write([]byte("{\"id\":2}\n"))
+	}))
+	defer srv.Close()
+
+	var reported []Timings
+	client, err := NewClient(srv.URL, WithTimings(func(timings Timings) {
+		reported = append(reported, timings)
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	stream, err := client.Find(ctx, "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+	timings := stream.Timings()
+	if timings.Op != "find" || timings.Connect <= 0 || timings.TimeToFirstByte <= 0 || timings.TimeToFirstItem < timings.TimeToFirstByte {
+		t.Fatalf("Timings() = %+v", timings)
+	}
+	if timings.Stream < 10*time.Millisecond || timings.Total < timings.Stream {
+		t.Fatalf("Timings() = %+v, want stream time to cover the delay", timings)
+	}
+	if len(reported) != 1 || reported[0] != timings {
+		t.Fatalf("callback got %+v, want %+v", reported, timings)
+	}
+
+	_, err = client.Remove(ctx, "items", nil)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("Remove() error = %v, want *Error", err)
+	}
+	if timings, ok := TimingsFromError(err); !ok || timings.Op != "remove" || !timings.ReusedConn {
+		t.Fatalf("TimingsFromError() = %+v, %v", timings, ok)
+	}
+}
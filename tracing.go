@@ -0,0 +1,131 @@
+package inceptiondb
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TraceParentHeader is the W3C Trace Context header injected in requests.
+const TraceParentHeader = "traceparent"
+
+// Tracer starts a span around every request made by a client. It lets the
+// client take part in distributed traces without depending on a tracing SDK;
+// adapters for a specific SDK only need to implement this interface.
+type Tracer interface {
+	// StartSpan starts a span for operation op on collection and returns a
+	// context carrying it. To propagate the span to the server, the returned
+	// context must carry its SpanContext (see ContextWithSpanContext).
+	StartSpan(ctx context.Context, op, collection string) (context.Context, Span)
+}
+
+// Span is a span started by a Tracer.
+type Span interface {
+	// End is called once when the request completes. For streamed responses
+	// that is when the stream is closed.
+	End(result SpanResult)
+}
+
+// SpanResult describes the outcome of a traced request.
+type SpanResult struct {
+	// Status is the HTTP status code, 0 when no response was received.
+	Status int
+	// Stream reports whether the response was a JSON stream, in which case
+	// Items holds the number of items read from it.
+	Stream        bool
+	Items         int64
+	BytesSent     int64
+	BytesReceived int64
+	Duration      time.Duration
+	Err           error
+}
+
+// WithTracer wraps every request in a span started by t.
+func WithTracer(t Tracer) Option {
+	return func(c *Client) {
+		c.tracer = t
+	}
+}
+
+// SpanContext identifies a span as defined by W3C Trace Context.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// NewSpanContext returns a span context with random identifiers. When parent
+// is valid, the trace ID and sampling decision are inherited from it.
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := SpanContext{Sampled: true}
+	if parent.IsValid() {
+		sc.TraceID = parent.TraceID
+		sc.Sampled = parent.Sampled
+	} else {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+	return sc
+}
+
+// IsValid reports whether both identifiers are non-zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats the span context as a traceparent header value.
+func (sc SpanContext) TraceParent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// ParseTraceParent parses a traceparent header value.
+func ParseTraceParent(value string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if parts[0] == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("invalid traceparent %q", value)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("invalid trace id: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("invalid span id: %w", err)
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return sc, fmt.Errorf("invalid trace flags: %w", err)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return sc, errors.New("traceparent with zero trace or span id")
+	}
+	return sc, nil
+}
+
+type spanContextKey struct{}
+
+// ContextWithSpanContext returns a copy of ctx carrying sc. Requests made with
+// that context send sc in the traceparent header, with or without a Tracer.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// SpanContextFromContext returns the span context carried by ctx.
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextKey{}).(SpanContext)
+	return sc, ok && sc.IsValid()
+}
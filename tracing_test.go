@@ -0,0 +1,89 @@
+package inceptiondb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testTracer struct {
+	spans []*testSpan
+}
+
+type testSpan struct {
+	op, collection string
+	sc             SpanContext
+	result         *SpanResult
+}
+
+func (t *testTracer) StartSpan(ctx context.Context, op, collection string) (context.Context, Span) {
+	parent, _ := SpanContextFromContext(ctx)
+	span := &testSpan{op: op, collection: collection, sc: NewSpanContext(parent)}
+	t.spans = append(t.spans, span)
+	return ContextWithSpanContext(ctx, span.sc), span
+}
+
+func (s *testSpan) End(result SpanResult) {
+	s.result = &result
+}
+
+func TestWithTracer(t *testing.T) {
+	var header string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header.Get(TraceParentHeader)
+		w.Write([]byte("{\"id\":1}\n{\"id\":2}\n"))
+	}))
+	defer srv.Close()
+
+	tracer := &testTracer{}
+	client, err := NewClient(srv.URL, WithTracer(tracer))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parent, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("ParseTraceParent() error = %v", err)
+	}
+	ctx := ContextWithSpanContext(context.Background(), parent)
+
+	stream, err := client.Find(ctx, "items", nil)
+	if err != nil {
+		t.Fatalf("Find() error = %v", err)
+	}
+	if _, err := collectRaw(stream); err != nil {
+		t.Fatalf("Next() error = %v", err)
+	}
+
+	if len(tracer.spans) != 1 {
+		t.Fatalf("started %d spans, want 1", len(tracer.spans))
+	}
+	span := tracer.spans[0]
+	if span.op != "find" || span.collection != "items" {
+		t.Fatalf("span = %s %s, want find items", span.op, span.collection)
+	}
+	if span.result == nil || span.result.Status != http.StatusOK || !span.result.Stream || span.result.Items != 2 {
+		t.Fatalf("span result = %+v", span.result)
+	}
+	got, err := ParseTraceParent(header)
+	if err != nil {
+		t.Fatalf("traceparent %q: %v", header, err)
+	}
+	if got.TraceID != parent.TraceID || got.SpanID != span.sc.SpanID {
+		t.Fatalf("traceparent = %s, want trace %x and span %x", header, parent.TraceID, span.sc.SpanID)
+	}
+}
+
+func TestParseTraceParentInvalid(t *testing.T) {
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(value); err == nil {
+			t.Errorf("ParseTraceParent(%q) expected error", value)
+		}
+	}
+}